@@ -18,11 +18,38 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// NetworkReadyCondition reports whether the network named in
+	// IncusClusterSpec.Network exists on the Incus server.
+	NetworkReadyCondition = "NetworkReady"
+
+	// ControlPlaneEndpointReadyCondition reports whether the control plane
+	// endpoint is set.
+	ControlPlaneEndpointReadyCondition = "ControlPlaneEndpointReady"
+
+	// ServerCompatibleCondition reports whether the Incus server is recent
+	// enough for the provider and can run virtual machines.
+	ServerCompatibleCondition = "ServerCompatible"
+
+	// DefaultAPIServerPort is used when the control plane endpoint does not
+	// specify a port.
+	DefaultAPIServerPort = 6443
+
+	// StandaloneFailureDomain is the only failure domain of an IncusCluster
+	// whose Incus server is not clustered. Machines in it are created
+	// without a target member.
+	StandaloneFailureDomain = "standalone"
 )
 
 // IncusClusterSpec defines the desired state of IncusCluster.
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Cluster infrastructure is ready"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".spec.controlPlaneEndpoint.host",description="Control plane endpoint host"
+// +kubebuilder:printcolumn:name="Port",type="integer",JSONPath=".spec.controlPlaneEndpoint.port",description="Control plane endpoint port"
 type IncusCluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -32,13 +59,81 @@ type IncusCluster struct {
 }
 
 type IncusClusterSpec struct {
+	// Network is the Incus network machines of the cluster are attached to.
+	// It is created as a managed bridge if it does not exist, and deleted with
+	// the IncusCluster if the provider created it. When empty, machines use
+	// the network of the default profile.
+	// +optional
 	Network string `json:"network,omitempty"`
+
+	// Project is the Incus project the cluster's instances and network are
+	// created in, isolating them from other clusters on the same server. The
+	// project must already exist. When empty, the default project is used.
+	// +optional
+	Project string `json:"project,omitempty"`
+
+	// StoragePool is the default Incus storage pool for the root disks of
+	// the cluster's machines. IncusMachines can override it.
+	// +optional
+	StoragePool string `json:"storagePool,omitempty"`
+
+	// DefaultProfiles lists the Incus profiles applied to the cluster's
+	// machines, in order, when an IncusMachine does not list its own.
+	// +optional
+	DefaultProfiles []string `json:"defaultProfiles,omitempty"`
+
+	// DefaultConfig holds Incus instance config keys applied to every
+	// machine of the cluster. Keys set in an IncusMachine's config take
+	// precedence.
+	// +kubebuilder:validation:XValidation:rule="!('limits.cpu' in self) && !('limits.memory' in self)",message="limits.cpu and limits.memory are set through the IncusMachine's cpus and memoryMiB"
+	// +optional
+	DefaultConfig map[string]string `json:"defaultConfig,omitempty"`
+
+	// ControlPlaneEndpoint is the address the API server of the cluster is
+	// reachable at. The port defaults to 6443. The cluster is not ready
+	// until the host is set.
+	// +optional
+	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint,omitempty"`
 }
 
 type IncusClusterStatus struct {
 	// Conditions represent the latest available observations of the cluster's state
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Ready is true once the cluster infrastructure is provisioned.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// ObservedGeneration is the generation of the spec that was last
+	// reconciled successfully.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// FailureDomains lists the online members of the Incus cluster that
+	// machines can be placed on. A standalone Incus server is a single
+	// failure domain named "standalone".
+	// +optional
+	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// Server describes the Incus server the cluster's instances run on.
+	// +optional
+	Server *IncusServerStatus `json:"server,omitempty"`
+}
+
+// IncusServerStatus describes an Incus server.
+type IncusServerStatus struct {
+	// Version is the Incus version of the server.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// APIExtensions lists the API extensions the server supports.
+	// +optional
+	APIExtensions []string `json:"apiExtensions,omitempty"`
+
+	// StorageDriver is the storage driver of the server, e.g. "zfs".
+	// +optional
+	StorageDriver string `json:"storageDriver,omitempty"`
 }
 
 // +kubebuilder:object:root=true
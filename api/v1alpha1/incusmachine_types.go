@@ -17,11 +17,128 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// InstanceProvisionedCondition reports whether the Incus instance has
+	// been created.
+	InstanceProvisionedCondition = "InstanceProvisioned"
+
+	// BootstrapDataReadyCondition reports whether the bootstrap data of the
+	// owning Machine is available.
+	BootstrapDataReadyCondition = "BootstrapDataReady"
+
+	// InstanceDeletedCondition reports problems deleting the Incus instance.
+	InstanceDeletedCondition = "InstanceDeleted"
+
+	// ConfigurationWarningCondition reports non-fatal warnings raised by Incus
+	// while applying the instance configuration.
+	ConfigurationWarningCondition = "ConfigurationWarning"
+
+	// InstanceResourcesSyncedCondition reports whether the vCPU count and
+	// memory of the instance match the spec.
+	InstanceResourcesSyncedCondition = "InstanceResourcesSynced"
+
+	// InstanceDevicesSyncedCondition reports whether the profiles and
+	// devices of the instance match the spec. It is false with reason
+	// RestartRequired while a change waits for the instance to be stopped.
+	InstanceDevicesSyncedCondition = "InstanceDevicesSynced"
+
+	// InstancePlacedCondition reports whether the instance runs on the
+	// Incus cluster member of the owning Machine's failure domain. It is
+	// only set for machines with a failure domain.
+	InstancePlacedCondition = "InstancePlaced"
+
+	// InstanceBootedCondition reports whether the instance has become ready
+	// since it was created. It is false, with the last lines of the console
+	// log in its message, once the instance has not become ready within the
+	// boot timeout.
+	InstanceBootedCondition = "InstanceBooted"
+
+	// ReadinessCommandSucceededCondition reports whether the readiness
+	// command of the IncusMachine has exited with code 0. It is only set
+	// for machines with a readiness command.
+	ReadinessCommandSucceededCondition = "ReadinessCommandSucceeded"
+
+	// DryRunCondition reports the instance a dry-run IncusMachine would
+	// create.
+	DryRunCondition = "DryRun"
+
+	// DryRunAnnotation, set to "true" on an IncusMachine, makes the
+	// controller only plan the instance: the request it would submit is
+	// logged and summarized in the DryRun condition, and nothing is created.
+	DryRunAnnotation = "infrastructure.cluster.x-k8s.io/dry-run"
+
+	// AdoptExistingAnnotation, set to "true" on an IncusMachine, lets the
+	// controller take over an existing instance of the machine's name that
+	// carries no ownership labels or those of another IncusMachine, e.g. one
+	// created by hand or managed by a previous installation. The labels are
+	// replaced and the instance is managed, and eventually deleted, like one
+	// the machine created. Without it such an instance is left alone and the
+	// machine reports an InstanceNameConflict.
+	AdoptExistingAnnotation = "infrastructure.cluster.x-k8s.io/adopt-existing"
+
+	// SnapshotBeforeDeleteAnnotation on an IncusMachine makes the controller
+	// snapshot the instance when the machine is deleted. Incus removes
+	// snapshots together with their instance, so the instance is kept
+	// instead of deleted: it is stopped, released from the machine and its
+	// cluster, and detached from the cluster network so that the network can
+	// be deleted with the cluster. The operator restores or removes it. The
+	// value is SnapshotStateless or SnapshotStateful.
+	SnapshotBeforeDeleteAnnotation = "infrastructure.cluster.x-k8s.io/snapshot-before-delete"
+
+	// PowerStateAnnotation on an IncusMachine powers its instance off or on
+	// without deleting it, e.g. to save costs or for maintenance. The value
+	// is PowerStateStopped or PowerStateRunning. Without it the controller
+	// leaves the power state of the instance alone.
+	PowerStateAnnotation = "infrastructure.cluster.x-k8s.io/power-state"
+
+	// PowerStateRunning starts the instance if it is stopped.
+	PowerStateRunning = "running"
+
+	// PowerStateStopped shuts the instance down if it is running.
+	PowerStateStopped = "stopped"
+
+	// SnapshotStateless takes a snapshot of the instance's disks only.
+	SnapshotStateless = "stateless"
+
+	// SnapshotStateful also captures the memory of the running instance.
+	SnapshotStateful = "stateful"
+
+	// DefaultImage is the image used when an IncusMachine does not set one.
+	DefaultImage = "images:ubuntu/24.04"
+
+	// DefaultCPUs is the number of vCPUs used when an IncusMachine does not
+	// set cpus.
+	DefaultCPUs = 2
+
+	// DefaultMemoryMiB is the memory used when an IncusMachine does not set
+	// memoryMiB.
+	DefaultMemoryMiB = 2048
+
+	// MaxBootPriority is the highest bootPriority of an IncusMachine.
+	MaxBootPriority = 100
+
+	// MemoryEnforceHard keeps a container within its memory limit.
+	MemoryEnforceHard = "hard"
+
+	// MemoryEnforceSoft lets a container exceed its memory limit while the
+	// host has memory to spare.
+	MemoryEnforceSoft = "soft"
 )
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Lifecycle phase of the machine"
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Instance is provisioned"
+// +kubebuilder:printcolumn:name="Instance",type="string",JSONPath=".status.instanceId",description="Name of the Incus instance"
+// +kubebuilder:printcolumn:name="Address",type="string",JSONPath=".status.addresses[0].address",description="Primary IP address of the instance"
+// +kubebuilder:printcolumn:name="Host",type="string",JSONPath=".status.host",description="Incus cluster member running the instance"
+// +kubebuilder:printcolumn:name="ProviderID",type="string",JSONPath=".spec.providerID",description="Provider ID of the instance",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type IncusMachine struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -31,22 +148,439 @@ type IncusMachine struct {
 }
 
 type IncusMachineSpec struct {
-	// Node configuration for the VM
-	Image     string `json:"image"`
-	CPUs      int    `json:"cpus"`
-	MemoryMiB int    `json:"memoryMiB"`
+	// ProviderID is the identifier of the instance, in the form
+	// incus://<instance-name>. It is set by the controller once the instance
+	// exists and matches the providerID of the instance's Node.
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// InstanceType selects whether the node runs as a virtual machine or as a
+	// system container. Containers start faster and use less memory but share
+	// the host kernel, and VM-only options such as memoryBallooning and
+	// cloudInitDatasource cannot be used with them.
+	// +kubebuilder:validation:Enum=virtual-machine;container
+	// +kubebuilder:default=virtual-machine
+	// +optional
+	InstanceType string `json:"instanceType,omitempty"`
+
+	// Image is the Incus image the instance is created from, as an alias or
+	// fingerprint, optionally prefixed with a remote. Defaults to
+	// images:ubuntu/24.04.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImageServer, when set, is the image server the image is pulled from.
+	// The image must then not carry a remote prefix.
+	// +optional
+	ImageServer *ImageServer `json:"imageServer,omitempty"`
+
+	// CPUs is the number of vCPUs of the instance. Defaults to 2, unless
+	// cpuPinning is set.
+	// +optional
+	CPUs int `json:"cpus,omitempty"`
+
+	// CPUPinning pins the instance to a set of host CPUs (limits.cpu),
+	// written as CPU IDs and ranges such as "0-3" or "0,2,4-5". The
+	// instance gets a vCPU for each pinned CPU, so cpus must not be set.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`
+	// +optional
+	CPUPinning string `json:"cpuPinning,omitempty"`
+
+	// MemoryMiB is the memory of the instance in mebibytes. Defaults to 2048.
+	// +optional
+	MemoryMiB int `json:"memoryMiB,omitempty"`
+
 	// RootDiskSizeGiB is the size of the root disk in gibibytes. If 0, the default from the image/profile is used.
 	// +optional
 	RootDiskSizeGiB int `json:"rootDiskSizeGiB,omitempty"`
+
+	// RootDiskReadIOPS caps the read operations per second of the root disk
+	// (limits.read). It cannot be combined with rootDiskReadBps. If 0, reads
+	// are not limited.
+	// +optional
+	RootDiskReadIOPS int64 `json:"rootDiskReadIOPS,omitempty"`
+
+	// RootDiskWriteIOPS caps the write operations per second of the root
+	// disk (limits.write). It cannot be combined with rootDiskWriteBps. If 0,
+	// writes are not limited.
+	// +optional
+	RootDiskWriteIOPS int64 `json:"rootDiskWriteIOPS,omitempty"`
+
+	// RootDiskReadBps caps the bytes read per second from the root disk
+	// (limits.read). If 0, reads are not limited.
+	// +optional
+	RootDiskReadBps int64 `json:"rootDiskReadBps,omitempty"`
+
+	// RootDiskWriteBps caps the bytes written per second to the root disk
+	// (limits.write). If 0, writes are not limited.
+	// +optional
+	RootDiskWriteBps int64 `json:"rootDiskWriteBps,omitempty"`
+
+	// RootDiskMaxIOPS caps the read and write operations per second of the
+	// root disk each (limits.max). It cannot be combined with
+	// rootDiskMaxBps or with the read and write limits above. If 0, the
+	// root disk has no overall limit.
+	// +optional
+	RootDiskMaxIOPS int64 `json:"rootDiskMaxIOPS,omitempty"`
+
+	// RootDiskMaxBps caps the bytes read and written per second on the root
+	// disk each (limits.max). It cannot be combined with the read and write
+	// limits above. If 0, the root disk has no overall limit.
+	// +optional
+	RootDiskMaxBps int64 `json:"rootDiskMaxBps,omitempty"`
+
+	// StoragePool is the Incus storage pool the root disk is created in. The
+	// pool must exist on the Incus server. When empty, the storage pool of
+	// the IncusCluster is used, and failing that the pool of the root disk
+	// the profiles define.
+	// +optional
+	StoragePool string `json:"storagePool,omitempty"`
+
+	// DataDisks are extra disks attached to the instance as devices data0,
+	// data1, etc. Each is backed by a custom storage volume that is created
+	// and deleted together with the instance.
+	// +optional
+	DataDisks []DataDisk `json:"dataDisks,omitempty"`
+
+	// GPUs are physical GPUs passed through to the instance as devices gpu0,
+	// gpu1, etc. A GPU without selectors gives a container every GPU of the
+	// host; a virtual machine must select its GPU by pci or vendor. GPUs are
+	// only attached when the instance is created.
+	// +optional
+	GPUs []GPUDevice `json:"gpus,omitempty"`
+
+	// Profiles lists the Incus profiles applied to the instance, in order.
+	// Every profile must exist on the Incus server. When empty, the
+	// defaultProfiles of the IncusCluster are used, or else the "default"
+	// profile. Changes are applied to the existing instance; a running
+	// virtual machine takes them once it is stopped.
+	// +optional
+	Profiles []string `json:"profiles,omitempty"`
+
+	// Config holds additional Incus instance config keys, such as
+	// limits.cpu.allowance or security.csm. They are applied on top of the
+	// provider defaults and the defaultConfig of the IncusCluster; keys the
+	// provider sets itself, such as user.capi.*, cloud-init.user-data and
+	// those of secureBoot, nesting, privileged, memorySwap, memoryEnforce,
+	// hostname and dnsServers, take precedence.
+	// limits.cpu and limits.memory are set through cpus and memoryMiB.
+	// +kubebuilder:validation:XValidation:rule="!('limits.cpu' in self) && !('limits.memory' in self)",message="limits.cpu and limits.memory are set through cpus and memoryMiB"
+	// +optional
+	Config map[string]string `json:"config,omitempty"`
+
+	// Description is the description of the instance shown by Incus. It is
+	// set when the instance is created.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Labels are stored on the instance as user.<key> config keys, so that
+	// operators can identify it in Incus. Keys starting with "capi." are
+	// reserved for the provider. Labels are set when the instance is
+	// created.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Devices holds additional Incus devices, such as extra disks, keyed by
+	// device name. The root disk and NICs the provider generates from
+	// rootDiskSizeGiB, the cluster network and networkInterfaces replace
+	// devices of the same name. Other devices are kept in sync with the
+	// instance: a running virtual machine hot-plugs NICs, disks and USB
+	// devices being added or removed, and takes other changes once it is
+	// stopped.
+	// +optional
+	Devices map[string]map[string]string `json:"devices,omitempty"`
+
+	// ConfigMapRef names a ConfigMap, in the namespace of the IncusMachine,
+	// holding instance settings shared by many machines: its "config" and
+	// "devices" keys are YAML mappings shaped like config and devices, and
+	// its "vendor-data" key is used as vendorData. A "user-data" key is
+	// rejected, as the instance's user-data is the Machine's bootstrap data;
+	// cloud-init merges vendor-data with it. Values set in the spec take
+	// precedence. The ConfigMap is read when the instance is created.
+	// +optional
+	ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty"`
+
+	// NetworkInterfaces configures NICs of the instance, e.g. to give them a
+	// static address or a fixed MAC address. An interface named eth0
+	// replaces the NIC attached to the cluster network. Interfaces are only
+	// configured when the instance is created.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// SecureBoot enforces UEFI secure boot in the VM (security.secureboot).
+	// Defaults to false, since many cloud images do not boot with it.
+	// Virtual machines only.
+	// +optional
+	SecureBoot *bool `json:"secureBoot,omitempty"`
+
+	// Nesting allows running containers, e.g. those of a container runtime
+	// or nested Incus, inside the container (security.nesting). Containers
+	// only.
+	// +optional
+	Nesting bool `json:"nesting,omitempty"`
+
+	// Privileged runs the container without a user namespace
+	// (security.privileged), so that root in the container is root on the
+	// host. Only use it for trusted workloads that need it. Containers only.
+	// +optional
+	Privileged bool `json:"privileged,omitempty"`
+
+	// BootAutostart starts the instance whenever the Incus daemon starts,
+	// e.g. after a host reboot (boot.autostart). Defaults to true. Only
+	// applied when the instance is created.
+	// +optional
+	BootAutostart *bool `json:"bootAutostart,omitempty"`
+
+	// BootPriority orders the start of autostarted instances
+	// (boot.autostart.priority): a higher priority starts first, e.g. control
+	// plane nodes before workers. Incus starts instances without a priority,
+	// 0, ahead of all others, so give every node of a cluster a priority to
+	// order them. At most 100. Only applied when the instance is created.
+	// +optional
+	BootPriority int `json:"bootPriority,omitempty"`
+
+	// DeleteProtection sets security.protection.delete on the instance so it
+	// cannot be removed out of band, e.g. by "incus delete". The controller
+	// clears the protection itself before deleting the instance.
+	// +optional
+	DeleteProtection bool `json:"deleteProtection,omitempty"`
+
+	// MemoryBallooning controls the VM memory balloon device. When unset the
+	// Incus default (enabled) is kept. Ballooning lets the host reclaim memory
+	// the guest is not using and allows live memory resizing; disabling it
+	// gives the guest a fixed, fully backed allocation, which suits
+	// latency-sensitive workloads at the cost of host memory density.
+	// +optional
+	MemoryBallooning *bool `json:"memoryBallooning,omitempty"`
+
+	// MemorySwap controls whether the kernel may swap out memory of the
+	// container (limits.memory.swap). When unset the Incus default (true) is
+	// kept. Containers only. Only applied when the instance is created.
+	// +optional
+	MemorySwap *bool `json:"memorySwap,omitempty"`
+
+	// MemoryEnforce selects how memoryMiB is enforced on the container
+	// (limits.memory.enforce): "hard" keeps it within the limit, while "soft"
+	// lets it use more as long as the host has memory to spare. When unset
+	// the Incus default (hard) is kept. Containers only. Only applied when
+	// the instance is created.
+	// +kubebuilder:validation:Enum=hard;soft
+	// +optional
+	MemoryEnforce string `json:"memoryEnforce,omitempty"`
+
+	// CloudInitDatasource forces cloud-init to use the named datasource
+	// (e.g. "nocloud") by passing a "ds=" hint in the VM's SMBIOS serial.
+	// Incus "/cloud" images detect the Incus datasource on their own; generic
+	// upstream cloud images whose datasource list does not probe NoCloud
+	// first need this hint to pick up the instance's cloud-init data.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9]*$`
+	// +optional
+	CloudInitDatasource string `json:"cloudInitDatasource,omitempty"`
+
+	// VendorData is passed to cloud-init as vendor-data
+	// (cloud-init.vendor-data), alongside the bootstrap user-data. A
+	// cloud-config document must be valid YAML. Like user-data, it is only
+	// read when the instance first boots.
+	// +optional
+	VendorData string `json:"vendorData,omitempty"`
+
+	// NetworkConfig is the cloud-init network configuration of the instance
+	// (cloud-init.network-config), a YAML document in the v1 or v2 format.
+	// It is only read when the instance first boots.
+	// +optional
+	NetworkConfig string `json:"networkConfig,omitempty"`
+
+	// Hostname is the hostname cloud-init gives the instance, and so the
+	// name its Node registers with. It must be a lowercase DNS name, e.g.
+	// "worker-0" or "worker-0.example.com". When empty, the instance name is
+	// used. It is only read when the instance first boots.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// DNSServers are the IP addresses of the resolvers of the instance,
+	// replacing those handed out by DHCP. They are set through a generated
+	// cloud-init network-config that configures every ethernet interface
+	// through DHCP, so they cannot be combined with networkConfig. They are
+	// only read when the instance first boots.
+	// +kubebuilder:validation:MaxItems=3
+	// +optional
+	DNSServers []string `json:"dnsServers,omitempty"`
+
+	// NUMANodes pins the instance to a set of host NUMA nodes (limits.cpu.nodes),
+	// written as node IDs and ranges such as "0" or "0-1,3". vCPUs and guest
+	// memory are placed on the selected nodes. When combined with
+	// cpuPinning, the pinned CPUs should belong to the selected nodes. Incus
+	// rejects nodes that do not exist on the host.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`
+	// +optional
+	NUMANodes string `json:"numaNodes,omitempty"`
+
+	// ReadinessCommand is run in the instance, e.g. ["cloud-init", "status",
+	// "--wait"], once it is running with an IPv4 address. The machine only
+	// becomes ready when the command exits with code 0; until then it is
+	// retried with backoff. Once it has succeeded it is not run again. When
+	// empty, the machine is ready as soon as the instance has an address.
+	// +optional
+	ReadinessCommand []string `json:"readinessCommand,omitempty"`
 }
 
+// DataDisk is an extra disk of an IncusMachine.
+type DataDisk struct {
+	// SizeGiB is the size of the disk in gibibytes.
+	// +kubebuilder:validation:Minimum=1
+	SizeGiB int `json:"sizeGiB"`
+
+	// Pool is the Incus storage pool the disk is created in. The pool must
+	// exist on the Incus server.
+	// +kubebuilder:validation:MinLength=1
+	Pool string `json:"pool"`
+
+	// Path, when set, mounts the disk as a filesystem at this path inside
+	// the instance. Otherwise the disk is attached to the virtual machine as
+	// a block device; containers always need a path.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// GPUDevice is a physical GPU passed through to an IncusMachine. The
+// selectors that are set must all match the GPU.
+type GPUDevice struct {
+	// Vendor selects GPUs by PCI vendor ID (vendorid), e.g. 10de for NVIDIA.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{4}$`
+	// +optional
+	Vendor string `json:"vendor,omitempty"`
+
+	// Product selects GPUs by PCI product ID (productid). It requires
+	// vendor.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{4}$`
+	// +optional
+	Product string `json:"product,omitempty"`
+
+	// PCI selects the GPU at this PCI address (pci), e.g. 0000:01:00.0.
+	// +kubebuilder:validation:Pattern=`^([0-9a-fA-F]{4}:)?[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$`
+	// +optional
+	PCI string `json:"pci,omitempty"`
+}
+
+// NetworkInterface is a NIC of an IncusMachine.
+type NetworkInterface struct {
+	// Name is the name of the NIC device and of the interface inside the
+	// instance, e.g. eth0.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,14}$`
+	Name string `json:"name"`
+
+	// Network is the managed Incus network the NIC is attached to. Defaults
+	// to the network of the IncusCluster.
+	// +optional
+	Network string `json:"network,omitempty"`
+
+	// IPv4Address is a static IPv4 address handed to the NIC by the
+	// network's DHCP server (ipv4.address). It must lie in the subnet of
+	// the network.
+	// +optional
+	IPv4Address string `json:"ipv4Address,omitempty"`
+
+	// HWAddr is the MAC address of the NIC (hwaddr), e.g. 00:16:3e:12:34:56.
+	// When empty, Incus generates one.
+	// +optional
+	HWAddr string `json:"hwAddr,omitempty"`
+}
+
+// ImageServer is a remote image server, such as a private simplestreams
+// mirror or another Incus server.
+type ImageServer struct {
+	// URL of the image server, e.g. https://images.example.com.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+
+	// Protocol spoken by the image server. Defaults to simplestreams.
+	// +kubebuilder:validation:Enum=simplestreams;incus
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// IncusMachinePhase summarizes where an IncusMachine is in its lifecycle.
+// +kubebuilder:validation:Enum=Provisioning;Running;Stopped;Deleting;Failed
+type IncusMachinePhase string
+
+const (
+	// IncusMachinePhaseProvisioning means the instance is being created or
+	// is not running with an address yet.
+	IncusMachinePhaseProvisioning IncusMachinePhase = "Provisioning"
+
+	// IncusMachinePhaseRunning means the instance is ready.
+	IncusMachinePhaseRunning IncusMachinePhase = "Running"
+
+	// IncusMachinePhaseStopped means the instance was powered off through
+	// the power-state annotation.
+	IncusMachinePhaseStopped IncusMachinePhase = "Stopped"
+
+	// IncusMachinePhaseDeleting means the IncusMachine is being deleted.
+	IncusMachinePhaseDeleting IncusMachinePhase = "Deleting"
+
+	// IncusMachinePhaseFailed means the instance could not be provisioned;
+	// the InstanceProvisioned and BootstrapDataReady conditions tell why.
+	// The controller keeps retrying.
+	IncusMachinePhaseFailed IncusMachinePhase = "Failed"
+)
+
 type IncusMachineStatus struct {
 	// Conditions represent the latest available observations of the machine's state
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
-	// InstanceID is the name of the Incus VM instance
+	// Phase summarizes the lifecycle of the machine. The conditions carry
+	// the details.
+	// +optional
+	Phase IncusMachinePhase `json:"phase,omitempty"`
+
+	// ObservedGeneration is the generation of the spec that was last
+	// reconciled successfully.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Ready is true once the instance is running and has an IPv4 address,
+	// and while it is stopped through the power-state annotation.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// PowerState is the state of the instance last reported by Incus, in
+	// lower case, e.g. running or stopped.
+	// +optional
+	PowerState string `json:"powerState,omitempty"`
+
+	// Addresses are the IP addresses of the instance.
+	// +optional
+	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
+
+	// InstanceID is the name of the Incus VM instance. It equals the
+	// IncusMachine name unless that name is not a valid Incus instance name,
+	// in which case a sanitized name with a hash suffix is used. It is
+	// recorded before the instance is created, so a machine whose create
+	// was interrupted finds its instance again.
 	InstanceID string `json:"instanceId,omitempty"`
+
+	// Project is the Incus project the instance was created in, empty for
+	// the default project. The instance is deleted from this project even
+	// if the IncusCluster is gone by then.
+	// +optional
+	Project string `json:"project,omitempty"`
+
+	// Host is the Incus cluster member the instance runs on. It is empty when
+	// the Incus server is not clustered.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// TargetMember is the Incus cluster member the provider chose to create
+	// the instance of a control plane machine without a failure domain on,
+	// spreading the control plane across members. It is recorded before the
+	// instance is created.
+	// +optional
+	TargetMember string `json:"targetMember,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,68 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Image",type="string",JSONPath=".spec.template.spec.image",description="Image of the instances"
+// +kubebuilder:printcolumn:name="CPUs",type="integer",JSONPath=".spec.template.spec.cpus",description="vCPUs of the instances"
+// +kubebuilder:printcolumn:name="MemoryMiB",type="integer",JSONPath=".spec.template.spec.memoryMiB",description="Memory of the instances"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// IncusMachineTemplate is the template MachineDeployments and
+// KubeadmControlPlanes clone IncusMachines from.
+type IncusMachineTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IncusMachineTemplateSpec `json:"spec,omitempty"`
+}
+
+// IncusMachineTemplateSpec describes the IncusMachines created from the
+// template.
+type IncusMachineTemplateSpec struct {
+	Template IncusMachineTemplateResource `json:"template"`
+}
+
+// IncusMachineTemplateResource is the IncusMachine every clone of the
+// template starts as.
+type IncusMachineTemplateResource struct {
+	// ObjectMeta holds the labels and annotations copied to the clones.
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the spec of the clones. providerID must not be set, as every
+	// clone gets its own.
+	Spec IncusMachineSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// IncusMachineTemplateList contains a list of IncusMachineTemplate.
+type IncusMachineTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IncusMachineTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IncusMachineTemplate{}, &IncusMachineTemplateList{})
+}
@@ -17,18 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -40,9 +46,14 @@ import (
 	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
 	"github.com/j-griffith/cluster-api-provider-incus/internal/controller"
 	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+	webhookinfrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
+// incusReadyTimeout bounds the Incus ping of the readiness check. It is
+// shorter than the timeout of the manager's readiness probe.
+const incusReadyTimeout = 3 * time.Second
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -51,6 +62,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
 	utilruntime.Must(infrastructurev1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
@@ -64,6 +76,14 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var incusWarningsAsErrors bool
+	var incusRemoteSecret string
+	var incusInsecureSkipVerify bool
+	var incusProject string
+	var incusMachineConcurrency int
+	var incusMaxOperations int
+	var gcOrphanedInstances bool
+	var incusConnectTimeout, incusCreateTimeout, incusDeleteTimeout, incusBootTimeout time.Duration
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -82,6 +102,31 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&incusWarningsAsErrors, "incus-warnings-as-errors", false,
+		"If set, warnings reported by Incus for an instance fail the reconcile instead of only setting a condition.")
+	flag.StringVar(&incusRemoteSecret, "incus-remote-secret", "",
+		"The <namespace>/<name> of a Secret holding the URL and TLS credentials of a remote Incus server. "+
+			"If empty, the local Incus unix socket is used.")
+	flag.BoolVar(&incusInsecureSkipVerify, "incus-insecure-skip-verify", false,
+		"If set, the certificate of the remote Incus server is not verified. Intended only for test environments.")
+	flag.IntVar(&incusMachineConcurrency, "incusmachine-concurrency", 10,
+		"The number of IncusMachines reconciled in parallel.")
+	flag.IntVar(&incusMaxOperations, "incus-max-concurrent-operations", 10,
+		"The maximum number of instance operations, such as creates and deletes, run on the Incus server at once. "+
+			"Zero removes the limit.")
+	flag.BoolVar(&gcOrphanedInstances, "gc-orphaned-instances", false,
+		"If set, Incus instances created by an IncusMachine that no longer exists are deleted on startup.")
+	flag.StringVar(&incusProject, "incus-project", "",
+		"The Incus project used for clusters that do not set spec.project. If empty, the default project is used.")
+	flag.DurationVar(&incusConnectTimeout, "incus-connect-timeout", 10*time.Second,
+		"How long establishing a connection to the Incus server may take. Zero disables the timeout.")
+	flag.DurationVar(&incusCreateTimeout, "incus-create-timeout", 5*time.Minute,
+		"How long creating an Incus instance may take before it is retried.")
+	flag.DurationVar(&incusDeleteTimeout, "incus-delete-timeout", 5*time.Minute,
+		"How long deleting an Incus instance may take before it is retried.")
+	flag.DurationVar(&incusBootTimeout, "incus-boot-timeout", 10*time.Minute,
+		"How long a created Incus instance may take to become ready before the tail of its console log is "+
+			"reported in the InstanceBooted condition.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -203,21 +248,77 @@ func main() {
 		os.Exit(1)
 	}
 
+	incusOpts := []incus.ClientOption{
+		incus.WithMaxConcurrentOperations(incusMaxOperations),
+		incus.WithConnectTimeout(incusConnectTimeout),
+	}
+	if incusRemoteSecret != "" {
+		namespace, name, ok := strings.Cut(incusRemoteSecret, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(nil, "--incus-remote-secret must be of the form <namespace>/<name>")
+			os.Exit(1)
+		}
+		// The manager cache is not started yet, so read the Secret directly.
+		remote, err := controller.IncusRemoteFromSecret(context.Background(), mgr.GetAPIReader(),
+			types.NamespacedName{Namespace: namespace, Name: name})
+		if err != nil {
+			setupLog.Error(err, "unable to load Incus remote configuration")
+			os.Exit(1)
+		}
+		setupLog.Info("Using remote Incus server", "url", remote.URL)
+		incusOpts = append(incusOpts, remote.ClientOptions()...)
+		if incusInsecureSkipVerify {
+			setupLog.Info("Not verifying the remote Incus server certificate")
+			incusOpts = append(incusOpts, incus.WithInsecureSkipVerify())
+		}
+	}
+	if incusProject != "" {
+		incusOpts = append(incusOpts, incus.WithProject(incusProject))
+	}
+
 	if err = (&controller.IncusClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		IncusClient: incus.NewClient(incusOpts...),
+		Recorder:    mgr.GetEventRecorderFor("incuscluster-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IncusCluster")
 		os.Exit(1)
 	}
 	if err = (&controller.IncusMachineReconciler{
-		Client:      mgr.GetClient(),
-		Scheme:      mgr.GetScheme(),
-		IncusClient: incus.NewClient(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		IncusClient:             incus.NewClient(incusOpts...),
+		WarningsAsErrors:        incusWarningsAsErrors,
+		Recorder:                mgr.GetEventRecorderFor("incusmachine-controller"),
+		MaxConcurrentReconciles: incusMachineConcurrency,
+		CreateTimeout:           incusCreateTimeout,
+		DeleteTimeout:           incusDeleteTimeout,
+		BootTimeout:             incusBootTimeout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IncusMachine")
 		os.Exit(1)
 	}
+	if gcOrphanedInstances {
+		if err := mgr.Add(&controller.OrphanCollector{
+			Client:      mgr.GetAPIReader(),
+			IncusClient: incus.NewClient(incusOpts...),
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphaned instance collector")
+			os.Exit(1)
+		}
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhookinfrastructurev1alpha1.SetupIncusMachineWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IncusMachine")
+			os.Exit(1)
+		}
+		if err = webhookinfrastructurev1alpha1.SetupIncusMachineTemplateWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IncusMachineTemplate")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -244,6 +345,12 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// Only readiness depends on Incus: restarting the manager would not
+	// bring an unreachable daemon back.
+	if err := mgr.AddReadyzCheck("incus", incusReadyCheck(incus.NewClient(incusOpts...))); err != nil {
+		setupLog.Error(err, "unable to set up Incus ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -251,3 +358,13 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// incusReadyCheck returns a readiness check that fails while the Incus daemon
+// cannot be reached.
+func incusReadyCheck(incusClient incus.Client) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), incusReadyTimeout)
+		defer cancel()
+		return incusClient.Ping(ctx)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// cloudConfigHeader marks user-data as a cloud-config document.
+	cloudConfigHeader = "#cloud-config"
+
+	// kubeletDefaultsPath is read by the kubelet systemd unit installed by the
+	// kubeadm packages for KUBELET_EXTRA_ARGS.
+	kubeletDefaultsPath = "/etc/default/kubelet"
+)
+
+// providerIDForInstance returns the providerID for an Incus instance. The
+// same value is set on the IncusMachine and passed to the kubelet so the
+// Machine can be matched to its Node.
+func providerIDForInstance(instanceName string) string {
+	return "incus://" + instanceName
+}
+
+// injectProviderID adds a write_files entry to cloud-config user-data that
+// makes the kubelet register its Node with providerID. User-data in any other
+// format is returned unchanged.
+func injectProviderID(userData, providerID string) (string, error) {
+	if !strings.HasPrefix(userData, cloudConfigHeader) {
+		return userData, nil
+	}
+
+	cloudConfig := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(userData), &cloudConfig); err != nil {
+		return "", fmt.Errorf("failed to parse cloud-config: %w", err)
+	}
+	if cloudConfig == nil {
+		cloudConfig = map[string]interface{}{}
+	}
+
+	writeFiles, ok := cloudConfig["write_files"].([]interface{})
+	if !ok && cloudConfig["write_files"] != nil {
+		return "", fmt.Errorf("cloud-config write_files is not a list")
+	}
+	cloudConfig["write_files"] = append(writeFiles, map[string]interface{}{
+		"path":        kubeletDefaultsPath,
+		"owner":       "root:root",
+		"permissions": "0644",
+		"content":     fmt.Sprintf("KUBELET_EXTRA_ARGS=--provider-id=%s\n", providerID),
+	})
+
+	out, err := yaml.Marshal(cloudConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	return cloudConfigHeader + "\n" + string(out), nil
+}
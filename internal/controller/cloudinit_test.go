@@ -0,0 +1,52 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("injectProviderID", func() {
+	It("should append the kubelet defaults to existing write_files", func() {
+		userData := "#cloud-config\nwrite_files:\n- path: /run/kubeadm/kubeadm.yaml\n  content: foo\nruncmd:\n- kubeadm init\n"
+
+		out, err := injectProviderID(userData, "incus://node-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix("#cloud-config\n"))
+
+		cloudConfig := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(out), &cloudConfig)).To(Succeed())
+		Expect(cloudConfig).To(HaveKeyWithValue("runcmd", ConsistOf("kubeadm init")))
+		Expect(cloudConfig["write_files"]).To(ConsistOf(
+			HaveKeyWithValue("path", "/run/kubeadm/kubeadm.yaml"),
+			SatisfyAll(
+				HaveKeyWithValue("path", kubeletDefaultsPath),
+				HaveKeyWithValue("content", "KUBELET_EXTRA_ARGS=--provider-id=incus://node-0\n"),
+			),
+		))
+	})
+
+	It("should leave user-data that is not cloud-config unchanged", func() {
+		userData := `{"ignition":{"version":"3.4.0"}}`
+
+		out, err := injectProviderID(userData, "incus://node-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(userData))
+	})
+})
@@ -0,0 +1,46 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Normal events recorded by the controllers. Warning events
+// use the reason of the condition they accompany.
+const (
+	eventInstanceCreated = "InstanceCreated"
+	eventInstanceDeleted = "InstanceDeleted"
+	eventInstanceAdopted = "InstanceAdopted"
+	eventSnapshotCreated = "SnapshotCreated"
+	eventInstanceKept    = "InstanceKept"
+	eventInstanceMoved   = "InstanceMoved"
+	eventInstanceStopped = "InstanceStopped"
+	eventInstanceStarted = "InstanceStarted"
+	eventNetworkCreated  = "NetworkCreated"
+	eventNetworkDeleted  = "NetworkDeleted"
+)
+
+// recordEvent records an event on obj. Reconcilers built without a recorder,
+// as in unit tests, record nothing.
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
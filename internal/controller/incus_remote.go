@@ -0,0 +1,88 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+// Keys read from a Secret describing a remote Incus server.
+const (
+	// IncusRemoteURLKey holds the HTTPS URL of the Incus server.
+	IncusRemoteURLKey = "url"
+	// IncusRemoteClientCertKey holds the PEM encoded client certificate.
+	IncusRemoteClientCertKey = "tls.crt"
+	// IncusRemoteClientKeyKey holds the PEM encoded client key.
+	IncusRemoteClientKeyKey = "tls.key"
+	// IncusRemoteServerCertKey optionally holds the PEM encoded server
+	// certificate to trust instead of the system CAs.
+	IncusRemoteServerCertKey = "server.crt"
+	// IncusRemoteServerFingerprintKey optionally holds the SHA-256
+	// fingerprint of the server certificate to pin instead.
+	IncusRemoteServerFingerprintKey = "server.fingerprint"
+)
+
+// IncusRemote describes how to reach a remote Incus server over HTTPS.
+type IncusRemote struct {
+	URL        string
+	ClientCert string
+	ClientKey  string
+	ServerCert string
+	// ServerFingerprint pins the server certificate by its SHA-256
+	// fingerprint, for servers using a self-signed certificate.
+	ServerFingerprint string
+}
+
+// ClientOptions returns the incus.ClientOptions that connect to the remote.
+func (r *IncusRemote) ClientOptions() []incus.ClientOption {
+	opts := []incus.ClientOption{incus.WithRemote(r.URL, r.ClientCert, r.ClientKey, r.ServerCert)}
+	if r.ServerFingerprint != "" {
+		opts = append(opts, incus.WithServerCertFingerprint(r.ServerFingerprint))
+	}
+	return opts
+}
+
+// IncusRemoteFromSecret reads the remote Incus connection details from the
+// referenced Secret. The URL, client certificate and client key are required.
+func IncusRemoteFromSecret(ctx context.Context, c client.Reader, key types.NamespacedName) (*IncusRemote, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get Incus remote secret %s: %w", key, err)
+	}
+
+	remote := &IncusRemote{
+		URL:               string(secret.Data[IncusRemoteURLKey]),
+		ClientCert:        string(secret.Data[IncusRemoteClientCertKey]),
+		ClientKey:         string(secret.Data[IncusRemoteClientKeyKey]),
+		ServerCert:        string(secret.Data[IncusRemoteServerCertKey]),
+		ServerFingerprint: strings.TrimSpace(string(secret.Data[IncusRemoteServerFingerprintKey])),
+	}
+	for _, k := range []string{IncusRemoteURLKey, IncusRemoteClientCertKey, IncusRemoteClientKeyKey} {
+		if len(secret.Data[k]) == 0 {
+			return nil, fmt.Errorf("secret %s is missing Incus remote key %q", key, k)
+		}
+	}
+	return remote, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("IncusRemoteFromSecret", func() {
+	ctx := context.Background()
+
+	key := types.NamespacedName{Name: "incus-remote", Namespace: "default"}
+
+	AfterEach(func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+	})
+
+	It("should read the remote URL and TLS material", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data: map[string][]byte{
+				IncusRemoteURLKey:        []byte("https://incus.example:8443"),
+				IncusRemoteClientCertKey: []byte("client-cert"),
+				IncusRemoteClientKeyKey:  []byte("client-key"),
+				IncusRemoteServerCertKey: []byte("server-cert"),
+			},
+		})).To(Succeed())
+
+		remote, err := IncusRemoteFromSecret(ctx, k8sClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*remote).To(Equal(IncusRemote{
+			URL:        "https://incus.example:8443",
+			ClientCert: "client-cert",
+			ClientKey:  "client-key",
+			ServerCert: "server-cert",
+		}))
+	})
+
+	It("should read a pinned server fingerprint", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data: map[string][]byte{
+				IncusRemoteURLKey:               []byte("https://incus.example:8443"),
+				IncusRemoteClientCertKey:        []byte("client-cert"),
+				IncusRemoteClientKeyKey:         []byte("client-key"),
+				IncusRemoteServerFingerprintKey: []byte("ab:cd\n"),
+			},
+		})).To(Succeed())
+
+		remote, err := IncusRemoteFromSecret(ctx, k8sClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.ServerFingerprint).To(Equal("ab:cd"))
+		Expect(remote.ClientOptions()).To(HaveLen(2))
+	})
+
+	It("should reject a secret without a client key", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data: map[string][]byte{
+				IncusRemoteURLKey:        []byte("https://incus.example:8443"),
+				IncusRemoteClientCertKey: []byte("client-cert"),
+			},
+		})).To(Succeed())
+
+		_, err := IncusRemoteFromSecret(ctx, k8sClient, key)
+		Expect(err).To(MatchError(ContainSubstring(IncusRemoteClientKeyKey)))
+	})
+})
@@ -17,25 +17,285 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+const incusClusterFinalizer = "infrastructure.cluster.x-k8s.io/incuscluster"
+
+// networkInUseRequeueAfter is how long to wait before checking again whether
+// the instances attached to a network being deleted are gone.
+const networkInUseRequeueAfter = 10 * time.Second
+
+// minimumServerMajor and minimumServerMinor are the oldest Incus release the
+// provider supports, the 6.0 LTS.
+const (
+	minimumServerMajor = 6
+	minimumServerMinor = 0
 )
 
 type IncusClusterReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme      *runtime.Scheme
+	IncusClient incus.Client
+	// Recorder records events on IncusClusters.
+	Recorder record.EventRecorder
 }
 
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *IncusClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
 	cluster := &infrastructurev1alpha1.IncusCluster{}
 	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// TODO: Reconcile the cluster (create VMs, network, etc.)
+	if !cluster.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, log, cluster)
+	}
+
+	if !controllerutil.ContainsFinalizer(cluster, incusClusterFinalizer) {
+		controllerutil.AddFinalizer(cluster, incusClusterFinalizer)
+		if err := r.Update(ctx, cluster); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	return r.reconcileNormal(ctx, log, cluster)
+}
+
+func (r *IncusClusterReconciler) reconcileNormal(ctx context.Context, log logr.Logger, cluster *infrastructurev1alpha1.IncusCluster) (ctrl.Result, error) {
+	incusClient := r.IncusClient.UseProject(cluster.Spec.Project)
+
+	// Defaulting writes the spec, so it has to happen before any status
+	// changes are made.
+	if cluster.Spec.ControlPlaneEndpoint.Host != "" && cluster.Spec.ControlPlaneEndpoint.Port == 0 {
+		patch := client.MergeFrom(cluster.DeepCopy())
+		cluster.Spec.ControlPlaneEndpoint.Port = infrastructurev1alpha1.DefaultAPIServerPort
+		if err := r.Patch(ctx, cluster, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if network := cluster.Spec.Network; network != "" {
+		// The create intent marks the network as created by this cluster so
+		// only such networks are removed on deletion.
+		created, err := incusClient.EnsureNetwork(ctx, network, map[string]string{
+			createIntentConfigKey: string(cluster.UID),
+		})
+		if err != nil {
+			log.Error(err, "Failed to ensure network", "network", network)
+			meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+				Type:    infrastructurev1alpha1.NetworkReadyCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  failureReason("NetworkCreateFailed", err),
+				Message: err.Error(),
+			})
+			cluster.Status.Ready = false
+			if updateErr := r.Status().Update(ctx, cluster); updateErr != nil {
+				log.Error(updateErr, "Failed to update status")
+			}
+			err = fmt.Errorf("failed to ensure network %q: %w", network, err)
+			recordEvent(r.Recorder, cluster, corev1.EventTypeWarning, "NetworkCreateFailed", err.Error())
+			return ctrl.Result{}, err
+		}
+		if created {
+			log.Info("Created Incus network", "network", network)
+			recordEvent(r.Recorder, cluster, corev1.EventTypeNormal, eventNetworkCreated, "Created Incus network %s", network)
+		}
+	}
+
+	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.NetworkReadyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "NetworkAvailable",
+	})
+
+	info, err := incusClient.GetServerInfo(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get Incus server info")
+		recordEvent(r.Recorder, cluster, corev1.EventTypeWarning, "ServerInfoUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+	cluster.Status.Server = &infrastructurev1alpha1.IncusServerStatus{
+		Version:       info.Version,
+		APIExtensions: info.APIExtensions,
+		StorageDriver: info.StorageDriver,
+	}
+	meta.SetStatusCondition(&cluster.Status.Conditions, serverCompatibleCondition(info))
+
+	// Each online Incus cluster member is a failure domain, as is a
+	// standalone server; machines pick one through Machine.Spec.FailureDomain.
+	members, err := incusClient.GetClusterMembers(ctx)
+	if err != nil {
+		log.Error(err, "Failed to list Incus cluster members")
+		recordEvent(r.Recorder, cluster, corev1.EventTypeWarning, "ClusterMembersUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+	cluster.Status.FailureDomains = failureDomains(members)
+
+	if !cluster.Spec.ControlPlaneEndpoint.IsValid() {
+		log.Info("Waiting for the control plane endpoint to be set")
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.ControlPlaneEndpointReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "WaitingForControlPlaneEndpoint",
+			Message: "spec.controlPlaneEndpoint.host is not set",
+		})
+		cluster.Status.Ready = false
+		cluster.Status.ObservedGeneration = cluster.Generation
+		if err := r.Status().Update(ctx, cluster); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.ControlPlaneEndpointReadyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "ControlPlaneEndpointSet",
+	})
+	cluster.Status.Ready = true
+	cluster.Status.ObservedGeneration = cluster.Generation
+	if err := r.Status().Update(ctx, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// serverCompatibleCondition returns the ServerCompatible condition for the
+// server described by info. The condition is informational: machines can
+// still be created, but may fail on the server.
+func serverCompatibleCondition(info *incus.ServerInfo) metav1.Condition {
+	if major, minor, ok := parseVersion(info.Version); ok &&
+		(major < minimumServerMajor || (major == minimumServerMajor && minor < minimumServerMinor)) {
+		return metav1.Condition{
+			Type:    infrastructurev1alpha1.ServerCompatibleCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ServerTooOld",
+			Message: fmt.Sprintf("Incus %s is older than the minimum supported version %d.%d", info.Version, minimumServerMajor, minimumServerMinor),
+		}
+	}
+	if !info.VirtualMachines {
+		return metav1.Condition{
+			Type:    infrastructurev1alpha1.ServerCompatibleCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "VirtualMachinesUnsupported",
+			Message: "The Incus server cannot run virtual machines; only container machines can be created",
+		}
+	}
+	return metav1.Condition{
+		Type:   infrastructurev1alpha1.ServerCompatibleCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "ServerSupported",
+	}
+}
+
+// parseVersion returns the major and minor number of a version such as
+// "6.0.4".
+func parseVersion(version string) (int, int, bool) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// failureDomains returns a failure domain for every online cluster member, or
+// nil if there are none. Every member can host control plane machines. A
+// server that is not clustered, without members, is the single
+// StandaloneFailureDomain.
+func failureDomains(members []incus.ClusterMember) clusterv1.FailureDomains {
+	if members == nil {
+		return clusterv1.FailureDomains{
+			infrastructurev1alpha1.StandaloneFailureDomain: {ControlPlane: true},
+		}
+	}
+	var domains clusterv1.FailureDomains
+	for _, m := range members {
+		if m.Status != "Online" {
+			continue
+		}
+		if domains == nil {
+			domains = clusterv1.FailureDomains{}
+		}
+		domains[m.Name] = clusterv1.FailureDomainSpec{ControlPlane: true}
+	}
+	return domains
+}
+
+func (r *IncusClusterReconciler) reconcileDelete(ctx context.Context, log logr.Logger, cluster *infrastructurev1alpha1.IncusCluster) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cluster, incusClusterFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if network := cluster.Spec.Network; network != "" {
+		incusClient := r.IncusClient.UseProject(cluster.Spec.Project)
+		config, err := incusClient.NetworkConfig(ctx, network)
+		if err != nil {
+			log.Error(err, "Failed to look up network during deletion", "network", network)
+			return ctrl.Result{}, err
+		}
+		// Leave networks that existed before the cluster alone.
+		if config != nil && config[createIntentConfigKey] == string(cluster.UID) {
+			// Incus refuses to delete a network that is in use. Instances
+			// still attached are normally those of machines being deleted
+			// along with the cluster, so wait for them to go away.
+			instances, err := incusClient.NetworkInstances(ctx, network)
+			if err != nil {
+				log.Error(err, "Failed to look up instances attached to network", "network", network)
+				return ctrl.Result{}, err
+			}
+			if len(instances) > 0 {
+				log.Info("Waiting for instances to be removed before deleting network", "network", network, "instances", instances)
+				recordEvent(r.Recorder, cluster, corev1.EventTypeWarning, "NetworkInUse", "Network %s is still used by instances %s", network, strings.Join(instances, ", "))
+				return ctrl.Result{RequeueAfter: networkInUseRequeueAfter}, nil
+			}
+			if err := incusClient.DeleteNetwork(ctx, network); err != nil {
+				log.Error(err, "Failed to delete network", "network", network)
+				recordEvent(r.Recorder, cluster, corev1.EventTypeWarning, "NetworkDeleteFailed", err.Error())
+				return ctrl.Result{}, err
+			}
+			log.Info("Deleted Incus network", "network", network)
+			recordEvent(r.Recorder, cluster, corev1.EventTypeNormal, eventNetworkDeleted, "Deleted Incus network %s", network)
+		}
+	}
+
+	controllerutil.RemoveFinalizer(cluster, incusClusterFinalizer)
+	if err := r.Update(ctx, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -22,12 +22,18 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus/incustest"
 )
 
 var _ = Describe("IncusCluster Controller", func() {
@@ -81,4 +87,407 @@ var _ = Describe("IncusCluster Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When an IncusCluster is created and deleted", func() {
+		const resourceName = "test-finalizer"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &infrastructurev1alpha1.IncusCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			})).To(Succeed())
+		})
+
+		It("should hold the IncusCluster with a finalizer until it is cleaned up", func() {
+			controllerReconciler := &IncusClusterReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: incustest.NewFakeClient(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).To(ContainElement(incusClusterFinalizer))
+
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.DeletionTimestamp.IsZero()).To(BeFalse())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When the cluster names a network", func() {
+		const resourceName = "test-network"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusClusterReconciler
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &infrastructurev1alpha1.IncusCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{incusClusterFinalizer},
+				},
+				Spec: infrastructurev1alpha1.IncusClusterSpec{
+					Network: "capi-net",
+					ControlPlaneEndpoint: clusterv1.APIEndpoint{
+						Host: "10.0.0.10",
+						Port: 6443,
+					},
+				},
+			})).To(Succeed())
+
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusClusterReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if errors.IsNotFound(err) {
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			resource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, resource))).To(Succeed())
+		})
+
+		It("should create the missing network and become ready", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Networks).To(HaveKey("capi-net"))
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.NetworkReadyCondition)).To(BeTrue())
+
+			By("deleting the IncusCluster")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Networks).NotTo(HaveKey("capi-net"))
+
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should report the online Incus cluster members as failure domains", func() {
+			fakeClient.Members = []incus.ClusterMember{
+				{Name: "member-1", Status: "Online"},
+				{Name: "member-2", Status: "Offline"},
+				{Name: "member-3", Status: "Online"},
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.FailureDomains).To(Equal(clusterv1.FailureDomains{
+				"member-1": {ControlPlane: true},
+				"member-3": {ControlPlane: true},
+			}))
+		})
+
+		It("should report a standalone Incus server as a single failure domain", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.FailureDomains).To(Equal(clusterv1.FailureDomains{
+				infrastructurev1alpha1.StandaloneFailureDomain: {ControlPlane: true},
+			}))
+		})
+
+		It("should record the creation and deletion of the network", func() {
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler.Recorder = recorder
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Normal NetworkCreated Created Incus network capi-net")))
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Normal NetworkDeleted Deleted Incus network capi-net")))
+		})
+
+		It("should wait for attached instances before deleting the network", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Networks).To(HaveKey("capi-net"))
+
+			By("deleting the IncusCluster while an instance uses the network")
+			fakeClient.AttachedInstances = map[string][]string{"capi-net": {"worker-1"}}
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(networkInUseRequeueAfter))
+			Expect(fakeClient.Networks).To(HaveKey("capi-net"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).To(ContainElement(incusClusterFinalizer))
+
+			By("deleting the network once the instance is gone")
+			fakeClient.AttachedInstances = nil
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Networks).NotTo(HaveKey("capi-net"))
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should keep a network it did not create on deletion", func() {
+			fakeClient.Networks["capi-net"] = map[string]string{}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Ready).To(BeTrue())
+
+			By("deleting the IncusCluster")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Networks).To(HaveKey("capi-net"))
+		})
+	})
+
+	Context("When recording the Incus server", func() {
+		const resourceName = "test-server-info"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusClusterReconciler
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &infrastructurev1alpha1.IncusCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{incusClusterFinalizer},
+				},
+			})).To(Succeed())
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusClusterReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, resource))).To(Succeed())
+		})
+
+		// reconcileServer reconciles the IncusCluster against a server
+		// described by info and returns its ServerCompatible condition.
+		reconcileServer := func(info incus.ServerInfo) (*infrastructurev1alpha1.IncusCluster, *metav1.Condition) {
+			fakeClient.ServerInfo = info
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ServerCompatibleCondition)
+			Expect(cond).NotTo(BeNil())
+			return resource, cond
+		}
+
+		It("should record the server version, extensions and storage driver", func() {
+			resource, cond := reconcileServer(incus.ServerInfo{
+				Version:         "6.22",
+				APIExtensions:   []string{"instances", "virtual-machines"},
+				StorageDriver:   "zfs",
+				VirtualMachines: true,
+			})
+			Expect(resource.Status.Server).To(Equal(&infrastructurev1alpha1.IncusServerStatus{
+				Version:       "6.22",
+				APIExtensions: []string{"instances", "virtual-machines"},
+				StorageDriver: "zfs",
+			}))
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should report a server older than the minimum version", func() {
+			_, cond := reconcileServer(incus.ServerInfo{Version: "0.6", VirtualMachines: true})
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("ServerTooOld"))
+		})
+
+		It("should report a server that cannot run virtual machines", func() {
+			_, cond := reconcileServer(incus.ServerInfo{Version: "6.0.4"})
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("VirtualMachinesUnsupported"))
+		})
+	})
+
+	Context("When validating the control plane endpoint", func() {
+		const resourceName = "test-endpoint"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var controllerReconciler *IncusClusterReconciler
+
+		BeforeEach(func() {
+			controllerReconciler = &IncusClusterReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: incustest.NewFakeClient(),
+			}
+		})
+
+		AfterEach(func() {
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, resource))).To(Succeed())
+		})
+
+		createCluster := func(endpoint clusterv1.APIEndpoint) {
+			Expect(k8sClient.Create(ctx, &infrastructurev1alpha1.IncusCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{incusClusterFinalizer},
+				},
+				Spec: infrastructurev1alpha1.IncusClusterSpec{ControlPlaneEndpoint: endpoint},
+			})).To(Succeed())
+		}
+
+		It("should not become ready without an endpoint", func() {
+			createCluster(clusterv1.APIEndpoint{})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Ready).To(BeFalse())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ControlPlaneEndpointReadyCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		})
+
+		It("should default the port and become ready", func() {
+			createCluster(clusterv1.APIEndpoint{Host: "10.0.0.10"})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Spec.ControlPlaneEndpoint.Port).To(Equal(int32(infrastructurev1alpha1.DefaultAPIServerPort)))
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.ControlPlaneEndpointReadyCondition)).To(BeTrue())
+		})
+
+		It("should record the generation of the spec it reconciled", func() {
+			createCluster(clusterv1.APIEndpoint{})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+
+			By("editing the spec")
+			generation := resource.Generation
+			resource.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "10.0.0.10", Port: 6443}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(resource.Generation).To(BeNumerically(">", generation))
+			Expect(resource.Status.ObservedGeneration).To(Equal(generation))
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+			Expect(resource.Status.Ready).To(BeTrue())
+		})
+	})
 })
@@ -17,13 +17,37 @@ limitations under the License.
 package controller
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
@@ -32,16 +56,153 @@ import (
 
 const incusMachineFinalizer = "infrastructure.cluster.x-k8s.io/incusmachine"
 
+// createIntentConfigKey is stamped on every instance with the UID of the
+// IncusMachine that created it, so a retried create can find and adopt an
+// instance whose name never made it into status.
+const createIntentConfigKey = "user.capi.create-intent"
+
+const (
+	// clusterConfigKey records the name of the Cluster an instance belongs
+	// to.
+	clusterConfigKey = "user.capi.cluster"
+
+	// machineUIDConfigKey records the UID of the IncusMachine that owns an
+	// instance. The controller only adopts or deletes instances whose owner
+	// matches, so a foreign instance with the same name is left alone.
+	machineUIDConfigKey = "user.capi.machine-uid"
+)
+
+// Bounds of the delay before checking again for bootstrap data that has not
+// been generated yet. The delay grows with the time the machine has been
+// waiting; the Machine watch picks up the data secret as soon as it is set.
+const (
+	bootstrapDataRequeueAfter    = 10 * time.Second
+	bootstrapDataRequeueMaxDelay = time.Minute
+)
+
+// nameConflictRequeueAfter is how long to wait before checking again whether
+// an instance name taken by an instance of another owner has been freed.
+const nameConflictRequeueAfter = 5 * time.Minute
+
+// imageNotFoundRequeueAfter is how long to wait before checking again whether
+// a missing image has been imported into the Incus server.
+const imageNotFoundRequeueAfter = 5 * time.Minute
+
+// configMapRequeueAfter is how long to wait before checking again for the
+// ConfigMap referenced by a machine that does not exist yet.
+const configMapRequeueAfter = 30 * time.Second
+
+// restartRequiredRequeueAfter is how often to check whether an instance with
+// a change held back until it is stopped has been stopped. Incus does not
+// notify the controller of the instance stopping.
+const restartRequiredRequeueAfter = time.Minute
+
+// incusOperationTimeout bounds a single Incus operation, such as creating or
+// deleting an instance, so a hung operation cannot wedge a reconcile worker.
+const incusOperationTimeout = 5 * time.Minute
+
+// instanceBootTimeout is how long a created instance may take to become
+// ready before the tail of its console log is surfaced in the InstanceBooted
+// condition.
+const instanceBootTimeout = 10 * time.Minute
+
+// readinessCommandTimeout bounds a run of the readiness command of an
+// IncusMachine; a command still running by then counts as failed. It is
+// kept short so that hanging commands do not tie up reconcile workers.
+const readinessCommandTimeout = 5 * time.Second
+
+// Bounds of the delay before running a readiness command that did not
+// succeed again. The delay grows with the time the command has been
+// failing.
+const (
+	readinessCommandRequeueAfter    = 10 * time.Second
+	readinessCommandRequeueMaxDelay = 2 * time.Minute
+)
+
+// Bounds of the console log tail included in the InstanceBooted condition.
+const (
+	consoleLogTailLines    = 20
+	consoleLogTailMaxBytes = 4096
+)
+
+// userDataConfigKey holds the cloud-init user-data of an instance.
+const userDataConfigKey = "cloud-init.user-data"
+
+// retainedFromConfigKey records the namespace/name of the deleted
+// IncusMachine on an instance kept for its pre-delete snapshot.
+const retainedFromConfigKey = "user.capi.retained-from"
+
+// preDeleteSnapshotName is the snapshot taken of an instance kept because of
+// SnapshotBeforeDeleteAnnotation.
+const preDeleteSnapshotName = "capi-pre-delete"
+
+// retainStopTimeout is how long a kept or powered off instance gets to shut
+// down cleanly.
+const retainStopTimeout = 30 * time.Second
+
+// incusUnreachableReason is the condition reason for a step that failed
+// because the Incus server could not be reached.
+const incusUnreachableReason = "IncusUnreachable"
+
+// incusBusyReason is the condition reason for a step that failed because the
+// Incus server was temporarily unable to serve it.
+const incusBusyReason = "IncusBusy"
+
+// Bounds of the delay before retrying a step that failed with a transient
+// Incus error. The delay grows with the time the step has been failing.
+const (
+	transientRetryMinDelay = 5 * time.Second
+	transientRetryMaxDelay = 2 * time.Minute
+)
+
+// Incus finishes removing an instance asynchronously, so it can still be
+// listed briefly after the delete operation completed. It is polled
+// instanceRemovalPolls times, instanceRemovalPollInterval apart, before the
+// reconcile gives up and checks back after instanceRemovalRequeueAfter.
+const (
+	instanceRemovalPolls        = 5
+	instanceRemovalPollInterval = 200 * time.Millisecond
+	instanceRemovalRequeueAfter = 5 * time.Second
+)
+
+// waitingForInstanceRemoval is the InstanceDeleted condition reason while a
+// deleted instance is still listed by Incus.
+const waitingForInstanceRemoval = "WaitingForInstanceRemoval"
+
+// deleteProtectionConfigKey prevents the instance from being deleted until
+// it is cleared.
+const deleteProtectionConfigKey = "security.protection.delete"
+
 // IncusMachineReconciler reconciles a IncusMachine object
 type IncusMachineReconciler struct {
 	client.Client
 	Scheme      *runtime.Scheme
 	IncusClient incus.Client
+	// WarningsAsErrors fails the reconcile when Incus reports warnings for
+	// the instance instead of only recording them in a condition.
+	WarningsAsErrors bool
+	// Recorder records events on IncusMachines.
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of IncusMachines reconciled in
+	// parallel. Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+	// CreateTimeout and DeleteTimeout bound creating and deleting an
+	// instance. Zero uses incusOperationTimeout.
+	CreateTimeout time.Duration
+	DeleteTimeout time.Duration
+	// BootTimeout is how long a created instance may take to become ready
+	// before its console log is surfaced. Zero uses instanceBootTimeout.
+	BootTimeout time.Duration
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusmachines/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;clusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=incusclusters,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -53,10 +214,37 @@ func (r *IncusMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	cluster, err := r.getCluster(ctx, incusMachine)
+	if err != nil {
+		log.Error(err, "Failed to get Cluster")
+		return ctrl.Result{}, err
+	}
+	// A paused Cluster or machine, e.g. during clusterctl move, is left
+	// alone entirely, including its deletion.
+	if (cluster != nil && cluster.Spec.Paused) || annotations.HasPaused(incusMachine) {
+		log.Info("Reconciliation is paused for this IncusMachine")
+		return ctrl.Result{}, nil
+	}
+
+	// All Incus calls for the machine go to the project of its cluster.
+	deleting := !incusMachine.ObjectMeta.DeletionTimestamp.IsZero()
+	incusCluster, err := r.getIncusCluster(ctx, cluster)
+	if err != nil && !(deleting && apierrors.IsNotFound(err)) {
+		log.Error(err, "Failed to get IncusCluster")
+		return ctrl.Result{}, err
+	}
+
 	// Handle deletion
-	if !incusMachine.ObjectMeta.DeletionTimestamp.IsZero() {
-		return r.reconcileDelete(ctx, log, incusMachine)
+	if deleting {
+		// The IncusCluster may be deleted first during a cluster teardown;
+		// the instance is then found in the project it was created in.
+		incusClient := r.IncusClient.UseProject(incusMachine.Status.Project)
+		if incusCluster != nil {
+			incusClient = r.incusClientFor(incusCluster)
+		}
+		return r.reconcileDelete(ctx, log, incusClient, incusCluster, incusMachine)
 	}
+	incusClient := r.incusClientFor(incusCluster)
 
 	// Add finalizer if not present
 	if !controllerutil.ContainsFinalizer(incusMachine, incusMachineFinalizer) {
@@ -67,85 +255,1369 @@ func (r *IncusMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	return r.reconcileNormal(ctx, log, incusMachine)
+	// The cluster network and project are only usable once the IncusCluster
+	// is ready. The Cluster watch triggers a reconcile when it is.
+	if incusCluster != nil && !incusCluster.Status.Ready {
+		log.Info("Waiting for the IncusCluster to be ready", "incusCluster", incusCluster.Name)
+		return ctrl.Result{}, nil
+	}
+
+	return r.reconcileNormal(ctx, log, incusClient, incusCluster, incusMachine)
 }
 
-func (r *IncusMachineReconciler) reconcileNormal(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine) (ctrl.Result, error) {
-	instanceName := incusMachine.Name
+func (r *IncusMachineReconciler) reconcileNormal(ctx context.Context, log logr.Logger, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) (ctrl.Result, error) {
+	// Kubernetes names may be longer than Incus allows or contain dots, so
+	// the instance name is derived from, but not always equal to, the
+	// IncusMachine name. Status.InstanceID records the name actually used.
+	instanceName := incus.SanitizeInstanceName(incusMachine.Name)
 	if incusMachine.Status.InstanceID != "" {
 		instanceName = incusMachine.Status.InstanceID
+	} else {
+		// A previous create may have succeeded without the status update
+		// being persisted; adopt any instance carrying our create intent.
+		adopted, err := incusClient.FindInstanceByConfig(ctx, createIntentConfigKey, string(incusMachine.UID))
+		if err != nil {
+			log.Error(err, "Failed to look up instance by create intent")
+			return ctrl.Result{}, err
+		}
+		if adopted != "" {
+			log.Info("Adopting instance carrying create intent", "instance", adopted)
+			instanceName = adopted
+		}
 	}
 
 	// Check if instance already exists
-	exists, err := r.IncusClient.InstanceExists(ctx, instanceName)
-	if err != nil {
+	info, err := incusClient.GetInstance(ctx, instanceName)
+	if err != nil && !errors.Is(err, incus.ErrInstanceNotFound) {
 		log.Error(err, "Failed to check if instance exists")
 		return ctrl.Result{}, err
 	}
 
-	if exists {
+	if info != nil {
+		switch owner := instanceOwner(info.Config); {
+		case owner == string(incusMachine.UID):
+		case incusMachine.Annotations[infrastructurev1alpha1.AdoptExistingAnnotation] == "true":
+			if err := r.adoptInstance(ctx, log, incusClient, incusMachine, instanceName, owner); err != nil {
+				log.Error(err, "Failed to adopt existing instance")
+				return ctrl.Result{}, err
+			}
+		case owner == "" && instanceRecorded(incusMachine, instanceName):
+			// The machine provisioned this instance, so its labels were
+			// stripped by a manual edit or migration; they are restored
+			// below.
+		case owner == "":
+			err := fmt.Errorf("instance %s exists but was not created by an IncusMachine", instanceName)
+			return r.markNameConflict(ctx, log, incusMachine, err), nil
+		default:
+			err := fmt.Errorf("instance %s belongs to another IncusMachine (UID %s)", instanceName, owner)
+			return r.markNameConflict(ctx, log, incusMachine, err), nil
+		}
+
+		// Re-apply ownership labels in case they were stripped; the client
+		// only writes when something changed.
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.UpdateInstanceConfig(opCtx, instanceName, ownershipConfig(incusMachine)); err != nil {
+			log.Error(err, "Failed to repair instance ownership labels")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileProviderID(ctx, incusMachine, instanceName); err != nil {
+			log.Error(err, "Failed to set providerID")
+			return ctrl.Result{}, err
+		}
+
 		// Instance already created, ensure status is updated
-		if incusMachine.Status.InstanceID != instanceName {
-			incusMachine.Status.InstanceID = instanceName
+		before := incusMachine.Status.DeepCopy()
+		incusMachine.Status.InstanceID = instanceName
+		incusMachine.Status.Project = clusterProject(incusCluster)
+		setInstanceProvisioned(incusMachine)
+		setInstanceStatus(incusMachine, info)
+		info, err = r.reconcilePowerState(ctx, log, incusClient, incusMachine, info)
+		if err != nil {
+			log.Error(err, "Failed to change the power state of the instance")
+			return ctrl.Result{}, err
+		}
+		if err := r.reconcilePlacement(ctx, log, incusClient, incusCluster, incusMachine, info); err != nil {
+			log.Error(err, "Failed to move instance to its failure domain")
+			return ctrl.Result{}, err
+		}
+		if resourcesNeedReconcile(incusMachine) {
+			if err := r.reconcileResources(ctx, log, incusClient, incusMachine, info); err != nil {
+				log.Error(err, "Failed to resize instance")
+				return ctrl.Result{}, err
+			}
+		}
+		if err := r.reconcileDevices(ctx, log, incusClient, incusCluster, incusMachine, info); err != nil {
+			log.Error(err, "Failed to update instance devices")
+			return ctrl.Result{}, err
+		}
+		readinessRetry := r.reconcileReadinessCommand(ctx, log, incusClient, incusMachine, instanceName)
+		r.reconcileBoot(ctx, log, incusClient, incusMachine, instanceName)
+		incusMachine.Status.ObservedGeneration = incusMachine.Generation
+		warnErr := r.reconcileWarnings(ctx, log, incusClient, incusMachine, instanceName)
+		if !equality.Semantic.DeepEqual(before, &incusMachine.Status) {
 			if err := r.Status().Update(ctx, incusMachine); err != nil {
 				return ctrl.Result{}, err
 			}
 		}
-		return ctrl.Result{}, nil
+		if warnErr == nil && readinessRetry > 0 {
+			log.Info("Waiting for the readiness command to succeed", "instance", instanceName, "retryAfter", readinessRetry)
+			return ctrl.Result{RequeueAfter: readinessRetry}, nil
+		}
+		if warnErr == nil && !incusMachine.Status.Ready {
+			log.Info("Waiting for the instance to be running with an IPv4 address", "instance", instanceName)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if warnErr == nil && restartRequired(incusMachine) {
+			log.Info("Waiting for the instance to be stopped to apply held-back changes", "instance", instanceName, "retryAfter", restartRequiredRequeueAfter)
+			return ctrl.Result{RequeueAfter: restartRequiredRequeueAfter}, nil
+		}
+		return ctrl.Result{}, warnErr
+	}
+
+	// Bootstrap data is only needed to create the instance.
+	userData, err := r.getBootstrapData(ctx, incusMachine)
+	if err != nil {
+		log.Error(err, "Failed to get bootstrap data")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.BootstrapDataReadyCondition, "BootstrapDataError", err)
+	}
+	if userData == "" {
+		delay := bootstrapDataRequeueAfter
+		if cond := meta.FindStatusCondition(incusMachine.Status.Conditions, infrastructurev1alpha1.BootstrapDataReadyCondition); cond != nil && cond.Reason == "WaitingForBootstrapData" {
+			delay = min(max(time.Since(cond.LastTransitionTime.Time), bootstrapDataRequeueAfter), bootstrapDataRequeueMaxDelay)
+		}
+		log.Info("Waiting for bootstrap data to be available", "retryAfter", delay)
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.BootstrapDataReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "WaitingForBootstrapData",
+			Message: "Waiting for the owning Machine's bootstrap data secret",
+		})
+		incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseProvisioning
+		if err := r.Status().Update(ctx, incusMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	// The kubelet has to register its Node with the providerID set on the
+	// IncusMachine below.
+	userData, err = injectProviderID(userData, providerIDForInstance(instanceName))
+	if err != nil {
+		log.Error(err, "Failed to add providerID to bootstrap data")
+		return ctrl.Result{}, err
+	}
+
+	network, err := clusterNetwork(ctx, incusClient, incusCluster)
+	if err != nil {
+		log.Error(err, "Failed to resolve cluster network")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "NetworkNotFound", err)
+	}
+
+	profiles := instanceProfiles(incusCluster, incusMachine)
+	if err := checkProfiles(ctx, incusClient, profiles); err != nil {
+		log.Error(err, "Failed to check instance profiles")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "ProfileNotFound", err)
+	}
+
+	pool, err := storagePool(ctx, incusClient, incusCluster, incusMachine)
+	if err != nil {
+		log.Error(err, "Failed to resolve storage pool")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "StoragePoolNotFound", err)
+	}
+
+	disks, err := dataDisks(ctx, incusClient, incusMachine)
+	if err != nil {
+		log.Error(err, "Failed to resolve data disks")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "StoragePoolNotFound", err)
+	}
+
+	target, err := r.failureDomainTarget(ctx, incusCluster, incusMachine)
+	if err != nil {
+		log.Error(err, "Failed to resolve failure domain")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "FailureDomainNotFound", err)
+	}
+	if target == "" {
+		target, err = r.controlPlaneTarget(ctx, log, incusClient, incusMachine)
+		if err != nil {
+			log.Error(err, "Failed to choose a cluster member for the control plane instance")
+			return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "PlacementFailed", err)
+		}
+	}
+
+	cm, err := machineConfigFromConfigMap(ctx, r.Client, incusMachine)
+	if apierrors.IsNotFound(err) {
+		log.Info("Waiting for the referenced ConfigMap", "configMap", incusMachine.Spec.ConfigMapRef.Name, "retryAfter", configMapRequeueAfter)
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.InstanceProvisionedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ConfigMapNotFound",
+			Message: err.Error(),
+		})
+		incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseProvisioning
+		if err := r.Status().Update(ctx, incusMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: configMapRequeueAfter}, nil
+	} else if err != nil {
+		log.Error(err, "Failed to read the referenced ConfigMap")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "InvalidConfigMap", err)
 	}
 
-	// Create the VM instance
+	// Create the VM instance. The defaulting webhook normally fills these in;
+	// the fallbacks cover objects admitted without it.
 	image := incusMachine.Spec.Image
 	if image == "" {
-		image = "images:ubuntu/24.04"
+		image = infrastructurev1alpha1.DefaultImage
 	}
-	cpus := incusMachine.Spec.CPUs
-	if cpus < 1 {
-		cpus = 2
-	}
-	memoryMiB := incusMachine.Spec.MemoryMiB
-	if memoryMiB < 1 {
-		memoryMiB = 2048
+	var imageServer infrastructurev1alpha1.ImageServer
+	if incusMachine.Spec.ImageServer != nil {
+		imageServer = *incusMachine.Spec.ImageServer
 	}
-	rootDiskSizeGiB := incusMachine.Spec.RootDiskSizeGiB
+	cpus, memoryMiB := machineResources(incusMachine)
 
-	if err := r.IncusClient.CreateInstance(ctx, instanceName, image, cpus, memoryMiB, rootDiskSizeGiB); err != nil {
+	req := incus.CreateInstanceRequest{
+		Name:                instanceName,
+		Description:         incusMachine.Spec.Description,
+		Image:               image,
+		ImageServer:         imageServer.URL,
+		ImageProtocol:       imageServer.Protocol,
+		InstanceType:        incusMachine.Spec.InstanceType,
+		CPUs:                cpus,
+		CPUPinning:          incusMachine.Spec.CPUPinning,
+		MemoryMiB:           memoryMiB,
+		RootDiskSizeGiB:     incusMachine.Spec.RootDiskSizeGiB,
+		RootDiskReadIOPS:    incusMachine.Spec.RootDiskReadIOPS,
+		RootDiskWriteIOPS:   incusMachine.Spec.RootDiskWriteIOPS,
+		RootDiskReadBps:     incusMachine.Spec.RootDiskReadBps,
+		RootDiskWriteBps:    incusMachine.Spec.RootDiskWriteBps,
+		RootDiskMaxIOPS:     incusMachine.Spec.RootDiskMaxIOPS,
+		RootDiskMaxBps:      incusMachine.Spec.RootDiskMaxBps,
+		StoragePool:         pool,
+		DataDisks:           disks,
+		GPUs:                gpus(incusMachine),
+		Config:              instanceConfig(incusCluster, incusMachine, cm),
+		Devices:             instanceDevices(incusMachine, cm),
+		Profiles:            profiles,
+		MemoryBallooning:    incusMachine.Spec.MemoryBallooning,
+		MemorySwap:          incusMachine.Spec.MemorySwap,
+		MemoryEnforce:       incusMachine.Spec.MemoryEnforce,
+		CloudInitDatasource: incusMachine.Spec.CloudInitDatasource,
+		NUMANodes:           incusMachine.Spec.NUMANodes,
+		SecureBoot:          incusMachine.Spec.SecureBoot,
+		Nesting:             incusMachine.Spec.Nesting,
+		Privileged:          incusMachine.Spec.Privileged,
+		BootAutostart:       bootAutostart(incusMachine),
+		BootPriority:        incusMachine.Spec.BootPriority,
+		UserData:            userData,
+		VendorData:          vendorData(incusMachine, cm),
+		NetworkConfig:       incusMachine.Spec.NetworkConfig,
+		Hostname:            incusMachine.Spec.Hostname,
+		DNSServers:          incusMachine.Spec.DNSServers,
+		Network:             network,
+		NetworkInterfaces:   networkInterfaces(incusMachine),
+		Target:              target,
+	}
+	if incusMachine.Spec.DeleteProtection {
+		req.Config[deleteProtectionConfigKey] = "true"
+	}
+	if names := managedDeviceNames(incusCluster, incusMachine); names != "" {
+		req.Config[managedDevicesConfigKey] = names
+	}
+	if incusMachine.Annotations[infrastructurev1alpha1.DryRunAnnotation] == "true" {
+		return ctrl.Result{}, r.reconcileDryRun(ctx, log, incusClient, incusMachine, req)
+	}
+	if exists, err := imageExists(ctx, incusClient, req); err != nil {
+		log.Error(err, "Failed to look up image")
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "InstanceCreateFailed", err)
+	} else if !exists {
+		// Creating the instance would only fail once Incus gets to the
+		// image, so wait for the image to be imported or the spec fixed.
+		err := fmt.Errorf("image %q not found on the Incus server; import it or change spec.image", req.Image)
+		log.Error(err, "Image not found")
+		_ = r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "ImageNotFound", err)
+		return ctrl.Result{RequeueAfter: imageNotFoundRequeueAfter}, nil
+	}
+	// Record the name before creating the instance, so that a create whose
+	// outcome never makes it to status is found again under that name.
+	if incusMachine.Status.InstanceID != instanceName || incusMachine.Status.Project != clusterProject(incusCluster) {
+		incusMachine.Status.InstanceID = instanceName
+		incusMachine.Status.Project = clusterProject(incusCluster)
+		if err := r.Status().Update(ctx, incusMachine); err != nil {
+			log.Error(err, "Failed to record the instance name before creating it")
+			return ctrl.Result{}, err
+		}
+	}
+	opCtx, cancel := timeoutContext(ctx, r.CreateTimeout)
+	defer cancel()
+	createStart := time.Now()
+	err = incusClient.CreateInstance(opCtx, req)
+	observeInstanceCreate(createStart, err)
+	if errors.Is(err, incus.ErrInstanceExists) {
+		// The name was taken after the lookup above, e.g. by a create that
+		// raced this one. An instance carrying our labels is adopted by the
+		// next reconcile, as is a retry if the instance is gone again.
+		config, err := incusClient.GetInstanceConfig(ctx, instanceName)
+		if err != nil {
+			log.Error(err, "Failed to get config of existing instance")
+			return ctrl.Result{}, err
+		}
+		if config == nil || ownedBy(config, incusMachine) || incusMachine.Annotations[infrastructurev1alpha1.AdoptExistingAnnotation] == "true" {
+			log.Info("Instance was created concurrently, adopting it", "instance", instanceName)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		err = fmt.Errorf("instance %s already exists and is not owned by this IncusMachine", instanceName)
+		// The recorded name belongs to another instance.
+		incusMachine.Status.InstanceID = ""
+		incusMachine.Status.Project = ""
+		return r.markNameConflict(ctx, log, incusMachine, err), nil
+	} else if errors.Is(err, incus.ErrTransient) || errors.Is(err, context.DeadlineExceeded) {
+		// A create that timed out may still finish in Incus; the retry then
+		// adopts the instance through its create intent.
+		err = fmt.Errorf("failed to create instance %s: %w", instanceName, err)
+		return r.retryTransient(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, err), nil
+	} else if errors.Is(err, incus.ErrInvalidRequest) {
+		// Retrying the same request cannot succeed; the next change to the
+		// machine triggers a new attempt.
+		log.Error(err, "Incus rejected the instance")
+		err = fmt.Errorf("failed to create instance %s: %w", instanceName, err)
+		_ = r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "InvalidInstanceRequest", err)
+		return ctrl.Result{}, nil
+	} else if err != nil {
 		log.Error(err, "Failed to create Incus instance")
+		err = fmt.Errorf("failed to create instance %s: %w", instanceName, err)
+		return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "InstanceCreateFailed", err)
+	}
+
+	if err := r.reconcileProviderID(ctx, incusMachine, instanceName); err != nil {
+		// The next reconcile adopts the instance and retries.
+		log.Error(err, "Failed to set providerID")
 		return ctrl.Result{}, err
 	}
 
 	incusMachine.Status.InstanceID = instanceName
+	incusMachine.Status.Project = clusterProject(incusCluster)
+	incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseProvisioning
+	setInstanceProvisioned(incusMachine)
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.BootstrapDataReadyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "BootstrapDataAvailable",
+	})
+	var readinessRetry time.Duration
+	if info, err := incusClient.GetInstance(ctx, instanceName); err != nil {
+		// The instance exists; the next reconcile fills in its host and
+		// readiness.
+		log.Error(err, "Failed to get instance")
+	} else {
+		setInstanceStatus(incusMachine, info)
+		readinessRetry = r.reconcileReadinessCommand(ctx, log, incusClient, incusMachine, instanceName)
+	}
+	incusMachine.Status.ObservedGeneration = incusMachine.Generation
+	warnErr := r.reconcileWarnings(ctx, log, incusClient, incusMachine, instanceName)
 	if err := r.Status().Update(ctx, incusMachine); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	log.Info("Created Incus VM instance", "instance", instanceName)
-	return ctrl.Result{}, nil
+	recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceCreated, "Created Incus instance %s", instanceName)
+	if warnErr == nil && readinessRetry > 0 {
+		return ctrl.Result{RequeueAfter: readinessRetry}, nil
+	}
+	if warnErr == nil && !incusMachine.Status.Ready {
+		// Requeue with the controller's backoff until the instance is up.
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, warnErr
+}
+
+// getBootstrapData returns the bootstrap data generated for the Machine that
+// owns the IncusMachine. It returns an empty string while the owner reference
+// or the bootstrap data secret is not set yet.
+func (r *IncusMachineReconciler) getBootstrapData(ctx context.Context, incusMachine *infrastructurev1alpha1.IncusMachine) (string, error) {
+	machine, err := util.GetOwnerMachine(ctx, r.Client, incusMachine.ObjectMeta)
+	if err != nil {
+		return "", err
+	}
+	if machine == nil || machine.Spec.Bootstrap.DataSecretName == nil {
+		return "", nil
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: machine.Namespace, Name: *machine.Spec.Bootstrap.DataSecretName}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return "", fmt.Errorf("failed to get bootstrap data secret %s: %w", key, err)
+	}
+
+	value, ok := secret.Data["value"]
+	if !ok {
+		return "", fmt.Errorf("bootstrap data secret %s has no value key", key)
+	}
+	return string(value), nil
+}
+
+// operationContext returns a context for a single Incus operation, bounded by
+// incusOperationTimeout.
+func operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, incusOperationTimeout)
+}
+
+// timeoutContext is operationContext bounded by timeout instead, if it is
+// set.
+func timeoutContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return operationContext(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// setInstanceProvisioned marks the instance as created.
+func setInstanceProvisioned(incusMachine *infrastructurev1alpha1.IncusMachine) {
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.InstanceProvisionedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "InstanceCreated",
+	})
+	meta.RemoveStatusCondition(&incusMachine.Status.Conditions, infrastructurev1alpha1.DryRunCondition)
+}
+
+// reconcileDryRun plans the instance for req instead of creating it, logs the
+// request and records it in the DryRun condition. The user-data carries
+// bootstrap secrets and is left out.
+func (r *IncusMachineReconciler) reconcileDryRun(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, req incus.CreateInstanceRequest) error {
+	post, err := incusClient.PlanInstance(ctx, req)
+	if err != nil {
+		log.Error(err, "Failed to plan Incus instance")
+		err = fmt.Errorf("failed to plan instance %s: %w", req.Name, err)
+		return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.DryRunCondition, "PlanFailed", err)
+	}
+
+	if _, ok := post.Config[userDataConfigKey]; ok {
+		post.Config = maps.Clone(post.Config)
+		post.Config[userDataConfigKey] = "REDACTED"
+	}
+	plan, err := json.Marshal(post)
+	if err != nil {
+		return fmt.Errorf("failed to render plan of instance %s: %w", req.Name, err)
+	}
+	log.Info("Dry run, not creating Incus instance", "instance", req.Name, "target", req.Target, "plan", string(plan))
+
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:    infrastructurev1alpha1.DryRunCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "InstancePlanned",
+		Message: truncateMessage(string(plan)),
+	})
+	return r.Status().Update(ctx, incusMachine)
+}
+
+// truncateMessage shortens msg to fit in a condition message.
+func truncateMessage(msg string) string {
+	const maxConditionMessage = 32768
+	const ellipsis = "..."
+	if len(msg) <= maxConditionMessage {
+		return msg
+	}
+	return msg[:maxConditionMessage-len(ellipsis)] + ellipsis
 }
 
-func (r *IncusMachineReconciler) reconcileDelete(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine) (ctrl.Result, error) {
+// markConditionFailed sets conditionType to False with err as its message and
+// persists the status. It returns err so callers can hand it back to the
+// manager; a failure to update the status is only logged.
+func (r *IncusMachineReconciler) markConditionFailed(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine, conditionType, reason string, err error) error {
+	switch conditionType {
+	case infrastructurev1alpha1.InstanceProvisionedCondition, infrastructurev1alpha1.BootstrapDataReadyCondition:
+		if incusMachine.DeletionTimestamp.IsZero() {
+			incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseFailed
+		}
+	}
+	r.recordFailure(ctx, log, incusMachine, conditionType, reason, err)
+	return err
+}
+
+// retryTransient records that a step failed because Incus was temporarily
+// unavailable and returns the result that retries it. The phase is left
+// alone, since the step is expected to succeed later. The delay doubles,
+// within transientRetryMinDelay and transientRetryMaxDelay, for as long as
+// the step keeps failing this way.
+func (r *IncusMachineReconciler) retryTransient(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine, conditionType string, err error) ctrl.Result {
+	delay := transientRetryMinDelay
+	cond := meta.FindStatusCondition(incusMachine.Status.Conditions, conditionType)
+	if cond != nil && cond.Status == metav1.ConditionFalse && cond.Reason == incusBusyReason {
+		delay = min(max(time.Since(cond.LastTransitionTime.Time), transientRetryMinDelay), transientRetryMaxDelay)
+	} else {
+		// Start the backoff from now rather than from when the condition
+		// last changed status.
+		meta.RemoveStatusCondition(&incusMachine.Status.Conditions, conditionType)
+	}
+	log.Info("Incus is temporarily unavailable, retrying", "error", err.Error(), "retryAfter", delay)
+	r.recordFailure(ctx, log, incusMachine, conditionType, incusBusyReason, err)
+	return ctrl.Result{RequeueAfter: delay}
+}
+
+// recordFailure sets conditionType to False with err as its message, records
+// a warning event and persists the status. A failure to update the status is
+// only logged.
+func (r *IncusMachineReconciler) recordFailure(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine, conditionType, reason string, err error) {
+	reason = failureReason(reason, err)
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+	recordEvent(r.Recorder, incusMachine, corev1.EventTypeWarning, reason, err.Error())
+	if updateErr := r.Status().Update(ctx, incusMachine); updateErr != nil {
+		log.Error(updateErr, "Failed to update status")
+	}
+}
+
+// failureReason returns reason, or incusUnreachableReason if err shows that
+// the Incus server could not be reached rather than that the step failed.
+func failureReason(reason string, err error) string {
+	if errors.Is(err, incus.ErrConnection) {
+		return incusUnreachableReason
+	}
+	return reason
+}
+
+// markNameConflict records that the instance name is taken by an instance the
+// machine does not own. Retrying cannot fix that, so instead of failing the
+// reconcile it only checks back after nameConflictRequeueAfter.
+func (r *IncusMachineReconciler) markNameConflict(ctx context.Context, log logr.Logger, incusMachine *infrastructurev1alpha1.IncusMachine, err error) ctrl.Result {
+	log.Error(err, "Refusing to adopt instance")
+	_ = r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceProvisionedCondition, "InstanceNameConflict", err)
+	return ctrl.Result{RequeueAfter: nameConflictRequeueAfter}
+}
+
+// reconcileProviderID sets spec.providerID for the instance if it is not set
+// yet. It writes the spec, so it must run before any status changes are made
+// to incusMachine.
+func (r *IncusMachineReconciler) reconcileProviderID(ctx context.Context, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) error {
+	if incusMachine.Spec.ProviderID != nil {
+		return nil
+	}
+	patch := client.MergeFrom(incusMachine.DeepCopy())
+	providerID := providerIDForInstance(instanceName)
+	incusMachine.Spec.ProviderID = &providerID
+	return r.Patch(ctx, incusMachine, patch)
+}
+
+// getCluster returns the Cluster named by the cluster label that CAPI sets on
+// the machine, or nil if the machine does not belong to a cluster.
+func (r *IncusMachineReconciler) getCluster(ctx context.Context, incusMachine *infrastructurev1alpha1.IncusMachine) (*clusterv1.Cluster, error) {
+	if _, ok := incusMachine.Labels[clusterv1.ClusterNameLabel]; !ok {
+		return nil, nil
+	}
+	return util.GetClusterFromMetadata(ctx, r.Client, incusMachine.ObjectMeta)
+}
+
+// getIncusCluster returns the IncusCluster of cluster, or nil if there is no
+// cluster or it is not backed by an IncusCluster.
+func (r *IncusMachineReconciler) getIncusCluster(ctx context.Context, cluster *clusterv1.Cluster) (*infrastructurev1alpha1.IncusCluster, error) {
+	if cluster == nil {
+		return nil, nil
+	}
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != "IncusCluster" {
+		return nil, nil
+	}
+
+	incusCluster := &infrastructurev1alpha1.IncusCluster{}
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: ref.Name}
+	if err := r.Get(ctx, key, incusCluster); err != nil {
+		return nil, fmt.Errorf("failed to get IncusCluster %s: %w", key, err)
+	}
+	return incusCluster, nil
+}
+
+// incusClientFor returns the Incus client scoped to the project of
+// incusCluster.
+func (r *IncusMachineReconciler) incusClientFor(incusCluster *infrastructurev1alpha1.IncusCluster) incus.Client {
+	if incusCluster == nil {
+		return r.IncusClient
+	}
+	return r.IncusClient.UseProject(incusCluster.Spec.Project)
+}
+
+// clusterProject returns the Incus project of incusCluster, or an empty
+// string for the default project.
+func clusterProject(incusCluster *infrastructurev1alpha1.IncusCluster) string {
+	if incusCluster == nil {
+		return ""
+	}
+	return incusCluster.Spec.Project
+}
+
+// clusterNetwork returns the Incus network named in incusCluster, or an empty
+// string to use the default profile's network. It fails if the named network
+// does not exist on the Incus server.
+func clusterNetwork(ctx context.Context, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster) (string, error) {
+	if incusCluster == nil || incusCluster.Spec.Network == "" {
+		return "", nil
+	}
+
+	network := incusCluster.Spec.Network
+	exists, err := incusClient.NetworkExists(ctx, network)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up network %q: %w", network, err)
+	}
+	if !exists {
+		return "", fmt.Errorf("network %q of IncusCluster %s does not exist on the Incus server", network, client.ObjectKeyFromObject(incusCluster))
+	}
+	return network, nil
+}
+
+// storagePool returns the storage pool for the root disk of the instance: the
+// pool of the IncusMachine, else that of its IncusCluster. An empty result
+// leaves the choice to the Incus client.
+func storagePool(ctx context.Context, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) (string, error) {
+	pool := incusMachine.Spec.StoragePool
+	if pool == "" && incusCluster != nil {
+		pool = incusCluster.Spec.StoragePool
+	}
+	if pool == "" {
+		return "", nil
+	}
+
+	exists, err := incusClient.StoragePoolExists(ctx, pool)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up storage pool %q: %w", pool, err)
+	}
+	if !exists {
+		return "", fmt.Errorf("storage pool %q does not exist on the Incus server", pool)
+	}
+	return pool, nil
+}
+
+// failureDomainTarget returns the Incus cluster member named by the failure
+// domain of the owning Machine, or an empty string if it has none or it is
+// the StandaloneFailureDomain of a server that is not clustered. It fails if
+// the failure domain is not one reported by incusCluster.
+func (r *IncusMachineReconciler) failureDomainTarget(ctx context.Context, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) (string, error) {
+	machine, err := util.GetOwnerMachine(ctx, r.Client, incusMachine.ObjectMeta)
+	if err != nil {
+		return "", err
+	}
+	if machine == nil || machine.Spec.FailureDomain == nil || *machine.Spec.FailureDomain == "" {
+		return "", nil
+	}
+
+	domain := *machine.Spec.FailureDomain
+	if incusCluster == nil {
+		return "", fmt.Errorf("failure domain %q requested but the machine has no IncusCluster", domain)
+	}
+	if _, ok := incusCluster.Status.FailureDomains[domain]; !ok {
+		return "", fmt.Errorf("failure domain %q is not a member of the Incus cluster of IncusCluster %s", domain, client.ObjectKeyFromObject(incusCluster))
+	}
+	if domain == infrastructurev1alpha1.StandaloneFailureDomain && len(incusCluster.Status.FailureDomains) == 1 {
+		return "", nil
+	}
+	return domain, nil
+}
+
+// controlPlaneTarget returns the Incus cluster member to create the instance
+// of a control plane machine without a failure domain on, so that the
+// control plane, and with it etcd, is spread across members. It keeps the
+// member recorded in status.targetMember while that member is online, and
+// otherwise picks the online member running the fewest control plane
+// instances of the same Cluster, then the least loaded one. The choice is
+// recorded before the instance is created, so that machines created
+// together see each other's choice. It returns an empty string for other
+// machines and on a standalone server.
+func (r *IncusMachineReconciler) controlPlaneTarget(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine) (string, error) {
+	machine, err := util.GetOwnerMachine(ctx, r.Client, incusMachine.ObjectMeta)
+	if err != nil {
+		return "", err
+	}
+	if machine == nil || !util.IsControlPlaneMachine(machine) {
+		return "", nil
+	}
+
+	members, err := incusClient.GetClusterMembers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list Incus cluster members: %w", err)
+	}
+	var online []incus.ClusterMember
+	for _, m := range members {
+		if m.Status != "Online" {
+			continue
+		}
+		if m.Name == incusMachine.Status.TargetMember {
+			return m.Name, nil
+		}
+		online = append(online, m)
+	}
+	if len(online) == 0 {
+		return "", nil
+	}
+
+	peers := &infrastructurev1alpha1.IncusMachineList{}
+	if err := r.List(ctx, peers, client.InNamespace(incusMachine.Namespace),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: machine.Spec.ClusterName},
+		client.HasLabels{clusterv1.MachineControlPlaneLabel}); err != nil {
+		return "", fmt.Errorf("failed to list control plane IncusMachines: %w", err)
+	}
+	instances := map[string]int{}
+	for _, peer := range peers.Items {
+		if peer.UID == incusMachine.UID {
+			continue
+		}
+		if peer.Status.Host != "" {
+			instances[peer.Status.Host]++
+		} else if peer.Status.TargetMember != "" {
+			instances[peer.Status.TargetMember]++
+		}
+	}
+	target := slices.MinFunc(online, func(a, b incus.ClusterMember) int {
+		return cmp.Or(
+			cmp.Compare(instances[a.Name], instances[b.Name]),
+			cmp.Compare(a.Load, b.Load),
+			cmp.Compare(a.Name, b.Name),
+		)
+	}).Name
+
+	incusMachine.Status.TargetMember = target
+	if err := r.Status().Update(ctx, incusMachine); err != nil {
+		return "", err
+	}
+	log.Info("Placing control plane instance", "member", target, "controlPlaneInstances", instances[target])
+	return target, nil
+}
+
+// dataDisks returns the data disks of incusMachine for the Incus client. It
+// fails if a disk names a storage pool that does not exist.
+func dataDisks(ctx context.Context, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine) ([]incus.DataDisk, error) {
+	var disks []incus.DataDisk
+	checked := map[string]bool{}
+	for _, disk := range incusMachine.Spec.DataDisks {
+		if !checked[disk.Pool] {
+			exists, err := incusClient.StoragePoolExists(ctx, disk.Pool)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up storage pool %q: %w", disk.Pool, err)
+			}
+			if !exists {
+				return nil, fmt.Errorf("storage pool %q of a data disk does not exist on the Incus server", disk.Pool)
+			}
+			checked[disk.Pool] = true
+		}
+		disks = append(disks, incus.DataDisk{SizeGiB: disk.SizeGiB, Pool: disk.Pool, Path: disk.Path})
+	}
+	return disks, nil
+}
+
+// bootAutostart returns whether the instance starts with the Incus daemon.
+// The defaulting webhook normally sets it; the fallback covers objects
+// admitted without it.
+func bootAutostart(incusMachine *infrastructurev1alpha1.IncusMachine) *bool {
+	if incusMachine.Spec.BootAutostart != nil {
+		return incusMachine.Spec.BootAutostart
+	}
+	autostart := true
+	return &autostart
+}
+
+// networkInterfaces returns the NICs of incusMachine for the Incus client.
+func networkInterfaces(incusMachine *infrastructurev1alpha1.IncusMachine) []incus.NetworkInterface {
+	var nics []incus.NetworkInterface
+	for _, nic := range incusMachine.Spec.NetworkInterfaces {
+		nics = append(nics, incus.NetworkInterface{
+			Name:        nic.Name,
+			Network:     nic.Network,
+			IPv4Address: nic.IPv4Address,
+			HWAddr:      nic.HWAddr,
+		})
+	}
+	return nics
+}
+
+// gpus returns the GPUs of incusMachine for the Incus client.
+func gpus(incusMachine *infrastructurev1alpha1.IncusMachine) []incus.GPUDevice {
+	var devices []incus.GPUDevice
+	for _, gpu := range incusMachine.Spec.GPUs {
+		devices = append(devices, incus.GPUDevice{Vendor: gpu.Vendor, Product: gpu.Product, PCI: gpu.PCI})
+	}
+	return devices
+}
+
+// imageExists reports whether the image of req exists on the Incus server.
+// Images pulled from an image server, or through a remote as in
+// "images:ubuntu/24.04", are not in its image store and are assumed to exist.
+func imageExists(ctx context.Context, incusClient incus.Client, req incus.CreateInstanceRequest) (bool, error) {
+	if req.ImageServer != "" || strings.Contains(req.Image, ":") {
+		return true, nil
+	}
+	exists, err := incusClient.ImageExists(ctx, req.Image)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up image %q: %w", req.Image, err)
+	}
+	return exists, nil
+}
+
+// checkProfiles fails if any of the named profiles does not exist on the
+// Incus server.
+func checkProfiles(ctx context.Context, incusClient incus.Client, profiles []string) error {
+	var missing []string
+	for _, profile := range profiles {
+		exists, err := incusClient.ProfileExists(ctx, profile)
+		if err != nil {
+			return fmt.Errorf("failed to look up profile %q: %w", profile, err)
+		}
+		if !exists {
+			missing = append(missing, profile)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("profiles not found on the Incus server: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// setInstanceStatus records the cluster member the instance runs on, picking
+// up any migration since the last reconcile, its addresses and its power
+// state. The machine is ready once the instance is running with an IPv4
+// address.
+func setInstanceStatus(incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) {
+	incusMachine.Status.Host = info.Location
+
+	var addresses []clusterv1.MachineAddress
+	hasIPv4 := false
+	for _, addr := range info.Addresses {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		if ip.To4() != nil {
+			hasIPv4 = true
+		}
+		addresses = append(addresses, clusterv1.MachineAddress{
+			Type:    clusterv1.MachineInternalIP,
+			Address: addr,
+		})
+	}
+	incusMachine.Status.Addresses = addresses
+	incusMachine.Status.PowerState = strings.ToLower(info.Status)
+	incusMachine.Status.Ready = info.Status == "Running" && hasIPv4
+	incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseProvisioning
+	if incusMachine.Status.Ready {
+		incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseRunning
+	}
+}
+
+// reconcilePowerState stops or starts the instance, described by info, as
+// the power-state annotation of incusMachine asks, and returns the instance
+// as it is afterwards. A machine whose instance is stopped on request stays
+// ready, in the Stopped phase, rather than waiting for the instance to run.
+func (r *IncusMachineReconciler) reconcilePowerState(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) (*incus.InstanceInfo, error) {
+	desired := incusMachine.Annotations[infrastructurev1alpha1.PowerStateAnnotation]
+	current := strings.ToLower(info.Status)
+	change := (desired == infrastructurev1alpha1.PowerStateStopped && current == infrastructurev1alpha1.PowerStateRunning) ||
+		(desired == infrastructurev1alpha1.PowerStateRunning && current == infrastructurev1alpha1.PowerStateStopped)
+	if change {
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if desired == infrastructurev1alpha1.PowerStateStopped {
+			if err := incusClient.StopInstance(opCtx, info.Name, retainStopTimeout); err != nil {
+				return nil, err
+			}
+			log.Info("Stopped instance", "instance", info.Name)
+			recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceStopped, "Stopped Incus instance %s", info.Name)
+		} else {
+			if err := incusClient.StartInstance(opCtx, info.Name); err != nil {
+				return nil, err
+			}
+			log.Info("Started instance", "instance", info.Name)
+			recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceStarted, "Started Incus instance %s", info.Name)
+		}
+		refreshed, err := incusClient.GetInstance(opCtx, info.Name)
+		if err != nil {
+			return nil, err
+		}
+		info = refreshed
+		setInstanceStatus(incusMachine, info)
+	}
+
+	if desired == infrastructurev1alpha1.PowerStateStopped && incusMachine.Status.PowerState == infrastructurev1alpha1.PowerStateStopped {
+		incusMachine.Status.Ready = true
+		incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseStopped
+	}
+	return info, nil
+}
+
+// reconcileBoot sets the InstanceBooted condition of incusMachine. Once the
+// instance has not become ready within the boot timeout of its creation, the
+// condition turns false with the tail of the console log, which is fetched
+// once. An instance that booted is not checked again, so a later restart is
+// not mistaken for a failed boot.
+func (r *IncusMachineReconciler) reconcileBoot(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) {
+	if incusMachine.Status.Ready {
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:   infrastructurev1alpha1.InstanceBootedCondition,
+			Status: metav1.ConditionTrue,
+			Reason: "InstanceReady",
+		})
+		return
+	}
+	if meta.FindStatusCondition(incusMachine.Status.Conditions, infrastructurev1alpha1.InstanceBootedCondition) != nil {
+		return
+	}
+	provisioned := meta.FindStatusCondition(incusMachine.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+	timeout := r.BootTimeout
+	if timeout <= 0 {
+		timeout = instanceBootTimeout
+	}
+	if provisioned == nil || time.Since(provisioned.LastTransitionTime.Time) < timeout {
+		return
+	}
+
+	message := fmt.Sprintf("instance %s did not become ready within %s", instanceName, timeout)
+	opCtx, cancel := operationContext(ctx)
+	defer cancel()
+	consoleLog, err := incusClient.GetConsoleLog(opCtx, instanceName)
+	if err != nil {
+		log.Error(err, "Failed to get console log", "instance", instanceName)
+		message += fmt.Sprintf("; the console log is unavailable: %v", err)
+	} else if tail := consoleLogTail(consoleLog); tail != "" {
+		message += "; last console output:\n" + tail
+	}
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:    infrastructurev1alpha1.InstanceBootedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "BootTimeout",
+		Message: message,
+	})
+	log.Info("Instance did not become ready in time", "instance", instanceName, "timeout", timeout)
+	recordEvent(r.Recorder, incusMachine, corev1.EventTypeWarning, "BootTimeout",
+		"Instance %s did not become ready within %s", instanceName, timeout)
+}
+
+// reconcileReadinessCommand gates the readiness of incusMachine on its
+// readiness command: once the instance is running with an address, the
+// command is run in it and the machine stays not ready until it exits with
+// code 0. The outcome is recorded in the ReadinessCommandSucceeded
+// condition; a command that succeeded is not run again. While the command
+// fails, it returns how long to wait before running it again.
+func (r *IncusMachineReconciler) reconcileReadinessCommand(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) time.Duration {
+	cmd := incusMachine.Spec.ReadinessCommand
+	if len(cmd) == 0 || !incusMachine.Status.Ready || incusMachine.Status.PowerState != infrastructurev1alpha1.PowerStateRunning {
+		return 0
+	}
+	if meta.IsStatusConditionTrue(incusMachine.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition) {
+		return 0
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, readinessCommandTimeout)
+	defer cancel()
+	stdout, stderr, exitCode, err := incusClient.Exec(execCtx, instanceName, cmd)
+	cond := metav1.Condition{
+		Type:   infrastructurev1alpha1.ReadinessCommandSucceededCondition,
+		Status: metav1.ConditionFalse,
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		cond.Reason = "CommandTimedOut"
+		cond.Message = fmt.Sprintf("readiness command did not finish within %s", readinessCommandTimeout)
+	case err != nil:
+		cond.Reason = "ExecFailed"
+		cond.Message = fmt.Sprintf("failed to run the readiness command: %v", err)
+	case exitCode != 0:
+		cond.Reason = "CommandFailed"
+		cond.Message = fmt.Sprintf("readiness command exited with code %d", exitCode)
+		if tail := consoleLogTail(stdout + stderr); tail != "" {
+			cond.Message += "; last output:\n" + tail
+		}
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "CommandSucceeded"
+	}
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, cond)
+	if cond.Status == metav1.ConditionTrue {
+		log.Info("Readiness command succeeded", "instance", instanceName)
+		return 0
+	}
+	log.Info("Readiness command did not succeed", "instance", instanceName, "reason", cond.Reason, "exitCode", exitCode, "error", err)
+	incusMachine.Status.Ready = false
+	incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseProvisioning
+	failing := meta.FindStatusCondition(incusMachine.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition)
+	return min(max(time.Since(failing.LastTransitionTime.Time), readinessCommandRequeueAfter), readinessCommandRequeueMaxDelay)
+}
+
+// consoleLogTail returns the last consoleLogTailLines lines of a console
+// log, cut to at most consoleLogTailMaxBytes.
+func consoleLogTail(consoleLog string) string {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(consoleLog, "\r", ""), "\n \t"), "\n")
+	if len(lines) > consoleLogTailLines {
+		lines = lines[len(lines)-consoleLogTailLines:]
+	}
+	tail := strings.Join(lines, "\n")
+	if len(tail) > consoleLogTailMaxBytes {
+		tail = strings.ToValidUTF8(tail[len(tail)-consoleLogTailMaxBytes:], "")
+	}
+	return tail
+}
+
+// machineResources returns the vCPU count and memory of the instance,
+// falling back to the defaults for unset fields.
+func machineResources(incusMachine *infrastructurev1alpha1.IncusMachine) (cpus, memoryMiB int) {
+	cpus = incusMachine.Spec.CPUs
+	if cpus < 1 {
+		cpus = infrastructurev1alpha1.DefaultCPUs
+	}
+	memoryMiB = incusMachine.Spec.MemoryMiB
+	if memoryMiB < 1 {
+		memoryMiB = infrastructurev1alpha1.DefaultMemoryMiB
+	}
+	return cpus, memoryMiB
+}
+
+// reconcilePlacement moves an existing instance, described by info, to the
+// Incus cluster member of the owning Machine's failure domain when the
+// failure domain has changed since the instance was created. The move is
+// reported in the InstancePlaced condition while it runs.
+func (r *IncusMachineReconciler) reconcilePlacement(ctx context.Context, log logr.Logger, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) error {
+	target, err := r.failureDomainTarget(ctx, incusCluster, incusMachine)
+	if err != nil {
+		return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstancePlacedCondition, "FailureDomainNotFound", err)
+	}
+	if target == "" {
+		meta.RemoveStatusCondition(&incusMachine.Status.Conditions, infrastructurev1alpha1.InstancePlacedCondition)
+		return nil
+	}
+
+	if info.Location != target {
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.InstancePlacedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Moving",
+			Message: fmt.Sprintf("Moving instance %s from %s to %s", info.Name, info.Location, target),
+		})
+		if err := r.Status().Update(ctx, incusMachine); err != nil {
+			return err
+		}
+
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.MoveInstance(opCtx, info.Name, target); err != nil {
+			err = fmt.Errorf("failed to move instance %s to %s: %w", info.Name, target, err)
+			return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstancePlacedCondition, "MoveFailed", err)
+		}
+		log.Info("Moved Incus instance", "instance", info.Name, "from", info.Location, "to", target)
+		recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceMoved, "Moved Incus instance %s from %s to %s", info.Name, info.Location, target)
+		info.Location = target
+		incusMachine.Status.Host = target
+	}
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.InstancePlacedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "InFailureDomain",
+	})
+	return nil
+}
+
+// resourcesNeedReconcile reports whether the resources of an existing
+// instance have to be compared with the spec: the spec has changed since it
+// was last reconciled, or the last change has not been applied yet.
+func resourcesNeedReconcile(incusMachine *infrastructurev1alpha1.IncusMachine) bool {
+	if incusMachine.Status.ObservedGeneration != incusMachine.Generation {
+		return true
+	}
+	return !meta.IsStatusConditionTrue(incusMachine.Status.Conditions, infrastructurev1alpha1.InstanceResourcesSyncedCondition)
+}
+
+// restartRequired reports whether a change to incusMachine is held back until
+// its instance is stopped.
+func restartRequired(incusMachine *infrastructurev1alpha1.IncusMachine) bool {
+	for _, condType := range []string{
+		infrastructurev1alpha1.InstanceDevicesSyncedCondition,
+		infrastructurev1alpha1.InstanceResourcesSyncedCondition,
+	} {
+		if cond := meta.FindStatusCondition(incusMachine.Status.Conditions, condType); cond != nil && cond.Reason == "RestartRequired" {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileResources applies changes to cpus, cpuPinning and memoryMiB to
+// an existing instance described by info. Incus resizes running instances in
+// place, except that the memory of a running virtual machine cannot be
+// reduced; that change is held back and reported in the
+// InstanceResourcesSynced condition until the instance is stopped.
+func (r *IncusMachineReconciler) reconcileResources(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) error {
+	instanceName := info.Name
+	cpus, wantMemoryMiB := machineResources(incusMachine)
+	cpuLimit := incus.CPULimit(cpus, incusMachine.Spec.CPUPinning)
+	memoryMiB := wantMemoryMiB
+	cpuDrift := info.CPULimit != cpuLimit
+	memoryDrift := info.MemoryLimit != fmt.Sprintf("%dMiB", memoryMiB)
+
+	restartRequired := false
+	if memoryDrift && info.Type != "container" && info.Status == "Running" {
+		if current, ok := parseMiB(info.MemoryLimit); ok && memoryMiB < current {
+			restartRequired = true
+			memoryMiB = current
+			memoryDrift = false
+		}
+	}
+
+	if cpuDrift || memoryDrift {
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.UpdateInstanceResources(opCtx, instanceName, cpuLimit, memoryMiB); err != nil {
+			err = fmt.Errorf("failed to resize instance %s: %w", instanceName, err)
+			return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceResourcesSyncedCondition, "ResizeFailed", err)
+		}
+		log.Info("Resized Incus instance", "instance", instanceName, "cpus", cpuLimit, "memoryMiB", memoryMiB)
+	}
+
+	if restartRequired {
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.InstanceResourcesSyncedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RestartRequired",
+			Message: fmt.Sprintf("Reducing the memory of a running virtual machine requires a restart; %dMiB is applied once the instance is stopped", wantMemoryMiB),
+		})
+		return nil
+	}
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.InstanceResourcesSyncedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "ResourcesSynced",
+	})
+	return nil
+}
+
+// parseMiB parses a limits.memory value written by the provider, such as
+// "2048MiB".
+func parseMiB(value string) (int, bool) {
+	digits, ok := strings.CutSuffix(value, "MiB")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+// adoptInstance takes over an instance owned by another IncusMachine, or by
+// none if previousOwner is empty, as allowed by AdoptExistingAnnotation, by
+// replacing its ownership labels with those of incusMachine.
+func (r *IncusMachineReconciler) adoptInstance(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName, previousOwner string) error {
+	labels := ownershipConfig(incusMachine)
+	if _, ok := labels[clusterConfigKey]; !ok {
+		// A Cluster label of the previous owner would keep the instance
+		// from being deleted with this machine.
+		labels[clusterConfigKey] = ""
+	}
+	opCtx, cancel := operationContext(ctx)
+	defer cancel()
+	if err := incusClient.SetInstanceLabels(opCtx, instanceName, labels); err != nil {
+		return fmt.Errorf("failed to set ownership labels on instance %s: %w", instanceName, err)
+	}
+	log.Info("Adopted existing Incus instance", "instance", instanceName, "previousOwner", previousOwner)
+	if previousOwner == "" {
+		recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceAdopted, "Adopted unlabeled Incus instance %s", instanceName)
+		return nil
+	}
+	recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceAdopted, "Adopted Incus instance %s from IncusMachine UID %s", instanceName, previousOwner)
+	return nil
+}
+
+// ownershipConfig returns the instance config keys that tie an instance to
+// the IncusMachine that owns it.
+func ownershipConfig(incusMachine *infrastructurev1alpha1.IncusMachine) map[string]string {
+	config := map[string]string{
+		createIntentConfigKey: string(incusMachine.UID),
+		machineUIDConfigKey:   string(incusMachine.UID),
+	}
+	if clusterName := incusMachine.Labels[clusterv1.ClusterNameLabel]; clusterName != "" {
+		config[clusterConfigKey] = clusterName
+	}
+	return config
+}
+
+// instanceRecorded reports whether incusMachine has provisioned the instance
+// instanceName: the name is recorded in its status and the instance was
+// seen carrying its ownership labels. An instance created by the machine
+// carries them from the start, so one without them is otherwise foreign.
+func instanceRecorded(incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) bool {
+	return incusMachine.Status.InstanceID == instanceName &&
+		meta.IsStatusConditionTrue(incusMachine.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+}
+
+// instanceOwner returns the UID of the IncusMachine recorded in the instance
+// config, or "" if the instance carries no ownership labels. Instances
+// created before the machine UID label was introduced are identified by
+// their create intent.
+func instanceOwner(config map[string]string) string {
+	if uid := config[machineUIDConfigKey]; uid != "" {
+		return uid
+	}
+	return config[createIntentConfigKey]
+}
+
+// ownedBy reports whether the instance config ties the instance to
+// incusMachine and, when recorded, to its Cluster.
+func ownedBy(config map[string]string, incusMachine *infrastructurev1alpha1.IncusMachine) bool {
+	if instanceOwner(config) != string(incusMachine.UID) {
+		return false
+	}
+	clusterName := config[clusterConfigKey]
+	return clusterName == "" || clusterName == incusMachine.Labels[clusterv1.ClusterNameLabel]
+}
+
+// instanceProfiles returns the profiles of the IncusMachine, or the default
+// profiles of incusCluster if the machine does not list any.
+func instanceProfiles(incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) []string {
+	if len(incusMachine.Spec.Profiles) == 0 && incusCluster != nil {
+		return incusCluster.Spec.DefaultProfiles
+	}
+	return incusMachine.Spec.Profiles
+}
+
+// instanceConfig returns the config keys to create the instance with: the
+// default config of incusCluster, overlaid with the config of the machine's
+// ConfigMap, cm, then with the user-provided config and labels of the machine
+// and finally with the ownership labels.
+func instanceConfig(incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine, cm *machineConfigMap) map[string]string {
+	config := map[string]string{}
+	if incusCluster != nil {
+		for k, v := range incusCluster.Spec.DefaultConfig {
+			config[k] = v
+		}
+	}
+	if cm != nil {
+		for k, v := range cm.Config {
+			config[k] = v
+		}
+	}
+	for k, v := range incusMachine.Spec.Config {
+		config[k] = v
+	}
+	for k, v := range incusMachine.Spec.Labels {
+		config["user."+k] = v
+	}
+	for k, v := range ownershipConfig(incusMachine) {
+		config[k] = v
+	}
+	return config
+}
+
+// reconcileWarnings records unresolved Incus warnings for the instance in the
+// ConfigurationWarning condition. Warnings only fail the reconcile when
+// WarningsAsErrors is set.
+func (r *IncusMachineReconciler) reconcileWarnings(ctx context.Context, log logr.Logger, incusClient incus.Client, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) error {
+	warnings, err := incusClient.InstanceWarnings(ctx, instanceName)
+	if err != nil {
+		// Warnings are informational; never block provisioning on reading them.
+		log.Error(err, "Failed to read Incus warnings", "instance", instanceName)
+		return nil
+	}
+
+	if len(warnings) == 0 {
+		meta.RemoveStatusCondition(&incusMachine.Status.Conditions, infrastructurev1alpha1.ConfigurationWarningCondition)
+		return nil
+	}
+
+	message := strings.Join(warnings, "; ")
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:    infrastructurev1alpha1.ConfigurationWarningCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "IncusWarnings",
+		Message: message,
+	})
+	if r.WarningsAsErrors {
+		return fmt.Errorf("incus reported warnings for instance %s: %s", instanceName, message)
+	}
+	return nil
+}
+
+func (r *IncusMachineReconciler) reconcileDelete(ctx context.Context, log logr.Logger, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) (ctrl.Result, error) {
 	if !controllerutil.ContainsFinalizer(incusMachine, incusMachineFinalizer) {
 		return ctrl.Result{}, nil
 	}
 
+	if incusMachine.Status.Phase != infrastructurev1alpha1.IncusMachinePhaseDeleting {
+		incusMachine.Status.Phase = infrastructurev1alpha1.IncusMachinePhaseDeleting
+		if err := r.Status().Update(ctx, incusMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	instanceName := incusMachine.Status.InstanceID
 	if instanceName == "" {
-		instanceName = incusMachine.Name
+		instanceName = incus.SanitizeInstanceName(incusMachine.Name)
 	}
 
 	if instanceName != "" {
-		exists, err := r.IncusClient.InstanceExists(ctx, instanceName)
+		config, err := incusClient.GetInstanceConfig(ctx, instanceName)
 		if err != nil {
 			log.Error(err, "Failed to check if instance exists during deletion")
 			return ctrl.Result{}, err
 		}
 
-		if exists {
-			if err := r.IncusClient.DeleteInstance(ctx, instanceName); err != nil {
+		switch {
+		case config == nil:
+			// The instance is already gone.
+		case !ownedBy(config, incusMachine):
+			// An instance of the same name that this machine did not
+			// create is never deleted.
+			log.Info("Leaving Incus instance that does not belong to this machine", "instance", instanceName)
+		case incusMachine.Annotations[infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation] != "":
+			if err := r.retainInstance(ctx, log, incusClient, incusCluster, incusMachine, instanceName); err != nil {
+				log.Error(err, "Failed to snapshot Incus instance before deletion")
+				err = fmt.Errorf("failed to snapshot instance %s before deletion: %w", instanceName, err)
+				return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDeletedCondition, "SnapshotFailed", err)
+			}
+		default:
+			// Clear delete protection first; it only guards against removal
+			// outside of the controller.
+			updateCtx, cancelUpdate := operationContext(ctx)
+			defer cancelUpdate()
+			// An instance removed since it was looked up shows up as
+			// ErrInstanceNotFound and counts as deleted.
+			err := incusClient.UpdateInstanceConfig(updateCtx, instanceName, map[string]string{deleteProtectionConfigKey: ""})
+			if err != nil && !errors.Is(err, incus.ErrInstanceNotFound) {
+				log.Error(err, "Failed to clear delete protection on Incus instance")
+				err = fmt.Errorf("failed to clear delete protection on instance %s: %w", instanceName, err)
+				return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDeletedCondition, "InstanceDeleteFailed", err)
+			}
+			deleteCtx, cancelDelete := timeoutContext(ctx, r.DeleteTimeout)
+			defer cancelDelete()
+			err = incusClient.DeleteInstance(deleteCtx, instanceName)
+			switch {
+			case errors.Is(err, incus.ErrInstanceNotFound):
+				log.Info("Incus instance is already gone", "instance", instanceName)
+			case errors.Is(err, incus.ErrTransient), errors.Is(err, context.DeadlineExceeded):
+				err = fmt.Errorf("failed to delete instance %s: %w", instanceName, err)
+				return r.retryTransient(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDeletedCondition, err), nil
+			case err != nil:
 				log.Error(err, "Failed to delete Incus instance")
-				return ctrl.Result{}, err
+				err = fmt.Errorf("failed to delete instance %s: %w", instanceName, err)
+				return ctrl.Result{}, r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDeletedCondition, "InstanceDeleteFailed", err)
+			default:
+				log.Info("Deleted Incus VM instance", "instance", instanceName)
+				recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceDeleted, "Deleted Incus instance %s", instanceName)
+
+				removed, err := waitForInstanceRemoval(ctx, incusClient, instanceName)
+				if err != nil {
+					log.Error(err, "Failed to confirm the Incus instance is gone")
+					return ctrl.Result{}, err
+				}
+				if !removed {
+					log.Info("Waiting for Incus to finish removing the instance", "instance", instanceName)
+					meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+						Type:    infrastructurev1alpha1.InstanceDeletedCondition,
+						Status:  metav1.ConditionFalse,
+						Reason:  waitingForInstanceRemoval,
+						Message: fmt.Sprintf("Instance %s is still listed by Incus after it was deleted", instanceName),
+					})
+					if err := r.Status().Update(ctx, incusMachine); err != nil {
+						return ctrl.Result{}, err
+					}
+					return ctrl.Result{RequeueAfter: instanceRemovalRequeueAfter}, nil
+				}
 			}
-			log.Info("Deleted Incus VM instance", "instance", instanceName)
 		}
 	}
 
@@ -157,10 +1629,126 @@ func (r *IncusMachineReconciler) reconcileDelete(ctx context.Context, log logr.L
 	return ctrl.Result{}, nil
 }
 
+// waitForInstanceRemoval polls until Incus no longer lists the instance. It
+// returns false if the instance is still there after instanceRemovalPolls
+// checks.
+func waitForInstanceRemoval(ctx context.Context, incusClient incus.Client, instanceName string) (bool, error) {
+	for i := 0; i < instanceRemovalPolls; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(instanceRemovalPollInterval):
+			}
+		}
+		exists, err := incusClient.InstanceExists(ctx, instanceName)
+		if err != nil {
+			return false, fmt.Errorf("failed to check whether instance %s exists: %w", instanceName, err)
+		}
+		if !exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// retainInstance snapshots the instance of a machine being deleted and keeps
+// the instance, since deleting it would remove the snapshot too. The
+// instance is stopped and its ownership and cluster labels are dropped, so
+// that neither this machine nor the orphan collector touches it again. Its
+// NICs on the cluster network are detached, as Incus could not delete the
+// network with the cluster otherwise. Each step can be retried.
+func (r *IncusMachineReconciler) retainInstance(ctx context.Context, log logr.Logger, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine, instanceName string) error {
+	var stateful bool
+	switch mode := incusMachine.Annotations[infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation]; mode {
+	case infrastructurev1alpha1.SnapshotStateless:
+	case infrastructurev1alpha1.SnapshotStateful:
+		stateful = true
+	default:
+		return fmt.Errorf("annotation %s has unknown value %q, want %q or %q", infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation,
+			mode, infrastructurev1alpha1.SnapshotStateless, infrastructurev1alpha1.SnapshotStateful)
+	}
+
+	snapshots, err := incusClient.ListSnapshots(ctx, instanceName)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(snapshots, preDeleteSnapshotName) {
+		snapshotCtx, cancelSnapshot := operationContext(ctx)
+		defer cancelSnapshot()
+		if err := incusClient.CreateSnapshot(snapshotCtx, instanceName, preDeleteSnapshotName, stateful); err != nil {
+			return err
+		}
+		log.Info("Created pre-delete snapshot", "instance", instanceName, "snapshot", preDeleteSnapshotName, "stateful", stateful)
+		recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventSnapshotCreated, "Created snapshot %s of Incus instance %s", preDeleteSnapshotName, instanceName)
+	}
+
+	stopCtx, cancelStop := operationContext(ctx)
+	defer cancelStop()
+	if err := incusClient.StopInstance(stopCtx, instanceName, retainStopTimeout); err != nil {
+		return err
+	}
+
+	if incusCluster != nil && incusCluster.Spec.Network != "" {
+		info, err := incusClient.GetInstance(ctx, instanceName)
+		if err != nil {
+			return err
+		}
+		detach := map[string]map[string]string{}
+		for name, device := range info.Devices {
+			if device["type"] == "nic" && device["network"] == incusCluster.Spec.Network {
+				detach[name] = nil
+			}
+		}
+		if len(detach) > 0 {
+			detachCtx, cancelDetach := operationContext(ctx)
+			defer cancelDetach()
+			if err := incusClient.UpdateInstanceDevices(detachCtx, instanceName, detach); err != nil {
+				return err
+			}
+			log.Info("Detached kept Incus instance from the cluster network", "instance", instanceName, "network", incusCluster.Spec.Network)
+		}
+	}
+
+	updateCtx, cancelUpdate := operationContext(ctx)
+	defer cancelUpdate()
+	if err := incusClient.UpdateInstanceConfig(updateCtx, instanceName, map[string]string{
+		createIntentConfigKey:   "",
+		machineUIDConfigKey:     "",
+		clusterConfigKey:        "",
+		managedDevicesConfigKey: "",
+		retainedFromConfigKey:   client.ObjectKeyFromObject(incusMachine).String(),
+	}); err != nil {
+		return err
+	}
+	log.Info("Kept stopped Incus instance for its pre-delete snapshot", "instance", instanceName)
+	recordEvent(r.Recorder, incusMachine, corev1.EventTypeNormal, eventInstanceKept, "Kept stopped Incus instance %s with snapshot %s", instanceName, preDeleteSnapshotName)
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *IncusMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	clusterToIncusMachines, err := util.ClusterToTypedObjectsMapper(mgr.GetClient(), &infrastructurev1alpha1.IncusMachineList{}, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	if err := registerManagedInstancesCollector(mgr.GetClient()); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1alpha1.IncusMachine{}).
+		Watches(
+			&clusterv1.Machine{},
+			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrastructurev1alpha1.GroupVersion.WithKind("IncusMachine"))),
+		).
+		// Machines waiting for their cluster resume when it is unpaused or
+		// its infrastructure becomes ready.
+		Watches(
+			&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(clusterToIncusMachines),
+			builder.WithPredicates(predicates.ClusterPausedTransitionsOrInfrastructureReady(mgr.GetScheme(), mgr.GetLogger())),
+		).
 		Named("incusmachine").
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
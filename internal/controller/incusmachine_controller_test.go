@@ -18,16 +18,30 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus/incustest"
 )
 
 var _ = Describe("IncusMachine Controller", func() {
@@ -81,4 +95,3412 @@ var _ = Describe("IncusMachine Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When a previous create was not recorded in status", func() {
+		const resourceName = "test-create-intent"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should adopt the instance carrying the create intent instead of creating a duplicate", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Instances["previous-attempt"] = map[string]string{
+				createIntentConfigKey: string(resource.UID),
+			}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal("previous-attempt"))
+		})
+
+		It("should adopt its instance after the status update following the create failed", func() {
+			fakeClient := incustest.NewFakeClient()
+			watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: k8sClient.Scheme()})
+			Expect(err).NotTo(HaveOccurred())
+			// Only the status update recording the instance name before the
+			// create goes through.
+			statusUpdates := 0
+			failingClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+				SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+					statusUpdates++
+					if statusUpdates == 1 {
+						return c.SubResource(subResource).Update(ctx, obj, opts...)
+					}
+					return fmt.Errorf("connection refused")
+				},
+			})
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      failingClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			By("creating the instance without recording it in status")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)).To(BeNil())
+
+			By("reconciling again after a controller restart")
+			// The recorded name is enough to find the instance again.
+			delete(fakeClient.Instances[resourceName], createIntentConfigKey)
+			controllerReconciler.Client = k8sClient
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CallCount("FindInstanceByConfig")).To(Equal(1))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(resource.Status.Ready).To(BeTrue())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should stamp the create intent on newly created instances", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Name).To(Equal(resourceName))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue(createIntentConfigKey, string(resource.UID)))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue(machineUIDConfigKey, string(resource.UID)))
+		})
+
+		It("should record the cluster name in the ownership labels", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:    "machine-uid",
+					Labels: map[string]string{clusterv1.ClusterNameLabel: "test-cluster"},
+				},
+			}
+			config := ownershipConfig(resource)
+			Expect(config).To(HaveKeyWithValue(clusterConfigKey, "test-cluster"))
+			Expect(ownedBy(config, resource)).To(BeTrue())
+
+			config[clusterConfigKey] = "another-cluster"
+			Expect(ownedBy(config, resource)).To(BeFalse())
+		})
+	})
+
+	Context("When an instance of the same name belongs to another machine", func() {
+		const resourceName = "test-foreign-instance"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+			fakeClient = incustest.NewFakeClient()
+			fakeClient.Instances[resourceName] = map[string]string{
+				machineUIDConfigKey: "another-machine",
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should not adopt the instance", func() {
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(nameConflictRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(machineUIDConfigKey, "another-machine"))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(BeEmpty())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InstanceNameConflict"))
+			Expect(cond.Message).To(ContainSubstring("belongs to another IncusMachine"))
+		})
+
+		It("should not delete the instance when the machine is deleted", func() {
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.DeleteCalls).To(BeEmpty())
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When the machine is annotated to adopt an existing instance", func() {
+		const resourceName = "test-adopt-existing"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Annotations = map[string]string{infrastructurev1alpha1.AdoptExistingAnnotation: "true"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should take over the instance and delete it with the machine", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Instances[resourceName] = map[string]string{
+				machineUIDConfigKey:   "previous-installation",
+				createIntentConfigKey: "previous-installation",
+				clusterConfigKey:      "old-cluster",
+				"limits.cpu":          "4",
+			}
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+				Recorder:    recorder,
+			}
+
+			By("adopting the instance instead of creating one")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(machineUIDConfigKey, string(resource.UID)))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(createIntentConfigKey, string(resource.UID)))
+			Expect(fakeClient.Instances[resourceName]).NotTo(HaveKey(clusterConfigKey))
+			// The adopted instance is brought in line with the machine's spec.
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "2"))
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(recorder.Events).To(Receive(ContainSubstring(eventInstanceAdopted)))
+
+			By("managing it like any other instance")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).NotTo(Receive(ContainSubstring(eventInstanceAdopted)))
+
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.DeleteCalls).To(Equal([]string{resourceName}))
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should take over an instance without ownership labels", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Instances[resourceName] = map[string]string{"limits.cpu": "2"}
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+				Recorder:    recorder,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(machineUIDConfigKey, string(resource.UID)))
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(recorder.Events).To(Receive(ContainSubstring("unlabeled")))
+		})
+	})
+
+	Context("When a concurrent create takes the instance name", func() {
+		const resourceName = "test-create-conflict"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should adopt the instance when it carries the machine's labels", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			fakeClient.RacedConfig = map[string]string{machineUIDConfigKey: string(resource.UID)}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeTrue())
+
+			fakeClient.RacedConfig = nil
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)).To(BeTrue())
+		})
+
+		It("should report a name conflict when the instance belongs to someone else", func() {
+			fakeClient.RacedConfig = map[string]string{}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(nameConflictRequeueAfter))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(BeEmpty())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InstanceNameConflict"))
+			Expect(fakeClient.Instances[resourceName]).To(BeEmpty())
+
+			By("keeping the conflict on the next reconcile")
+			fakeClient.RacedConfig = nil
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(nameConflictRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.Instances[resourceName]).NotTo(HaveKey(machineUIDConfigKey))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond = meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond.Reason).To(Equal("InstanceNameConflict"))
+
+			By("leaving the instance in place when the machine is deleted")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.DeleteCalls).To(BeEmpty())
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When the owning Machine has bootstrap data", func() {
+		const resourceName = "test-bootstrap-data"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass the bootstrap data to the instance as cloud-init user-data", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].UserData).To(HavePrefix("#cloud-config\n"))
+		})
+
+		It("should set the providerID on the IncusMachine and the kubelet", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].UserData).To(ContainSubstring("--provider-id=incus://" + resourceName))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Spec.ProviderID).To(HaveValue(Equal("incus://" + resourceName)))
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.BootstrapDataReadyCondition)).To(BeTrue())
+		})
+
+		It("should only become ready once the instance runs with an IPv4 address", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Running", Addresses: []string{"fd42::2"}}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeTrue())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Ready).To(BeFalse())
+
+			By("reporting an IPv4 address")
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Running", Addresses: []string{"10.0.0.7", "fd42::2"}}
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeFalse())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(resource.Status.Addresses).To(Equal([]clusterv1.MachineAddress{
+				{Type: clusterv1.MachineInternalIP, Address: "10.0.0.7"},
+				{Type: clusterv1.MachineInternalIP, Address: "fd42::2"},
+			}))
+		})
+
+		It("should report a failed create in the InstanceProvisioned condition", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("image not found"))
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("image not found")))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InstanceCreateFailed"))
+			Expect(cond.Message).To(ContainSubstring("image not found"))
+			Expect(resource.Status.Ready).To(BeFalse())
+		})
+
+		It("should wait without creating the instance while the bootstrap data is not ready", func() {
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machine)).To(Succeed())
+			machine.Spec.Bootstrap.DataSecretName = nil
+			machine.Spec.Bootstrap.ConfigRef = &corev1.ObjectReference{
+				APIVersion: "bootstrap.cluster.x-k8s.io/v1beta1",
+				Kind:       "KubeadmConfig",
+				Name:       resourceName,
+			}
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(bootstrapDataRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.BootstrapDataReadyCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("WaitingForBootstrapData"))
+
+			By("backing off further while the data is still missing")
+			cond.LastTransitionTime = metav1.NewTime(time.Now().Add(-30 * time.Second))
+			meta.SetStatusCondition(&resource.Status.Conditions, *cond)
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", 30*time.Second))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", bootstrapDataRequeueMaxDelay))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			By("creating the instance once the data secret appears")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machine)).To(Succeed())
+			dataSecretName := resourceName + "-bootstrap"
+			machine.Spec.Bootstrap.DataSecretName = &dataSecretName
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.BootstrapDataReadyCondition)).To(BeTrue())
+		})
+	})
+
+	Context("When the machine sets custom config and devices", func() {
+		const resourceName = "test-custom-config"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Config: map[string]string{
+					"security.nesting":    "true",
+					createIntentConfigKey: "not-mine",
+				},
+				Devices: map[string]map[string]string{
+					"data": {"type": "disk", "pool": "default", "source": "data-vol"},
+				},
+				GPUs: []infrastructurev1alpha1.GPUDevice{{Vendor: "10de", PCI: "0000:01:00.0"}},
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass them to the instance while keeping the ownership labels", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			req := fakeClient.CreateCalls[0]
+			Expect(req.Config).To(HaveKeyWithValue("security.nesting", "true"))
+			Expect(req.Config).To(HaveKeyWithValue(createIntentConfigKey, string(resource.UID)))
+			Expect(req.Devices).To(HaveKeyWithValue("data", HaveKeyWithValue("source", "data-vol")))
+			Expect(req.GPUs).To(Equal([]incus.GPUDevice{{Vendor: "10de", PCI: "0000:01:00.0"}}))
+		})
+	})
+
+	Context("When the machine sets a description and labels", func() {
+		const resourceName = "test-description-labels"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Description: "worker of the test cluster",
+				Labels: map[string]string{
+					"team": "platform",
+					// Rejected by the webhook; the controller must still
+					// keep its own ownership label.
+					"capi.create-intent": "not-mine",
+				},
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass them to the instance without overriding the ownership labels", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			req := fakeClient.CreateCalls[0]
+			Expect(req.Description).To(Equal("worker of the test cluster"))
+			Expect(req.Config).To(HaveKeyWithValue("user.team", "platform"))
+			Expect(req.Config).To(HaveKeyWithValue(createIntentConfigKey, string(resource.UID)))
+		})
+	})
+
+	Context("When the machine configures network interfaces", func() {
+		const resourceName = "test-network-interfaces"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				NetworkInterfaces: []infrastructurev1alpha1.NetworkInterface{
+					{Name: "eth0", IPv4Address: "10.0.0.10", HWAddr: "00:16:3e:12:34:56"},
+				},
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass the static address and MAC to the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].NetworkInterfaces).To(Equal([]incus.NetworkInterface{
+				{Name: "eth0", IPv4Address: "10.0.0.10", HWAddr: "00:16:3e:12:34:56"},
+			}))
+		})
+	})
+
+	Context("When the machine name is not a valid instance name", func() {
+		const resourceName = "test.dotted-name"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should create the instance under a sanitized name and record it in status", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			instanceName := fakeClient.CreateCalls[0].Name
+			Expect(instanceName).To(Equal(incus.SanitizeInstanceName(resourceName)))
+			Expect(instanceName).To(HavePrefix("test-dotted-name-"))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(instanceName))
+
+			By("Deleting the instance under the same name")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.DeleteCalls).To(Equal([]string{instanceName}))
+		})
+	})
+
+	Context("When the machine sets security options", func() {
+		const resourceName = "test-security-options"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				InstanceType: "container",
+				Nesting:      true,
+				Privileged:   true,
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass them to the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			req := fakeClient.CreateCalls[0]
+			Expect(req.Nesting).To(BeTrue())
+			Expect(req.Privileged).To(BeTrue())
+			Expect(req.SecureBoot).To(BeNil())
+		})
+	})
+
+	Context("When the machine sets its boot order", func() {
+		const resourceName = "test-boot-order"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				BootPriority: 50,
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should autostart the instance with its priority", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].BootAutostart).To(HaveValue(BeTrue()))
+			Expect(fakeClient.CreateCalls[0].BootPriority).To(Equal(50))
+		})
+	})
+
+	Context("When the machine sets cloud-init vendor-data and network-config", func() {
+		const resourceName = "test-cloud-init-data"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				VendorData:    "#cloud-config\npackages: [chrony]\n",
+				NetworkConfig: "version: 2\nethernets:\n  enp5s0:\n    dhcp4: true\n",
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should pass them to the instance next to the user-data", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			req := fakeClient.CreateCalls[0]
+			Expect(req.UserData).To(HavePrefix("#cloud-config\n"))
+			Expect(req.VendorData).To(Equal("#cloud-config\npackages: [chrony]\n"))
+			Expect(req.NetworkConfig).To(ContainSubstring("enp5s0"))
+		})
+	})
+
+	Context("When the machine lists profiles", func() {
+		const resourceName = "test-profiles"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Profiles: []string{"default", "storage-fast"},
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should apply the profiles to the instance", func() {
+			fakeClient.Profiles["storage-fast"] = true
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Profiles).To(Equal([]string{"default", "storage-fast"}))
+		})
+
+		It("should report a missing profile instead of creating the instance", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("storage-fast")))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("ProfileNotFound"))
+			Expect(cond.Message).To(ContainSubstring("storage-fast"))
+		})
+	})
+
+	Context("When the machine uses an image of the Incus server", func() {
+		const resourceName = "test-local-image"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Image: "ubuntu/24.04",
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should create the instance from an existing image", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CallCount("ImageExists")).To(Equal(1))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+		})
+
+		It("should report a missing image instead of creating the instance", func() {
+			fakeClient.MissingImages["ubuntu/24.04"] = true
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(imageNotFoundRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("ImageNotFound"))
+			Expect(cond.Message).To(ContainSubstring("ubuntu/24.04"))
+
+			By("creating the instance once the image is imported")
+			delete(fakeClient.MissingImages, "ubuntu/24.04")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+		})
+
+		It("should not look up images pulled through a remote", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Image = "images:ubuntu/24.04"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CallCount("ImageExists")).To(BeZero())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+		})
+	})
+
+	Context("When the machine references a ConfigMap", func() {
+		const resourceName = "test-config-map"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		configMapKey := types.NamespacedName{Name: resourceName + "-config", Namespace: "default"}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		createConfigMap := func(data map[string]string) {
+			Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: configMapKey.Name, Namespace: configMapKey.Namespace},
+				Data:       data,
+			})).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				ConfigMapRef: &corev1.LocalObjectReference{Name: configMapKey.Name},
+				Config:       map[string]string{"limits.cpu.allowance": "80%"},
+				Devices: map[string]map[string]string{
+					"shared": {"type": "disk", "source": "/srv/machine", "path": "/srv"},
+				},
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+			configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapKey.Name, Namespace: configMapKey.Namespace}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, configMap))).To(Succeed())
+		})
+
+		It("should merge the ConfigMap under the inline spec fields", func() {
+			createConfigMap(map[string]string{
+				MachineConfigMapConfigKey: "security.csm: \"true\"\nlimits.cpu.allowance: 50%\n",
+				MachineConfigMapDevicesKey: "shared:\n  type: disk\n  source: /srv/shared\n  path: /srv\n" +
+					"scratch:\n  type: disk\n  pool: default\n  source: scratch\n  path: /scratch\n",
+				MachineConfigMapVendorDataKey: "#cloud-config\npackages: [htop]\n",
+			})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			req := fakeClient.CreateCalls[0]
+			Expect(req.Config).To(HaveKeyWithValue("security.csm", "true"))
+			Expect(req.Config).To(HaveKeyWithValue("limits.cpu.allowance", "80%"))
+			Expect(req.Devices).To(HaveKeyWithValue("shared", HaveKeyWithValue("source", "/srv/machine")))
+			Expect(req.Devices).To(HaveKeyWithValue("scratch", HaveKeyWithValue("source", "scratch")))
+			Expect(req.VendorData).To(Equal("#cloud-config\npackages: [htop]\n"))
+		})
+
+		It("should wait for a missing ConfigMap", func() {
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(configMapRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("ConfigMapNotFound"))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseProvisioning))
+
+			By("creating the instance once the ConfigMap exists")
+			createConfigMap(map[string]string{MachineConfigMapConfigKey: "security.csm: \"true\"\n"})
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue("security.csm", "true"))
+		})
+
+		It("should reject resource limits in the ConfigMap", func() {
+			createConfigMap(map[string]string{MachineConfigMapConfigKey: "limits.memory: 64GiB\n"})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("limits.memory")))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("InvalidConfigMap"))
+		})
+
+		It("should reject user-data in the ConfigMap", func() {
+			createConfigMap(map[string]string{MachineConfigMapUserDataKey: "#cloud-config\npackages: [htop]\n"})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring(MachineConfigMapVendorDataKey)))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("InvalidConfigMap"))
+			Expect(cond.Message).To(ContainSubstring(MachineConfigMapUserDataKey))
+		})
+	})
+
+	Context("When the machine selects a storage pool", func() {
+		const resourceName = "test-storage-pool"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				StoragePool: "fast",
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should create the root disk in the requested pool", func() {
+			fakeClient.Pools["fast"] = true
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].StoragePool).To(Equal("fast"))
+		})
+
+		It("should report a missing pool instead of creating the instance", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring(`storage pool "fast"`)))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("StoragePoolNotFound"))
+		})
+
+		It("should fall back to the pool of the IncusCluster", func() {
+			fakeClient.Pools["cluster-pool"] = true
+			incusCluster := &infrastructurev1alpha1.IncusCluster{
+				Spec: infrastructurev1alpha1.IncusClusterSpec{StoragePool: "cluster-pool"},
+			}
+
+			pool, err := storagePool(ctx, fakeClient, incusCluster, &infrastructurev1alpha1.IncusMachine{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool).To(Equal("cluster-pool"))
+
+			pool, err = storagePool(ctx, fakeClient, nil, &infrastructurev1alpha1.IncusMachine{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool).To(BeEmpty())
+		})
+
+		It("should pass data disks on and check their pools", func() {
+			fakeClient.Pools["fast"] = true
+			incusMachine := &infrastructurev1alpha1.IncusMachine{
+				Spec: infrastructurev1alpha1.IncusMachineSpec{DataDisks: []infrastructurev1alpha1.DataDisk{
+					{SizeGiB: 50, Pool: "fast"},
+					{SizeGiB: 200, Pool: "default", Path: "/var/lib/data"},
+				}},
+			}
+
+			disks, err := dataDisks(ctx, fakeClient, incusMachine)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disks).To(Equal([]incus.DataDisk{
+				{SizeGiB: 50, Pool: "fast"},
+				{SizeGiB: 200, Pool: "default", Path: "/var/lib/data"},
+			}))
+
+			incusMachine.Spec.DataDisks[1].Pool = "missing"
+			_, err = dataDisks(ctx, fakeClient, incusMachine)
+			Expect(err).To(MatchError(ContainSubstring(`storage pool "missing"`)))
+		})
+	})
+
+	Context("When the machine's resources change", func() {
+		const resourceName = "test-resize"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				CPUs:      2,
+				MemoryMiB: 4096,
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			By("creating the instance")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.memory", "4096MiB"))
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		// resize sets the vCPU count and memory of the IncusMachine and
+		// reconciles it.
+		resize := func(cpus, memoryMiB int) *infrastructurev1alpha1.IncusMachine {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.CPUs = cpus
+			resource.Spec.MemoryMiB = memoryMiB
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			return resource
+		}
+
+		It("should apply a memory bump to the live instance", func() {
+			resource := resize(4, 8192)
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "4"))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.memory", "8192MiB"))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceResourcesSyncedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should pin the instance to a CPU set", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.CPUs = 0
+			resource.Spec.CPUPinning = "0-3"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "0-3"))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.memory", "4096MiB"))
+		})
+
+		It("should hold back a memory reduction of a running virtual machine", func() {
+			resource := resize(4, 2048)
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "4"))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.memory", "4096MiB"))
+
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceResourcesSyncedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("RestartRequired"))
+		})
+
+		It("should record the generation of the spec it reconciled", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+			generation := resource.Generation
+
+			resource = resize(4, 8192)
+			Expect(resource.Generation).To(BeNumerically(">", generation))
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+		})
+
+		It("should not compare resources again for an unchanged, synced spec", func() {
+			resize(4, 8192)
+			fakeClient.Instances[resourceName]["limits.cpu"] = "8"
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "8"))
+		})
+
+		It("should apply a memory reduction once the instance is stopped", func() {
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Stopped"}
+			resize(2, 2048)
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.memory", "2048MiB"))
+		})
+	})
+
+	Context("When provisioning metrics are recorded", func() {
+		const resourceName = "test-metrics"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		// createAttempts returns the number of creates observed by
+		// incus_instance_create_duration_seconds.
+		createAttempts := func() uint64 {
+			m := &dto.Metric{}
+			Expect(instanceCreateDuration.Write(m)).To(Succeed())
+			return m.GetHistogram().GetSampleCount()
+		}
+		createErrors := func(reason string) float64 {
+			return testutil.ToFloat64(instanceCreateErrors.WithLabelValues(reason))
+		}
+
+		It("should count a successful create without an error", func() {
+			attempts, failed := createAttempts(), createErrors(createErrorFailed)
+			managed := testutil.ToFloat64(&managedInstancesCollector{client: k8sClient})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(createAttempts()).To(Equal(attempts + 1))
+			Expect(createErrors(createErrorFailed)).To(Equal(failed))
+			Expect(testutil.ToFloat64(&managedInstancesCollector{client: k8sClient})).To(Equal(managed + 1))
+		})
+
+		It("should count a failed create by reason", func() {
+			attempts, failed := createAttempts(), createErrors(createErrorFailed)
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("disk full"))
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(createAttempts()).To(Equal(attempts + 1))
+			Expect(createErrors(createErrorFailed)).To(Equal(failed + 1))
+
+			invalid := createErrors(createErrorInvalidRequest)
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("%w: no such profile", incus.ErrInvalidRequest))
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(createErrors(createErrorInvalidRequest)).To(Equal(invalid + 1))
+			Expect(createErrors(createErrorFailed)).To(Equal(failed + 1))
+		})
+	})
+
+	Context("When the machine's profiles or devices change", func() {
+		const resourceName = "test-device-drift"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		extraDisk := map[string]string{"type": "disk", "source": "/srv", "path": "/srv"}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Devices: map[string]map[string]string{"extra": extraDisk},
+			})
+			fakeClient = incustest.NewFakeClient()
+			fakeClient.Profiles["gpu"] = true
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			By("creating the instance")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(managedDevicesConfigKey, "extra"))
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		// update changes the spec of the IncusMachine and reconciles it.
+		update := func(mutate func(spec *infrastructurev1alpha1.IncusMachineSpec)) *infrastructurev1alpha1.IncusMachine {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			mutate(&resource.Spec)
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			return resource
+		}
+
+		devicesSynced := func(resource *infrastructurev1alpha1.IncusMachine) *metav1.Condition {
+			return meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceDevicesSyncedCondition)
+		}
+
+		It("should apply a profile list change to a container", func() {
+			fakeClient.InstanceTypes[resourceName] = "container"
+			resource := update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Profiles = []string{"default", "gpu"}
+			})
+			Expect(fakeClient.InstanceProfiles[resourceName]).To(Equal([]string{"default", "gpu"}))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			cond := devicesSynced(resource)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should hold back a profile list change of a running virtual machine until it is stopped", func() {
+			resource := update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Profiles = []string{"default", "gpu"}
+			})
+			Expect(fakeClient.CallCount("UpdateInstanceProfiles")).To(BeZero())
+			cond := devicesSynced(resource)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("RestartRequired"))
+			Expect(cond.Message).To(ContainSubstring("profiles"))
+
+			By("stopping the instance")
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Stopped"}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.InstanceProfiles[resourceName]).To(Equal([]string{"default", "gpu"}))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(devicesSynced(resource).Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should hot-plug a NIC into a running virtual machine", func() {
+			nic := map[string]string{"type": "nic", "network": "storage"}
+			resource := update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Devices["storage"] = nic
+			})
+			Expect(fakeClient.InstanceDevices[resourceName]).To(HaveKeyWithValue("storage", nic))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(managedDevicesConfigKey, "extra,storage"))
+			Expect(devicesSynced(resource).Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should hold back changing a device of a running virtual machine", func() {
+			resource := update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Devices["extra"] = map[string]string{"type": "disk", "source": "/data", "path": "/srv"}
+			})
+			Expect(fakeClient.InstanceDevices[resourceName]).To(HaveKeyWithValue("extra", extraDisk))
+			cond := devicesSynced(resource)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("RestartRequired"))
+			Expect(cond.Message).To(ContainSubstring("device extra"))
+		})
+
+		It("should check back on a held-back device change and apply it once the instance is stopped", func() {
+			changed := map[string]string{"type": "disk", "source": "/data", "path": "/srv"}
+			update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Devices["extra"] = changed
+			})
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(restartRequiredRequeueAfter))
+			Expect(fakeClient.InstanceDevices[resourceName]).To(HaveKeyWithValue("extra", extraDisk))
+
+			By("stopping the instance outside the provider")
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Stopped"}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.InstanceDevices[resourceName]).To(HaveKeyWithValue("extra", changed))
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(devicesSynced(resource).Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should remove a device dropped from the spec", func() {
+			resource := update(func(spec *infrastructurev1alpha1.IncusMachineSpec) {
+				spec.Devices = nil
+			})
+			Expect(fakeClient.InstanceDevices[resourceName]).NotTo(HaveKey("extra"))
+			Expect(fakeClient.Instances[resourceName]).NotTo(HaveKey(managedDevicesConfigKey))
+			Expect(devicesSynced(resource).Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should revert a device removed outside the provider", func() {
+			delete(fakeClient.InstanceDevices[resourceName], "extra")
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.InstanceDevices[resourceName]).To(HaveKeyWithValue("extra", extraDisk))
+		})
+
+		It("should report a failed device update", func() {
+			fakeClient.FailOn("UpdateInstanceDevices", fmt.Errorf("device busy"))
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Devices["storage"] = map[string]string{"type": "nic", "network": "storage"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("device busy")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := devicesSynced(resource)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("DeviceUpdateFailed"))
+		})
+	})
+
+	Context("When validating the IncusMachine spec", func() {
+		It("should reject an unknown instance type", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-instance-type", Namespace: "default"},
+				Spec: infrastructurev1alpha1.IncusMachineSpec{
+					InstanceType: "microvm",
+				},
+			}
+			err := k8sClient.Create(context.Background(), resource)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+		})
+
+		It("should reject config overriding the CPU or memory limits", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config-limits", Namespace: "default"},
+				Spec: infrastructurev1alpha1.IncusMachineSpec{
+					Config: map[string]string{"limits.memory": "4GiB"},
+				},
+			}
+			err := k8sClient.Create(context.Background(), resource)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("memoryMiB")))
+		})
+	})
+
+	Context("When the machine belongs to an IncusCluster", func() {
+		const resourceName = "test-cluster-network"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Labels = map[string]string{clusterv1.ClusterNameLabel: resourceName}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+			removeCluster(ctx, typeNamespacedName)
+		})
+
+		It("should attach the instance to the cluster network", func() {
+			createCluster(ctx, typeNamespacedName, "capi-net")
+			fakeClient.Networks["capi-net"] = map[string]string{}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Network).To(Equal("capi-net"))
+		})
+
+		It("should create the instance in the cluster's Incus project", func() {
+			createCluster(ctx, typeNamespacedName, "")
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Spec.Project = "tenant-a"
+			Expect(k8sClient.Update(ctx, incusCluster)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+			Expect(fakeClient.Projects).To(HaveKey("tenant-a"))
+			Expect(fakeClient.Projects["tenant-a"].Instances).To(HaveKey(resourceName))
+		})
+
+		It("should let the cluster network go once a snapshot-retained instance is kept", func() {
+			createCluster(ctx, typeNamespacedName, "capi-net")
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Finalizers = []string{incusClusterFinalizer}
+			Expect(k8sClient.Update(ctx, incusCluster)).To(Succeed())
+			fakeClient.Networks["capi-net"] = map[string]string{createIntentConfigKey: string(incusCluster.UID)}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.NetworkInstances(ctx, "capi-net")).To(Equal([]string{resourceName}))
+
+			By("deleting the machine with a snapshot")
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			patch := client.MergeFrom(resource.DeepCopy())
+			resource.Annotations = map[string]string{
+				infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation: infrastructurev1alpha1.SnapshotStateless,
+			}
+			Expect(k8sClient.Patch(ctx, resource, patch)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+			Expect(fakeClient.InstanceDevices[resourceName]).NotTo(HaveKey("eth0"))
+			Expect(fakeClient.Instances[resourceName]).NotTo(HaveKey(clusterConfigKey))
+			Expect(fakeClient.Instances[resourceName]).NotTo(HaveKey(managedDevicesConfigKey))
+
+			By("deleting the IncusCluster and its network")
+			Expect(k8sClient.Delete(ctx, incusCluster)).To(Succeed())
+			clusterReconciler := &IncusClusterReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+			result, err := clusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(fakeClient.Networks).NotTo(HaveKey("capi-net"))
+			err = k8sClient.Get(ctx, typeNamespacedName, incusCluster)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should delete the instance from its project after the IncusCluster is gone", func() {
+			createCluster(ctx, typeNamespacedName, "")
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Spec.Project = "tenant-a"
+			Expect(k8sClient.Update(ctx, incusCluster)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Project).To(Equal("tenant-a"))
+
+			By("deleting the IncusCluster before the IncusMachine")
+			Expect(k8sClient.Delete(ctx, incusCluster)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Projects["tenant-a"].Instances).NotTo(HaveKey(resourceName))
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should use the default profile network when none is set", func() {
+			createCluster(ctx, typeNamespacedName, "")
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Network).To(BeEmpty())
+		})
+
+		It("should fail without creating the instance when the network does not exist", func() {
+			createCluster(ctx, typeNamespacedName, "missing-net")
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("missing-net")))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("NetworkNotFound"))
+		})
+
+		// setClusterDefaults sets the default profiles and config of the
+		// IncusCluster.
+		setClusterDefaults := func(profiles []string, config map[string]string) {
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Spec.DefaultProfiles = profiles
+			incusCluster.Spec.DefaultConfig = config
+			Expect(k8sClient.Update(ctx, incusCluster)).To(Succeed())
+		}
+
+		It("should apply the cluster's default profiles and config", func() {
+			createCluster(ctx, typeNamespacedName, "")
+			setClusterDefaults([]string{"default", "capi"}, map[string]string{"security.csm": "true"})
+			fakeClient.Profiles["capi"] = true
+			fakeClient.Profiles["default"] = true
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Profiles).To(Equal([]string{"default", "capi"}))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue("security.csm", "true"))
+		})
+
+		It("should let the machine's profiles and config override the cluster defaults", func() {
+			createCluster(ctx, typeNamespacedName, "")
+			setClusterDefaults([]string{"capi"}, map[string]string{
+				"security.csm":         "true",
+				"limits.cpu.allowance": "50%",
+			})
+			fakeClient.Profiles["machine"] = true
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Profiles = []string{"machine"}
+			resource.Spec.Config = map[string]string{"security.csm": "false"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Profiles).To(Equal([]string{"machine"}))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue("security.csm", "false"))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue("limits.cpu.allowance", "50%"))
+		})
+
+		It("should not let the cluster's default config replace the ownership labels", func() {
+			createCluster(ctx, typeNamespacedName, "")
+			setClusterDefaults(nil, map[string]string{clusterConfigKey: "someone-else"})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Config).To(HaveKeyWithValue(clusterConfigKey, resourceName))
+		})
+	})
+
+	Context("When the machine's cluster is paused or not ready", func() {
+		const resourceName = "test-cluster-paused"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+			createCluster(ctx, typeNamespacedName, "")
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Labels = map[string]string{clusterv1.ClusterNameLabel: resourceName}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+			removeCluster(ctx, typeNamespacedName)
+		})
+
+		reconcileOnce := func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("should not create the instance while the Cluster is paused", func() {
+			cluster := &clusterv1.Cluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cluster)).To(Succeed())
+			cluster.Spec.Paused = true
+			Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+
+			reconcileOnce()
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			By("resuming once the Cluster is unpaused")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cluster)).To(Succeed())
+			cluster.Spec.Paused = false
+			Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+			reconcileOnce()
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+		})
+
+		It("should not create the instance while the machine is annotated as paused", func() {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Annotations = map[string]string{clusterv1.PausedAnnotation: ""}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			reconcileOnce()
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+		})
+
+		It("should not delete the instance while the Cluster is paused", func() {
+			reconcileOnce()
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+
+			cluster := &clusterv1.Cluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cluster)).To(Succeed())
+			cluster.Spec.Paused = true
+			Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			reconcileOnce()
+			Expect(fakeClient.DeleteCalls).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+		})
+
+		It("should wait for the IncusCluster to be ready", func() {
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Status.Ready = false
+			Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+
+			reconcileOnce()
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Status.Ready = true
+			Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+			reconcileOnce()
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+		})
+	})
+
+	Context("When control plane machines have no failure domain", func() {
+		const clusterName = "test-spread"
+
+		ctx := context.Background()
+
+		clusterKey := types.NamespacedName{Name: clusterName, Namespace: "default"}
+		keys := []types.NamespacedName{
+			{Name: "test-spread-cp-0", Namespace: "default"},
+			{Name: "test-spread-cp-1", Namespace: "default"},
+			{Name: "test-spread-cp-2", Namespace: "default"},
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+		var created []types.NamespacedName
+
+		// createMachine creates an IncusMachine of the Cluster, owned by a
+		// control plane Machine if controlPlane is set.
+		createMachine := func(key types.NamespacedName, controlPlane bool) {
+			createMachineWithFinalizer(ctx, key, infrastructurev1alpha1.IncusMachineSpec{})
+			created = append(created, key)
+
+			labels := map[string]string{clusterv1.ClusterNameLabel: clusterName}
+			if controlPlane {
+				labels[clusterv1.MachineControlPlaneLabel] = ""
+			}
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, key, machine)).To(Succeed())
+			machine.Labels = labels
+			machine.Spec.ClusterName = clusterName
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+			resource.Labels = labels
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+		}
+
+		reconcileMachine := func(key types.NamespacedName) *infrastructurev1alpha1.IncusMachine {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+			return resource
+		}
+
+		BeforeEach(func() {
+			createCluster(ctx, clusterKey, "")
+			fakeClient = incustest.NewFakeClient()
+			fakeClient.Members = []incus.ClusterMember{
+				{Name: "member-1", Status: "Online", Load: 0.5},
+				{Name: "member-2", Status: "Online", Load: 2},
+				{Name: "member-3", Status: "Online", Load: 1},
+				{Name: "member-4", Status: "Offline"},
+			}
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			for _, key := range created {
+				removeMachine(ctx, key)
+			}
+			created = nil
+			removeCluster(ctx, clusterKey)
+		})
+
+		It("should spread three control plane machines across three members", func() {
+			for _, key := range keys {
+				createMachine(key, true)
+			}
+
+			var targets []string
+			for _, key := range keys {
+				resource := reconcileMachine(key)
+				targets = append(targets, resource.Status.TargetMember)
+			}
+			Expect(targets).To(Equal([]string{"member-1", "member-3", "member-2"}))
+			Expect(fakeClient.CreateCalls).To(HaveLen(3))
+			for i, req := range fakeClient.CreateCalls {
+				Expect(req.Target).To(Equal(targets[i]))
+			}
+		})
+
+		It("should share members once every member runs a control plane instance", func() {
+			fakeClient.Members = fakeClient.Members[:2]
+			for _, key := range keys {
+				createMachine(key, true)
+			}
+
+			var targets []string
+			for _, key := range keys {
+				targets = append(targets, reconcileMachine(key).Status.TargetMember)
+			}
+			Expect(targets).To(Equal([]string{"member-1", "member-2", "member-1"}))
+		})
+
+		It("should keep the recorded member when the create is retried", func() {
+			createMachine(keys[0], true)
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("disk full"))
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: keys[0]})
+			Expect(err).To(HaveOccurred())
+
+			fakeClient.FailOn("CreateInstance", nil)
+			fakeClient.Members[0].Load = 8
+			Expect(reconcileMachine(keys[0]).Status.TargetMember).To(Equal("member-1"))
+			Expect(fakeClient.CreateCalls).To(HaveLen(2))
+			Expect(fakeClient.CreateCalls[1].Target).To(Equal("member-1"))
+		})
+
+		It("should leave the placement of worker machines to Incus", func() {
+			createMachine(keys[0], false)
+
+			resource := reconcileMachine(keys[0])
+			Expect(resource.Status.TargetMember).To(BeEmpty())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Target).To(BeEmpty())
+		})
+	})
+
+	Context("When the Machine requests a failure domain", func() {
+		const resourceName = "test-failure-domain"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Labels = map[string]string{clusterv1.ClusterNameLabel: resourceName}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machine)).To(Succeed())
+			failureDomain := "member-2"
+			machine.Spec.FailureDomain = &failureDomain
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+			createCluster(ctx, typeNamespacedName, "")
+
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+			removeCluster(ctx, typeNamespacedName)
+		})
+
+		It("should create the instance on the matching cluster member", func() {
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Status.FailureDomains = clusterv1.FailureDomains{
+				"member-1": {ControlPlane: true},
+				"member-2": {ControlPlane: true},
+			}
+			Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Target).To(Equal("member-2"))
+		})
+
+		It("should create the instance without a target in the standalone failure domain", func() {
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machine)).To(Succeed())
+			failureDomain := infrastructurev1alpha1.StandaloneFailureDomain
+			machine.Spec.FailureDomain = &failureDomain
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Status.FailureDomains = clusterv1.FailureDomains{
+				infrastructurev1alpha1.StandaloneFailureDomain: {ControlPlane: true},
+			}
+			Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.CreateCalls[0].Target).To(BeEmpty())
+
+			By("leaving the instance in place")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Moves).To(BeEmpty())
+		})
+
+		It("should fail without creating the instance when the failure domain does not exist", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("member-2")))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("FailureDomainNotFound"))
+		})
+
+		It("should move the instance when the failure domain changes", func() {
+			incusCluster := &infrastructurev1alpha1.IncusCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, incusCluster)).To(Succeed())
+			incusCluster.Status.FailureDomains = clusterv1.FailureDomains{
+				"member-1": {ControlPlane: true},
+				"member-2": {ControlPlane: true},
+			}
+			Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+
+			By("creating the instance on member-2")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			fakeClient.Location = "member-2"
+
+			By("changing the failure domain to member-1")
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machine)).To(Succeed())
+			failureDomain := "member-1"
+			machine.Spec.FailureDomain = &failureDomain
+			Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Moves).To(Equal([]string{resourceName + ":member-1"}))
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Host).To(Equal("member-1"))
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.InstancePlacedCondition)).To(BeTrue())
+
+			By("leaving the instance in place once it is there")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Moves).To(HaveLen(1))
+		})
+	})
+
+	Context("When Incus reports warnings for the instance", func() {
+		const resourceName = "test-warnings"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should record the warnings in the ConfigurationWarning condition without failing", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Warnings[resourceName] = []string{"Config key \"limits.cpu\" is deprecated"}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ConfigurationWarningCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("deprecated"))
+		})
+
+		It("should fail the reconcile when warnings are treated as errors", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Warnings[resourceName] = []string{"Config key \"limits.cpu\" is deprecated"}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:           k8sClient,
+				Scheme:           k8sClient.Scheme(),
+				IncusClient:      fakeClient,
+				WarningsAsErrors: true,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("deprecated")))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.ConfigurationWarningCondition)).To(BeTrue())
+		})
+	})
+
+	Context("When the machine is annotated for a dry run", func() {
+		const resourceName = "test-dry-run"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				Image:  "images:debian/12/cloud",
+				Config: map[string]string{"user.role": "worker"},
+			})
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Annotations = map[string]string{infrastructurev1alpha1.DryRunAnnotation: "true"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should report the planned instance without creating it", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+			Expect(fakeClient.PlanCalls).To(HaveLen(1))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(BeEmpty())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.DryRunCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal("InstancePlanned"))
+			Expect(cond.Message).To(ContainSubstring(`"user.role":"worker"`))
+			Expect(cond.Message).To(ContainSubstring("images:debian/12/cloud"))
+			Expect(cond.Message).To(ContainSubstring(`"cloud-init.user-data":"REDACTED"`))
+			Expect(cond.Message).NotTo(ContainSubstring("provider-id"))
+		})
+
+		It("should create the instance once the annotation is removed", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Annotations = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.DryRunCondition)).To(BeNil())
+		})
+	})
+
+	Context("When many machines are reconciled concurrently", func() {
+		const machines = 20
+
+		ctx := context.Background()
+
+		var keys []types.NamespacedName
+
+		BeforeEach(func() {
+			keys = nil
+			for i := range machines {
+				key := types.NamespacedName{Name: fmt.Sprintf("test-concurrent-%d", i), Namespace: "default"}
+				createMachineWithFinalizer(ctx, key, infrastructurev1alpha1.IncusMachineSpec{})
+				keys = append(keys, key)
+			}
+		})
+
+		AfterEach(func() {
+			for _, key := range keys {
+				removeMachine(ctx, key)
+			}
+		})
+
+		It("should create every instance exactly once", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			// controller-runtime never reconciles the same object twice at
+			// once, so each machine gets one worker.
+			var wg sync.WaitGroup
+			for _, key := range keys {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+					Expect(err).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			Expect(fakeClient.Instances).To(HaveLen(machines))
+			Expect(fakeClient.CreateCalls).To(HaveLen(machines))
+		})
+	})
+
+	Context("When recording events", func() {
+		const resourceName = "test-events"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var recorder *record.FakeRecorder
+		var controllerReconciler *IncusMachineReconciler
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+			fakeClient = incustest.NewFakeClient()
+			recorder = record.NewFakeRecorder(10)
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+				Recorder:    recorder,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should record the creation and deletion of the instance", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Normal InstanceCreated Created Incus instance " + resourceName)))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Normal InstanceDeleted Deleted Incus instance " + resourceName)))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("should record a warning when Incus fails to create the instance", func() {
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("image not found"))
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(recorder.Events).To(Receive(And(
+				HavePrefix("Warning InstanceCreateFailed "),
+				ContainSubstring("image not found"),
+			)))
+		})
+	})
+
+	Context("When deleting a delete-protected machine", func() {
+		const resourceName = "test-delete-protection"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				DeleteProtection: true,
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should clear the protection and then delete the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			By("creating the protected instance")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(deleteProtectionConfigKey, "true"))
+
+			By("deleting the IncusMachine")
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.DeleteCalls).To(ConsistOf(resourceName))
+			Expect(fakeClient.Instances).NotTo(HaveKey(resourceName))
+
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should wait until Incus no longer lists the deleted instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("reporting the instance for one more poll")
+			fakeClient.Lingering[resourceName] = 1
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Lingering[resourceName]).To(BeZero())
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should keep the finalizer while Incus still lists the deleted instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			fakeClient.Lingering[resourceName] = instanceRemovalPolls
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(instanceRemovalRequeueAfter))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).To(ContainElement(incusMachineFinalizer))
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceDeletedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(waitingForInstanceRemoval))
+
+			By("finishing once the instance is gone")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should report a failed delete in the InstanceDeleted condition", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			fakeClient.FailOn("DeleteInstance", fmt.Errorf("instance is busy"))
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(ContainSubstring("instance is busy")))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceDeletedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InstanceDeleteFailed"))
+			Expect(cond.Message).To(ContainSubstring("instance is busy"))
+		})
+
+		It("should report an unreachable Incus server in the InstanceDeleted condition", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			fakeClient.FailOn("DeleteInstance", fmt.Errorf("%w: connection refused", incus.ErrConnection))
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).To(MatchError(incus.ErrConnection))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceDeletedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(incusUnreachableReason))
+		})
+
+		It("should finish deletion if the instance disappears while it is deleted", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			fakeClient.FailOn("DeleteInstance", fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, resourceName))
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When tracking the phase of a machine", func() {
+		const resourceName = "test-phase"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		phase := func() infrastructurev1alpha1.IncusMachinePhase {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			return resource.Status.Phase
+		}
+
+		It("should move through Provisioning, Running and Deleting", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Starting"}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+			reconcileOnce := func() error {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				return err
+			}
+
+			By("creating the instance")
+			Expect(reconcileOnce()).To(Succeed())
+			Expect(phase()).To(Equal(infrastructurev1alpha1.IncusMachinePhaseProvisioning))
+
+			By("seeing the instance come up")
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Running", Addresses: []string{"10.0.0.2"}}
+			Expect(reconcileOnce()).To(Succeed())
+			Expect(phase()).To(Equal(infrastructurev1alpha1.IncusMachinePhaseRunning))
+
+			By("deleting the machine while the instance cannot be removed")
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			fakeClient.FailOn("DeleteInstance", fmt.Errorf("instance is busy"))
+			Expect(reconcileOnce()).NotTo(Succeed())
+			Expect(phase()).To(Equal(infrastructurev1alpha1.IncusMachinePhaseDeleting))
+
+			fakeClient.FailOn("DeleteInstance", nil)
+			Expect(reconcileOnce()).To(Succeed())
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should report Failed when the instance cannot be created", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("image not found"))
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(HaveOccurred())
+			Expect(phase()).To(Equal(infrastructurev1alpha1.IncusMachinePhaseFailed))
+		})
+	})
+
+	Context("When Incus fails a request", func() {
+		const resourceName = "test-transient"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		getMachine := func() *infrastructurev1alpha1.IncusMachine {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			return resource
+		}
+
+		It("should retry a transient create failure with a growing delay", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("%w: daemon is busy", incus.ErrTransient))
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(transientRetryMinDelay))
+
+			resource := getMachine()
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(incusBusyReason))
+			Expect(resource.Status.Phase).NotTo(Equal(infrastructurev1alpha1.IncusMachinePhaseFailed))
+
+			By("backing off further while the failure persists")
+			cond.LastTransitionTime = metav1.NewTime(time.Now().Add(-40 * time.Second))
+			meta.SetStatusCondition(&resource.Status.Conditions, *cond)
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", 40*time.Second))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", transientRetryMaxDelay))
+
+			By("creating the instance once Incus recovers")
+			fakeClient.FailOn("CreateInstance", nil)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CallCount("CreateInstance")).To(Equal(3))
+			Expect(fakeClient.HasInstance(resourceName)).To(BeTrue())
+			Expect(getMachine().Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseRunning))
+		})
+
+		It("should retry a create that exceeds the create timeout", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.CreateDelay = time.Minute
+			controllerReconciler := &IncusMachineReconciler{
+				Client:        k8sClient,
+				Scheme:        k8sClient.Scheme(),
+				IncusClient:   fakeClient,
+				CreateTimeout: 50 * time.Millisecond,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(transientRetryMinDelay))
+			Expect(fakeClient.Instances).NotTo(HaveKey(resourceName))
+
+			resource := getMachine()
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(incusBusyReason))
+			Expect(cond.Message).To(ContainSubstring(context.DeadlineExceeded.Error()))
+			Expect(resource.Status.Phase).NotTo(Equal(infrastructurev1alpha1.IncusMachinePhaseFailed))
+
+			By("creating the instance once Incus is fast enough")
+			fakeClient.CreateDelay = 0
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+		})
+
+		It("should fail without retrying when Incus rejects the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.FailOn("CreateInstance", fmt.Errorf("%w: image not found", incus.ErrInvalidRequest))
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+
+			resource := getMachine()
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InvalidInstanceRequest"))
+			Expect(cond.Message).To(ContainSubstring("image not found"))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseFailed))
+		})
+
+		It("should retry a transient delete failure", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Delete(ctx, getMachine())).To(Succeed())
+
+			fakeClient.FailOn("DeleteInstance", fmt.Errorf("%w: daemon is busy", incus.ErrTransient))
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(transientRetryMinDelay))
+			cond := meta.FindStatusCondition(getMachine().Status.Conditions, infrastructurev1alpha1.InstanceDeletedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(incusBusyReason))
+
+			fakeClient.FailOn("DeleteInstance", nil)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, &infrastructurev1alpha1.IncusMachine{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When deleting a machine annotated to snapshot before deletion", func() {
+		const resourceName = "test-snapshot-before-delete"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				DeleteProtection: true,
+			})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should snapshot and keep the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Instances).To(HaveKey(resourceName))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			patch := client.MergeFrom(resource.DeepCopy())
+			resource.Annotations = map[string]string{
+				infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation: infrastructurev1alpha1.SnapshotStateful,
+			}
+			Expect(k8sClient.Patch(ctx, resource, patch)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler.Recorder = recorder
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("listing the snapshot")
+			snapshots, err := fakeClient.ListSnapshots(ctx, resourceName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(Equal([]string{preDeleteSnapshotName}))
+			Expect(fakeClient.Snapshots[resourceName][0].Stateful).To(BeTrue())
+
+			By("keeping the stopped instance, released from the machine")
+			Expect(fakeClient.DeleteCalls).To(BeEmpty())
+			Expect(fakeClient.Stopped).To(HaveKey(resourceName))
+			config := fakeClient.Instances[resourceName]
+			Expect(instanceOwner(config)).To(BeEmpty())
+			Expect(config).To(HaveKeyWithValue(retainedFromConfigKey, typeNamespacedName.String()))
+			Expect(config).To(HaveKeyWithValue(deleteProtectionConfigKey, "true"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(eventSnapshotCreated)))
+
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When an existing instance lost its ownership labels", func() {
+		const resourceName = "test-ownership-repair"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should restore the labels of the instance it recorded without recreating it", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(Equal(resourceName))
+
+			By("stripping the labels outside the provider")
+			delete(fakeClient.Instances[resourceName], createIntentConfigKey)
+			delete(fakeClient.Instances[resourceName], machineUIDConfigKey)
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.CreateCalls).To(HaveLen(1))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(createIntentConfigKey, string(resource.UID)))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue(machineUIDConfigKey, string(resource.UID)))
+			Expect(fakeClient.Instances[resourceName]).To(HaveKeyWithValue("limits.cpu", "2"))
+		})
+
+		It("should not take over an unlabeled instance it did not create", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Instances[resourceName] = map[string]string{"limits.cpu": "4"}
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(nameConflictRequeueAfter))
+			Expect(fakeClient.CreateCalls).To(BeEmpty())
+			Expect(fakeClient.Instances[resourceName]).To(Equal(map[string]string{"limits.cpu": "4"}))
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.InstanceID).To(BeEmpty())
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("InstanceNameConflict"))
+		})
+	})
+
+	Context("When the power-state annotation changes", func() {
+		const resourceName = "test-power-state"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		setPowerState := func(state string) {
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			if resource.Annotations == nil {
+				resource.Annotations = map[string]string{}
+			}
+			resource.Annotations[infrastructurev1alpha1.PowerStateAnnotation] = state
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+		}
+
+		It("should stop and then start the instance", func() {
+			fakeClient := incustest.NewFakeClient()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+			reconcileMachine := func() *infrastructurev1alpha1.IncusMachine {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Requeue).To(BeFalse())
+				resource := &infrastructurev1alpha1.IncusMachine{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				return resource
+			}
+
+			resource := reconcileMachine()
+			Expect(resource.Status.PowerState).To(Equal(infrastructurev1alpha1.PowerStateRunning))
+
+			By("stopping the instance without failing the machine")
+			setPowerState(infrastructurev1alpha1.PowerStateStopped)
+			resource = reconcileMachine()
+			Expect(fakeClient.Stopped).To(HaveKey(resourceName))
+			Expect(fakeClient.HasInstance(resourceName)).To(BeTrue())
+			Expect(resource.Status.PowerState).To(Equal(infrastructurev1alpha1.PowerStateStopped))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseStopped))
+			Expect(resource.Status.Ready).To(BeTrue())
+
+			By("leaving a stopped instance alone")
+			reconcileMachine()
+			Expect(fakeClient.CallCount("StopInstance")).To(Equal(1))
+
+			By("starting the instance again")
+			setPowerState(infrastructurev1alpha1.PowerStateRunning)
+			resource = reconcileMachine()
+			Expect(fakeClient.CallCount("StartInstance")).To(Equal(1))
+			Expect(fakeClient.Stopped).NotTo(HaveKey(resourceName))
+			Expect(resource.Status.PowerState).To(Equal(infrastructurev1alpha1.PowerStateRunning))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseRunning))
+			Expect(resource.Status.Ready).To(BeTrue())
+		})
+	})
+
+	Context("When the instance does not become ready", func() {
+		const resourceName = "test-boot-timeout"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should surface the tail of the console log", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Running"}
+			var consoleLog strings.Builder
+			for i := range 30 {
+				fmt.Fprintf(&consoleLog, "boot line %d\r\n", i)
+			}
+			consoleLog.WriteString("Kernel panic - not syncing: VFS: Unable to mount root fs\n")
+			fakeClient.ConsoleLogs[resourceName] = consoleLog.String()
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+				BootTimeout: time.Nanosecond,
+			}
+			reconcileMachine := func() *infrastructurev1alpha1.IncusMachine {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				resource := &infrastructurev1alpha1.IncusMachine{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				return resource
+			}
+
+			resource := reconcileMachine()
+			Expect(meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceBootedCondition)).To(BeNil())
+
+			resource = reconcileMachine()
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.InstanceBootedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("BootTimeout"))
+			Expect(cond.Message).To(HaveSuffix("boot line 29\nKernel panic - not syncing: VFS: Unable to mount root fs"))
+			Expect(cond.Message).To(ContainSubstring("boot line 11\n"))
+			Expect(cond.Message).NotTo(ContainSubstring("boot line 10\n"))
+
+			By("fetching the console log only once")
+			reconcileMachine()
+			Expect(fakeClient.CallCount("GetConsoleLog")).To(Equal(1))
+
+			By("marking the instance booted once it is ready")
+			delete(fakeClient.States, resourceName)
+			resource = reconcileMachine()
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, infrastructurev1alpha1.InstanceBootedCondition)).To(BeTrue())
+		})
+	})
+
+	Context("When the machine has a readiness command", func() {
+		const resourceName = "test-readiness-command"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var fakeClient *incustest.FakeClient
+		var controllerReconciler *IncusMachineReconciler
+
+		reconcileMachine := func() (reconcile.Result, *infrastructurev1alpha1.IncusMachine) {
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			return result, resource
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{
+				ReadinessCommand: []string{"cloud-init", "status", "--wait"},
+			})
+			fakeClient = incustest.NewFakeClient()
+			controllerReconciler = &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should only become ready once the command succeeds", func() {
+			fakeClient.ExecResults[resourceName] = incustest.ExecResult{
+				Stdout:   "status: running\n",
+				Stderr:   "cloud-init is still running\n",
+				ExitCode: 1,
+			}
+
+			result, resource := reconcileMachine()
+			Expect(fakeClient.ExecCalls).To(Equal([]string{resourceName + ":cloud-init status --wait"}))
+			Expect(resource.Status.Ready).To(BeFalse())
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseProvisioning))
+			Expect(result.RequeueAfter).To(Equal(readinessCommandRequeueAfter))
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("CommandFailed"))
+			Expect(cond.Message).To(ContainSubstring("exited with code 1"))
+			Expect(cond.Message).To(HaveSuffix("status: running\ncloud-init is still running"))
+
+			By("waiting longer the longer the command keeps failing")
+			meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition).LastTransitionTime = metav1.NewTime(time.Now().Add(-time.Hour))
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+			result, _ = reconcileMachine()
+			Expect(result.RequeueAfter).To(Equal(readinessCommandRequeueMaxDelay))
+
+			By("becoming ready once the command exits with code 0")
+			fakeClient.ExecResults[resourceName] = incustest.ExecResult{Stdout: "status: done\n"}
+			_, resource = reconcileMachine()
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1alpha1.IncusMachinePhaseRunning))
+			cond = meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal("CommandSucceeded"))
+
+			By("not running the command again")
+			_, resource = reconcileMachine()
+			Expect(resource.Status.Ready).To(BeTrue())
+			Expect(fakeClient.ExecCalls).To(HaveLen(3))
+		})
+
+		It("should report a command that times out", func() {
+			fakeClient.FailOn("Exec", fmt.Errorf("command did not finish: %w", context.DeadlineExceeded))
+
+			result, resource := reconcileMachine()
+			Expect(resource.Status.Ready).To(BeFalse())
+			Expect(result.RequeueAfter).To(Equal(readinessCommandRequeueAfter))
+			cond := meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("CommandTimedOut"))
+		})
+
+		It("should not run the command before the instance has an address", func() {
+			fakeClient.States[resourceName] = &incus.InstanceState{Status: "Running"}
+
+			_, resource := reconcileMachine()
+			Expect(resource.Status.Ready).To(BeFalse())
+			Expect(fakeClient.CallCount("Exec")).To(BeZero())
+			Expect(meta.FindStatusCondition(resource.Status.Conditions, infrastructurev1alpha1.ReadinessCommandSucceededCondition)).To(BeNil())
+		})
+	})
+
+	Context("When the instance runs on an Incus cluster member", func() {
+		const resourceName = "test-host"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			createMachineWithFinalizer(ctx, typeNamespacedName, infrastructurev1alpha1.IncusMachineSpec{})
+		})
+
+		AfterEach(func() {
+			removeMachine(ctx, typeNamespacedName)
+		})
+
+		It("should record the member in status and follow migrations", func() {
+			fakeClient := incustest.NewFakeClient()
+			fakeClient.Location = "member-1"
+			controllerReconciler := &IncusMachineReconciler{
+				Client:      k8sClient,
+				Scheme:      k8sClient.Scheme(),
+				IncusClient: fakeClient,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Host).To(Equal("member-1"))
+
+			By("migrating the instance to another member")
+			fakeClient.Location = "member-2"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Host).To(Equal("member-2"))
+		})
+	})
 })
+
+// createMachineWithFinalizer creates an IncusMachine that already carries the
+// controller finalizer, so the next reconcile goes straight to provisioning.
+// The IncusMachine is owned by a CAPI Machine whose bootstrap data secret is
+// named after key with a "-bootstrap" suffix.
+func createMachineWithFinalizer(ctx context.Context, key types.NamespacedName, spec infrastructurev1alpha1.IncusMachineSpec) {
+	dataSecretName := key.Name + "-bootstrap"
+	Expect(k8sClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: dataSecretName, Namespace: key.Namespace},
+		Data:       map[string][]byte{"value": []byte("#cloud-config\n")},
+	})).To(Succeed())
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: "test-cluster",
+			Bootstrap:   clusterv1.Bootstrap{DataSecretName: &dataSecretName},
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: infrastructurev1alpha1.GroupVersion.String(),
+				Kind:       "IncusMachine",
+				Name:       key.Name,
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, machine)).To(Succeed())
+
+	resource := &infrastructurev1alpha1.IncusMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       key.Name,
+			Namespace:  key.Namespace,
+			Finalizers: []string{incusMachineFinalizer},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "Machine",
+				Name:       machine.Name,
+				UID:        machine.UID,
+			}},
+		},
+		Spec: spec,
+	}
+	Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+}
+
+// removeMachine strips the finalizer from an IncusMachine and deletes it
+// together with the owning Machine and its bootstrap data secret.
+func removeMachine(ctx context.Context, key types.NamespacedName) {
+	resource := &infrastructurev1alpha1.IncusMachine{}
+	err := k8sClient.Get(ctx, key, resource)
+	if err == nil {
+		resource.Finalizers = nil
+		Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, resource))).To(Succeed())
+	} else {
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	}
+
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	Expect(k8sClient.Delete(ctx, machine)).To(Succeed())
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name + "-bootstrap", Namespace: key.Namespace}}
+	Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+}
+
+// createCluster creates a CAPI Cluster and the IncusCluster it references,
+// both named after key. The IncusCluster is marked ready.
+func createCluster(ctx context.Context, key types.NamespacedName, network string) {
+	incusCluster := &infrastructurev1alpha1.IncusCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec:       infrastructurev1alpha1.IncusClusterSpec{Network: network},
+	}
+	Expect(k8sClient.Create(ctx, incusCluster)).To(Succeed())
+	incusCluster.Status.Ready = true
+	Expect(k8sClient.Status().Update(ctx, incusCluster)).To(Succeed())
+	Expect(k8sClient.Create(ctx, &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: infrastructurev1alpha1.GroupVersion.String(),
+				Kind:       "IncusCluster",
+				Name:       key.Name,
+			},
+		},
+	})).To(Succeed())
+}
+
+// removeCluster deletes the CAPI Cluster and IncusCluster created by
+// createCluster, if any.
+func removeCluster(ctx context.Context, key types.NamespacedName) {
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+	incusCluster := &infrastructurev1alpha1.IncusCluster{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, incusCluster))).To(Succeed())
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+// managedDevicesConfigKey records the names of the devices of an instance
+// that come from spec.devices, comma-separated, so that a device removed
+// from the spec can be removed from the instance as well.
+const managedDevicesConfigKey = "user.capi.devices"
+
+// hotPluggableDeviceTypes are the device types a running virtual machine
+// can gain or lose without a restart.
+var hotPluggableDeviceTypes = map[string]bool{
+	"disk": true,
+	"nic":  true,
+	"usb":  true,
+}
+
+// reconcileDevices brings the profiles and spec.devices of an existing
+// instance described by info in line with the spec, whether the spec changed
+// or the instance was changed outside the provider. Containers and stopped
+// instances take every change. A running virtual machine only hot-plugs
+// NICs, disks and USB devices being added or removed; changing its profiles
+// or an existing device is held back and reported in the
+// InstanceDevicesSynced condition until the instance is stopped.
+func (r *IncusMachineReconciler) reconcileDevices(ctx context.Context, log logr.Logger, incusClient incus.Client, incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) error {
+	instanceName := info.Name
+	profiles := instanceProfiles(incusCluster, incusMachine)
+	if len(profiles) == 0 {
+		profiles = []string{"default"}
+	}
+	profileDrift := !slices.Equal(info.Profiles, profiles)
+	changes := deviceChanges(incusCluster, incusMachine, info)
+
+	var pending []string
+	if info.Type != "container" && info.Status == "Running" {
+		if profileDrift {
+			pending = append(pending, "profiles")
+			profileDrift = false
+		}
+		for name, device := range changes {
+			if !hotPluggable(info.Devices[name], device) {
+				pending = append(pending, "device "+name)
+				delete(changes, name)
+			}
+		}
+	}
+
+	if profileDrift {
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.UpdateInstanceProfiles(opCtx, instanceName, profiles); err != nil {
+			err = fmt.Errorf("failed to update profiles of instance %s: %w", instanceName, err)
+			return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDevicesSyncedCondition, "DeviceUpdateFailed", err)
+		}
+		log.Info("Updated profiles of Incus instance", "instance", instanceName, "profiles", profiles)
+	}
+	if len(changes) > 0 {
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.UpdateInstanceDevices(opCtx, instanceName, changes); err != nil {
+			err = fmt.Errorf("failed to update devices of instance %s: %w", instanceName, err)
+			return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDevicesSyncedCondition, "DeviceUpdateFailed", err)
+		}
+		log.Info("Updated devices of Incus instance", "instance", instanceName, "devices", slices.Sorted(maps.Keys(changes)))
+	}
+
+	if len(pending) > 0 {
+		slices.Sort(pending)
+		meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1alpha1.InstanceDevicesSyncedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RestartRequired",
+			Message: fmt.Sprintf("Changing the %s of a running virtual machine requires a restart; the change is applied once the instance is stopped", strings.Join(pending, ", ")),
+		})
+		return nil
+	}
+	// Only record the new set once every removal has been applied.
+	if names := managedDeviceNames(incusCluster, incusMachine); info.Config[managedDevicesConfigKey] != names {
+		opCtx, cancel := operationContext(ctx)
+		defer cancel()
+		if err := incusClient.UpdateInstanceConfig(opCtx, instanceName, map[string]string{managedDevicesConfigKey: names}); err != nil {
+			err = fmt.Errorf("failed to update devices of instance %s: %w", instanceName, err)
+			return r.markConditionFailed(ctx, log, incusMachine, infrastructurev1alpha1.InstanceDevicesSyncedCondition, "DeviceUpdateFailed", err)
+		}
+	}
+	meta.SetStatusCondition(&incusMachine.Status.Conditions, metav1.Condition{
+		Type:   infrastructurev1alpha1.InstanceDevicesSyncedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "DevicesSynced",
+	})
+	return nil
+}
+
+// managedDevices returns the devices of spec.devices the provider keeps in
+// sync: all but those replaced by the devices it generates itself, such as
+// the root disk, NICs, data disks and GPUs, which are only set when the
+// instance is created.
+func managedDevices(incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) map[string]map[string]string {
+	devices := maps.Clone(incusMachine.Spec.Devices)
+	delete(devices, "root")
+	if incusCluster != nil && incusCluster.Spec.Network != "" {
+		delete(devices, "eth0")
+	}
+	for _, nic := range incusMachine.Spec.NetworkInterfaces {
+		delete(devices, nic.Name)
+	}
+	for i := range incusMachine.Spec.DataDisks {
+		delete(devices, incus.DataDeviceName(i))
+	}
+	for i := range incusMachine.Spec.GPUs {
+		delete(devices, incus.GPUDeviceName(i))
+	}
+	return devices
+}
+
+// managedDeviceNames returns the value of managedDevicesConfigKey for the
+// managed devices of incusMachine.
+func managedDeviceNames(incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine) string {
+	return strings.Join(slices.Sorted(maps.Keys(managedDevices(incusCluster, incusMachine))), ",")
+}
+
+// deviceChanges returns the managed devices that are missing from the
+// instance described by info or differ from the spec, and nil for the
+// devices the instance still has although they were removed from the spec.
+func deviceChanges(incusCluster *infrastructurev1alpha1.IncusCluster, incusMachine *infrastructurev1alpha1.IncusMachine, info *incus.InstanceInfo) map[string]map[string]string {
+	want := managedDevices(incusCluster, incusMachine)
+	changes := map[string]map[string]string{}
+	for name, device := range want {
+		if current, ok := info.Devices[name]; !ok || !maps.Equal(current, device) {
+			changes[name] = device
+		}
+	}
+	for name := range strings.SplitSeq(info.Config[managedDevicesConfigKey], ",") {
+		if _, ok := want[name]; ok || name == "" {
+			continue
+		}
+		if _, ok := info.Devices[name]; ok {
+			changes[name] = nil
+		}
+	}
+	return changes
+}
+
+// hotPluggable reports whether a running virtual machine can go from device
+// current to device want, either of which is nil if absent, without a
+// restart: only whole devices of a hot-pluggable type can come and go.
+func hotPluggable(current, want map[string]string) bool {
+	switch {
+	case current == nil:
+		return hotPluggableDeviceTypes[want["type"]]
+	case want == nil:
+		return hotPluggableDeviceTypes[current["type"]]
+	default:
+		return false
+	}
+}
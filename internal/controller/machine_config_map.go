@@ -0,0 +1,114 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+)
+
+// Keys read from the ConfigMap referenced by an IncusMachine's configMapRef.
+const (
+	// MachineConfigMapConfigKey holds a YAML mapping of Incus config keys.
+	MachineConfigMapConfigKey = "config"
+	// MachineConfigMapDevicesKey holds a YAML mapping of Incus devices.
+	MachineConfigMapDevicesKey = "devices"
+	// MachineConfigMapVendorDataKey holds the cloud-init vendor-data.
+	MachineConfigMapVendorDataKey = "vendor-data"
+	// MachineConfigMapUserDataKey is rejected: the instance's cloud-init
+	// user-data is the bootstrap data of its Machine.
+	MachineConfigMapUserDataKey = "user-data"
+)
+
+// machineConfigMap holds the instance settings read from the ConfigMap of an
+// IncusMachine.
+type machineConfigMap struct {
+	Config     map[string]string
+	Devices    map[string]map[string]string
+	VendorData string
+}
+
+// machineConfigFromConfigMap reads the ConfigMap referenced by incusMachine.
+// It returns nil if the machine references none, and an error satisfying
+// apierrors.IsNotFound if the ConfigMap does not exist.
+func machineConfigFromConfigMap(ctx context.Context, c client.Reader, incusMachine *infrastructurev1alpha1.IncusMachine) (*machineConfigMap, error) {
+	ref := incusMachine.Spec.ConfigMapRef
+	if ref == nil {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Namespace: incusMachine.Namespace, Name: ref.Name}
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, key, configMap); err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s: %w", key, err)
+	}
+
+	// cloud-init merges vendor-data with the bootstrap user-data, so shared
+	// settings go there rather than replacing the bootstrap data.
+	if _, ok := configMap.Data[MachineConfigMapUserDataKey]; ok {
+		return nil, fmt.Errorf("ConfigMap %s: the %q key is not supported, user-data comes from the bootstrap provider; use %q instead",
+			key, MachineConfigMapUserDataKey, MachineConfigMapVendorDataKey)
+	}
+
+	cm := &machineConfigMap{VendorData: configMap.Data[MachineConfigMapVendorDataKey]}
+	if data := configMap.Data[MachineConfigMapConfigKey]; data != "" {
+		if err := yaml.Unmarshal([]byte(data), &cm.Config); err != nil {
+			return nil, fmt.Errorf("ConfigMap %s: invalid %q key: %w", key, MachineConfigMapConfigKey, err)
+		}
+		// As in spec.config, the resource limits come from cpus and
+		// memoryMiB only.
+		for _, k := range []string{"limits.cpu", "limits.memory"} {
+			if _, ok := cm.Config[k]; ok {
+				return nil, fmt.Errorf("ConfigMap %s: %s is set through cpus and memoryMiB", key, k)
+			}
+		}
+	}
+	if data := configMap.Data[MachineConfigMapDevicesKey]; data != "" {
+		if err := yaml.Unmarshal([]byte(data), &cm.Devices); err != nil {
+			return nil, fmt.Errorf("ConfigMap %s: invalid %q key: %w", key, MachineConfigMapDevicesKey, err)
+		}
+	}
+	return cm, nil
+}
+
+// instanceDevices returns the devices of incusMachine: those of its
+// ConfigMap, replaced by the spec's devices of the same name.
+func instanceDevices(incusMachine *infrastructurev1alpha1.IncusMachine, cm *machineConfigMap) map[string]map[string]string {
+	if cm == nil || len(cm.Devices) == 0 {
+		return incusMachine.Spec.Devices
+	}
+	devices := maps.Clone(cm.Devices)
+	maps.Copy(devices, incusMachine.Spec.Devices)
+	return devices
+}
+
+// vendorData returns the cloud-init vendor-data of incusMachine, falling back
+// to that of its ConfigMap.
+func vendorData(incusMachine *infrastructurev1alpha1.IncusMachine, cm *machineConfigMap) string {
+	if incusMachine.Spec.VendorData == "" && cm != nil {
+		return cm.VendorData
+	}
+	return incusMachine.Spec.VendorData
+}
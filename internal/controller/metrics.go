@@ -0,0 +1,127 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+// Reasons of the incus_instance_create_errors_total metric.
+const (
+	createErrorNameConflict   = "NameConflict"
+	createErrorTransient      = "Transient"
+	createErrorInvalidRequest = "InvalidRequest"
+	createErrorFailed         = "Failed"
+)
+
+// managedInstancesListTimeout bounds the listing of IncusMachines when the
+// metrics are scraped.
+const managedInstancesListTimeout = 10 * time.Second
+
+var (
+	instanceCreateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "incus_instance_create_duration_seconds",
+		Help:    "Time taken by Incus to create an instance, including failed attempts.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	})
+
+	instanceCreateErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "incus_instance_create_errors_total",
+		Help: "Number of failed attempts to create an Incus instance, by reason.",
+	}, []string{"reason"})
+
+	instancesManagedDesc = prometheus.NewDesc(
+		"incus_instances_managed",
+		"Number of IncusMachines backed by an Incus instance.",
+		nil, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(instanceCreateDuration, instanceCreateErrors)
+}
+
+// observeInstanceCreate records a call to CreateInstance that started at
+// start and returned err.
+func observeInstanceCreate(start time.Time, err error) {
+	instanceCreateDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	reason := createErrorFailed
+	switch {
+	case errors.Is(err, incus.ErrInstanceExists):
+		reason = createErrorNameConflict
+	case errors.Is(err, incus.ErrTransient) || errors.Is(err, context.DeadlineExceeded):
+		reason = createErrorTransient
+	case errors.Is(err, incus.ErrInvalidRequest):
+		reason = createErrorInvalidRequest
+	}
+	instanceCreateErrors.WithLabelValues(reason).Inc()
+}
+
+// managedInstancesCollector reports incus_instances_managed, counted from
+// the IncusMachines in the cache whenever the metrics are scraped.
+type managedInstancesCollector struct {
+	client client.Reader
+}
+
+var _ prometheus.Collector = &managedInstancesCollector{}
+
+// Describe implements prometheus.Collector.
+func (c *managedInstancesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesManagedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *managedInstancesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), managedInstancesListTimeout)
+	defer cancel()
+	machines := &infrastructurev1alpha1.IncusMachineList{}
+	if err := c.client.List(ctx, machines); err != nil {
+		ch <- prometheus.NewInvalidMetric(instancesManagedDesc, fmt.Errorf("failed to list IncusMachines: %w", err))
+		return
+	}
+	n := 0
+	for _, m := range machines.Items {
+		if meta.IsStatusConditionTrue(m.Status.Conditions, infrastructurev1alpha1.InstanceProvisionedCondition) {
+			n++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(instancesManagedDesc, prometheus.GaugeValue, float64(n))
+}
+
+// registerManagedInstancesCollector adds the incus_instances_managed metric,
+// read through c, to the controller-runtime metrics registry. Registering
+// it again is a no-op.
+func registerManagedInstancesCollector(c client.Reader) error {
+	err := metrics.Registry.Register(&managedInstancesCollector{client: c})
+	if errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		return nil
+	}
+	return err
+}
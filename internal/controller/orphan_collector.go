@@ -0,0 +1,169 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+// OrphanCollector deletes, once at startup, the Incus instances of each
+// IncusCluster-backed Cluster whose IncusMachine no longer exists. Such
+// instances are left behind when an IncusMachine is removed while the
+// controller is not running, for example by force-removing its finalizer.
+//
+// It is added to the manager as a runnable and only runs on the leader.
+type OrphanCollector struct {
+	// Client must read from the API server directly; the manager cache is
+	// not guaranteed to be synced when Start is called.
+	Client      client.Reader
+	IncusClient incus.Client
+}
+
+// ownedInstance is an instance created by an IncusMachine.
+type ownedInstance struct {
+	incusClient incus.Client
+	cluster     string
+	name        string
+	owner       string
+}
+
+// Start runs the collection once. Failures are logged rather than returned
+// so that they do not stop the manager.
+func (c *OrphanCollector) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("orphan-collector")
+	if err := c.collect(ctx); err != nil {
+		log.Error(err, "Failed to clean up orphaned Incus instances")
+	}
+	return nil
+}
+
+// NeedLeaderElection makes the collector run only on the elected leader.
+func (c *OrphanCollector) NeedLeaderElection() bool {
+	return true
+}
+
+func (c *OrphanCollector) collect(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("orphan-collector")
+
+	// Instances are listed before the IncusMachines: an instance created in
+	// between then belongs to a machine that is already in the list, rather
+	// than appearing to have no machine at all.
+	candidates, err := c.ownedInstances(ctx)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	machines := &infrastructurev1alpha1.IncusMachineList{}
+	if err := c.Client.List(ctx, machines); err != nil {
+		return fmt.Errorf("failed to list IncusMachines: %w", err)
+	}
+	live := map[string]bool{}
+	for _, m := range machines.Items {
+		live[string(m.UID)] = true
+	}
+
+	var errs []error
+	for _, inst := range candidates {
+		if live[inst.owner] {
+			continue
+		}
+		if err := deleteOrphan(ctx, inst); err != nil {
+			log.Error(err, "Failed to delete orphaned Incus instance", "cluster", inst.cluster, "instance", inst.name)
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("Deleted orphaned Incus instance", "cluster", inst.cluster, "instance", inst.name, "machineUID", inst.owner)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete %d orphaned instances", len(errs))
+	}
+	return nil
+}
+
+// ownedInstances returns the instances of every IncusCluster-backed Cluster
+// that carry the UID of the IncusMachine that created them.
+func (c *OrphanCollector) ownedInstances(ctx context.Context) ([]ownedInstance, error) {
+	clusters := &clusterv1.ClusterList{}
+	if err := c.Client.List(ctx, clusters); err != nil {
+		return nil, fmt.Errorf("failed to list Clusters: %w", err)
+	}
+
+	var result []ownedInstance
+	for _, cluster := range clusters.Items {
+		ref := cluster.Spec.InfrastructureRef
+		if ref == nil || ref.Kind != "IncusCluster" {
+			continue
+		}
+		incusCluster := &infrastructurev1alpha1.IncusCluster{}
+		key := types.NamespacedName{Namespace: cluster.Namespace, Name: ref.Name}
+		if err := c.Client.Get(ctx, key, incusCluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get IncusCluster %s: %w", key, err)
+		}
+		incusClient := c.IncusClient.UseProject(incusCluster.Spec.Project)
+
+		instances, err := incusClient.ListInstances(ctx, map[string]string{clusterConfigKey: cluster.Name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances of Cluster %s: %w", client.ObjectKeyFromObject(&cluster), err)
+		}
+		for _, inst := range instances {
+			// Instances without an owner were not created by an
+			// IncusMachine and are never touched.
+			owner := instanceOwner(inst.Config)
+			if owner == "" {
+				continue
+			}
+			result = append(result, ownedInstance{
+				incusClient: incusClient,
+				cluster:     client.ObjectKeyFromObject(&cluster).String(),
+				name:        inst.Name,
+				owner:       owner,
+			})
+		}
+	}
+	return result, nil
+}
+
+// deleteOrphan clears the delete protection of the instance and deletes it.
+func deleteOrphan(ctx context.Context, inst ownedInstance) error {
+	updateCtx, cancelUpdate := operationContext(ctx)
+	defer cancelUpdate()
+	if err := inst.incusClient.UpdateInstanceConfig(updateCtx, inst.name, map[string]string{deleteProtectionConfigKey: ""}); err != nil {
+		return fmt.Errorf("failed to clear delete protection on instance %s: %w", inst.name, err)
+	}
+	deleteCtx, cancelDelete := operationContext(ctx)
+	defer cancelDelete()
+	if err := inst.incusClient.DeleteInstance(deleteCtx, inst.name); err != nil {
+		return fmt.Errorf("failed to delete instance %s: %w", inst.name, err)
+	}
+	return nil
+}
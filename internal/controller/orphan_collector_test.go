@@ -0,0 +1,82 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus/incustest"
+)
+
+var _ = Describe("OrphanCollector", func() {
+	ctx := context.Background()
+	clusterKey := types.NamespacedName{Name: "orphan-cluster", Namespace: "default"}
+	machineKey := types.NamespacedName{Name: "orphan-live", Namespace: "default"}
+
+	BeforeEach(func() {
+		createCluster(ctx, clusterKey, "")
+		Expect(k8sClient.Create(ctx, &infrastructurev1alpha1.IncusMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: machineKey.Name, Namespace: machineKey.Namespace},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		machine := &infrastructurev1alpha1.IncusMachine{ObjectMeta: metav1.ObjectMeta{Name: machineKey.Name, Namespace: machineKey.Namespace}}
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, machine))).To(Succeed())
+		removeCluster(ctx, clusterKey)
+	})
+
+	It("should delete only instances whose IncusMachine is gone", func() {
+		machine := &infrastructurev1alpha1.IncusMachine{}
+		Expect(k8sClient.Get(ctx, machineKey, machine)).To(Succeed())
+
+		fake := incustest.NewFakeClient()
+		fake.Instances["orphan"] = map[string]string{
+			clusterConfigKey:          clusterKey.Name,
+			machineUIDConfigKey:       "00000000-0000-0000-0000-000000000000",
+			deleteProtectionConfigKey: "true",
+		}
+		fake.Instances["live"] = map[string]string{
+			clusterConfigKey:    clusterKey.Name,
+			machineUIDConfigKey: string(machine.UID),
+		}
+		fake.Instances["unowned"] = map[string]string{
+			clusterConfigKey: clusterKey.Name,
+		}
+		fake.Instances["other-cluster"] = map[string]string{
+			clusterConfigKey:    "some-other-cluster",
+			machineUIDConfigKey: "00000000-0000-0000-0000-000000000000",
+		}
+
+		collector := &OrphanCollector{Client: k8sClient, IncusClient: fake}
+		Expect(collector.Start(ctx)).To(Succeed())
+
+		Expect(fake.DeleteCalls).To(Equal([]string{"orphan"}))
+		Expect(fake.Instances).NotTo(HaveKey("orphan"))
+		Expect(fake.Instances).To(HaveKey("live"))
+		Expect(fake.Instances).To(HaveKey("unowned"))
+		Expect(fake.Instances).To(HaveKey("other-cluster"))
+	})
+})
@@ -17,28 +17,464 @@ limitations under the License.
 package incus
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	incus "github.com/lxc/incus/v6/client"
 	"github.com/lxc/incus/v6/shared/api"
+	"sigs.k8s.io/yaml"
 )
 
 // Client provides operations for creating and deleting Incus instances.
+//
+// Methods acting on a named instance return an error wrapping
+// ErrInstanceNotFound if the instance does not exist, unless documented
+// otherwise. Errors raised because the daemon cannot be reached wrap
+// ErrConnection, and those reporting it temporarily unavailable wrap
+// ErrTransient.
 type Client interface {
 	Connect(ctx context.Context) error
-	CreateInstance(ctx context.Context, name, image string, cpus, memoryMiB, rootDiskSizeGiB int) error
+	// Ping checks that the Incus daemon answers a request, giving up when
+	// ctx is done.
+	Ping(ctx context.Context) error
+	// CreateInstance creates and starts an instance. It returns an error
+	// wrapping ErrInstanceExists if the name is already taken, and one
+	// wrapping ErrInvalidRequest if the request is rejected as invalid. If
+	// ctx is done first, the creation is cancelled and any instance it left
+	// behind is deleted.
+	CreateInstance(ctx context.Context, req CreateInstanceRequest) error
+	// PlanInstance returns the request CreateInstance would submit for req
+	// without creating anything.
+	PlanInstance(ctx context.Context, req CreateInstanceRequest) (api.InstancesPost, error)
 	DeleteInstance(ctx context.Context, name string) error
+	StopInstance(ctx context.Context, name string, timeout time.Duration) error
+	// StartInstance starts the named instance. Starting an instance that is
+	// already running is a no-op.
+	StartInstance(ctx context.Context, name string) error
+	// MoveInstance moves the named instance to another member of the Incus
+	// cluster. A running virtual machine is migrated live; a running
+	// container is stopped for the move and started again afterwards.
+	MoveInstance(ctx context.Context, name, targetMember string) error
+	// GetInstance returns the state and config of the named instance. It
+	// returns an error wrapping ErrInstanceNotFound if there is no such
+	// instance.
+	GetInstance(ctx context.Context, name string) (*InstanceInfo, error)
 	InstanceExists(ctx context.Context, name string) (bool, error)
+	FindInstanceByConfig(ctx context.Context, key, value string) (string, error)
+	// ListInstances returns the instances whose config has every key of
+	// selector set to its value. Their addresses and limits are not filled
+	// in.
+	ListInstances(ctx context.Context, selector map[string]string) ([]InstanceInfo, error)
+	InstanceWarnings(ctx context.Context, name string) ([]string, error)
+	InstanceLocation(ctx context.Context, name string) (string, error)
+	GetInstanceState(ctx context.Context, name string) (*InstanceState, error)
+	// GetConsoleLog returns the console output the named instance has
+	// written since it started, e.g. its boot messages.
+	GetConsoleLog(ctx context.Context, name string) (string, error)
+	// Exec runs cmd in the named instance and returns its output and exit
+	// code. A command that runs and exits with a non-zero code is not an
+	// error. If ctx is done before the command exits, the command is
+	// cancelled where Incus can and the error wraps ctx.Err().
+	Exec(ctx context.Context, name string, cmd []string) (stdout, stderr string, exitCode int, err error)
+	// GetInstanceConfig returns the local config of the named instance, or
+	// nil if the instance does not exist.
+	GetInstanceConfig(ctx context.Context, name string) (map[string]string, error)
+	UpdateInstanceConfig(ctx context.Context, name string, config map[string]string) error
+	// SetInstanceLabels sets user.* config keys of the named instance,
+	// removing those with an empty value. Other keys are rejected.
+	SetInstanceLabels(ctx context.Context, name string, labels map[string]string) error
+	// UpdateInstanceResources sets the vCPUs and memory of an existing
+	// instance. cpuLimit is a limits.cpu value: a vCPU count or a set of
+	// host CPUs to pin the instance to. Incus applies them to a running
+	// instance where it can.
+	UpdateInstanceResources(ctx context.Context, name string, cpuLimit string, memoryMiB int) error
+	// UpdateInstanceProfiles replaces the profiles of an existing instance.
+	UpdateInstanceProfiles(ctx context.Context, name string, profiles []string) error
+	// UpdateInstanceDevices sets devices of an existing instance, removing
+	// those given as nil. Other devices are left alone.
+	UpdateInstanceDevices(ctx context.Context, name string, devices map[string]map[string]string) error
+	// CreateSnapshot takes a snapshot of the instance. A stateful snapshot
+	// also captures the memory of a running instance.
+	CreateSnapshot(ctx context.Context, instance, name string, stateful bool) error
+	// RestoreSnapshot restores the instance to the named snapshot. Restoring
+	// statefully resumes the instance from the captured memory.
+	RestoreSnapshot(ctx context.Context, instance, name string, stateful bool) error
+	// ListSnapshots returns the names of the snapshots of the instance.
+	ListSnapshots(ctx context.Context, instance string) ([]string, error)
+	NetworkExists(ctx context.Context, name string) (bool, error)
+	ProfileExists(ctx context.Context, name string) (bool, error)
+	// ImageExists reports whether the image store of the Incus server holds
+	// image, an alias or a fingerprint or unambiguous prefix of one.
+	ImageExists(ctx context.Context, image string) (bool, error)
+	StoragePoolExists(ctx context.Context, name string) (bool, error)
+	EnsureNetwork(ctx context.Context, name string, config map[string]string) (bool, error)
+	NetworkConfig(ctx context.Context, name string) (map[string]string, error)
+	// NetworkInstances returns the names of the instances attached to the
+	// named network, or nil if the network does not exist.
+	NetworkInstances(ctx context.Context, name string) ([]string, error)
+	DeleteNetwork(ctx context.Context, name string) error
+	// GetClusterMembers returns the members of the Incus cluster with their
+	// load, or nil if the server is not clustered.
+	GetClusterMembers(ctx context.Context) ([]ClusterMember, error)
+	// GetServerInfo describes the Incus server the client is connected to.
+	GetServerInfo(ctx context.Context) (*ServerInfo, error)
+	// UseProject returns a Client that operates in the named Incus project.
+	// An empty name returns the receiver.
+	UseProject(name string) Client
+	// Close releases the connection to the daemon. The client stays usable
+	// and reconnects on its next call.
 	Close() error
 }
 
+// CreateInstanceRequest describes an instance to be created by CreateInstance.
+type CreateInstanceRequest struct {
+	Name string
+	// Description is the description of the instance.
+	Description string
+	// Image is the alias or fingerprint of the source image.
+	Image string
+	// ImageServer, when set, is the URL of the image server the image is
+	// pulled from, spoken to with ImageProtocol ("simplestreams", the
+	// default, or "incus").
+	ImageServer   string
+	ImageProtocol string
+	// InstanceType is "virtual-machine" (the default when empty) or
+	// "container".
+	InstanceType string
+	CPUs         int
+	MemoryMiB    int
+	// CPUPinning, when set, pins the instance to a set of host CPUs, e.g.
+	// "0-3", instead of giving it CPUs floating vCPUs. Maps to limits.cpu.
+	CPUPinning string
+	// RootDiskSizeGiB and StoragePool, when set, override the size and pool
+	// of the root disk inherited from the profiles; its other keys are kept.
+	RootDiskSizeGiB int
+	StoragePool     string
+	// RootDiskReadIOPS or RootDiskReadBps, and RootDiskWriteIOPS or
+	// RootDiskWriteBps, when set, cap the IO of the root disk through its
+	// limits.read and limits.write keys. Each key takes only one of the two.
+	// RootDiskMaxIOPS or RootDiskMaxBps set limits.max instead, which caps
+	// reads and writes alike and cannot be combined with the other keys.
+	RootDiskReadIOPS  int64
+	RootDiskWriteIOPS int64
+	RootDiskReadBps   int64
+	RootDiskWriteBps  int64
+	RootDiskMaxIOPS   int64
+	RootDiskMaxBps    int64
+	// Config holds additional instance config keys (e.g. user.* metadata) that
+	// are merged into the provider-generated config.
+	Config map[string]string
+	// Devices holds additional instance devices. A root disk given here
+	// takes the place of the profile's root disk. The NICs and data disks
+	// generated from Network, NetworkInterfaces and DataDisks replace devices
+	// of the same name.
+	Devices map[string]map[string]string
+	// DataDisks are extra disks, each backed by a custom storage volume
+	// created with the instance and attached as device data0, data1, etc.
+	DataDisks []DataDisk
+	// GPUs are physical GPUs passed through to the instance as devices
+	// gpu0, gpu1, etc.
+	GPUs []GPUDevice
+	// MemoryBallooning controls the VM memory balloon device. Nil keeps the
+	// Incus default (enabled); false removes the device.
+	MemoryBallooning *bool
+	// MemorySwap and MemoryEnforce set limits.memory.swap and
+	// limits.memory.enforce ("hard" or "soft") of a container. Nil and empty
+	// keep the Incus defaults.
+	MemorySwap    *bool
+	MemoryEnforce string
+	// CloudInitDatasource, when set, forces cloud-init to use the named
+	// datasource (e.g. "nocloud") via the SMBIOS serial hint.
+	CloudInitDatasource string
+	// NUMANodes restricts the instance to a set of host NUMA nodes, e.g.
+	// "0" or "0-1,3". Maps to limits.cpu.nodes.
+	NUMANodes string
+	// SecureBoot sets security.secureboot of a VM. Nil disables secure
+	// boot, as many cloud images do not boot with it.
+	SecureBoot *bool
+	// Nesting and Privileged set security.nesting and security.privileged
+	// of a container.
+	Nesting    bool
+	Privileged bool
+	// BootAutostart sets boot.autostart. Nil keeps the Incus default, which
+	// restores the state the instance had when the daemon stopped.
+	BootAutostart *bool
+	// BootPriority, when positive, sets boot.autostart.priority; instances
+	// with a higher priority are started first.
+	BootPriority int
+	// VendorData and NetworkConfig are the cloud-init vendor-data and
+	// network-config. NetworkConfig must be a YAML mapping, as must
+	// VendorData when it is a cloud-config document.
+	VendorData    string
+	NetworkConfig string
+	// Hostname, when set, replaces the instance name as the hostname
+	// cloud-init gives the instance, through the local-hostname of its
+	// meta-data.
+	Hostname string
+	// DNSServers, when set, are the resolvers of the instance. They are
+	// written into a generated network-config that configures every
+	// ethernet interface through DHCP, so they cannot be combined with
+	// NetworkConfig.
+	DNSServers []string
+	// UserData is the cloud-init user-data (e.g. kubeadm bootstrap data)
+	// passed to the instance.
+	UserData string
+	// Profiles lists the profiles applied to the instance, in order. When
+	// empty, the "default" profile is used.
+	Profiles []string
+	// Network, when set, attaches the instance's eth0 NIC to the named Incus
+	// network instead of the one from the default profile.
+	Network string
+	// NetworkInterfaces are NICs added to the instance, or replacing eth0.
+	NetworkInterfaces []NetworkInterface
+	// Target, when set, creates the instance on the named Incus cluster
+	// member instead of letting the server place it.
+	Target string
+}
+
+// NetworkInterface is a NIC of an instance.
+type NetworkInterface struct {
+	// Name is the device name and the interface name inside the instance.
+	Name string
+	// Network is the managed network the NIC is attached to. When empty,
+	// the request's Network is used.
+	Network string
+	// IPv4Address, when set, is the static address of the NIC.
+	IPv4Address string
+	// HWAddr, when set, is the MAC address of the NIC.
+	HWAddr string
+}
+
+// DataDisk is an extra disk of an instance.
+type DataDisk struct {
+	// SizeGiB is the size of the disk in gibibytes.
+	SizeGiB int
+	// Pool is the storage pool the volume backing the disk is created in.
+	Pool string
+	// Path, when set, mounts the disk as a filesystem at this path.
+	// Otherwise the disk is attached to the VM as a block device.
+	Path string
+}
+
+// GPUDevice is a physical GPU passed through to an instance. Empty
+// selectors match any GPU.
+type GPUDevice struct {
+	// Vendor and Product are the PCI vendor and product IDs of the GPU.
+	Vendor  string
+	Product string
+	// PCI is the PCI address of the GPU.
+	PCI string
+}
+
+// ClusterMember is a member of an Incus cluster.
+type ClusterMember struct {
+	Name string
+	// Status is the member status reported by Incus, e.g. "Online".
+	Status string
+	// Load is the one-minute load average of the member. It is only
+	// reported for members that are online.
+	Load float64
+}
+
+// ServerInfo describes an Incus server.
+type ServerInfo struct {
+	// Version is the Incus version of the server, e.g. "6.0.4".
+	Version string
+	// APIExtensions lists the API extensions the server supports.
+	APIExtensions []string
+	// StorageDriver is the storage driver of the server, e.g. "zfs". It
+	// lists several drivers, separated by " | ", if more than one is in use.
+	StorageDriver string
+	// VirtualMachines reports whether the server can run virtual machines.
+	VirtualMachines bool
+}
+
+// InstanceState describes the runtime state of an instance.
+type InstanceState struct {
+	// Status is the instance status reported by Incus, e.g. "Running".
+	Status string
+	// Addresses are the global IP addresses of the instance's network
+	// interfaces, ordered by interface name.
+	Addresses []string
+}
+
+const (
+	// defaultUserAgent identifies the provider to the Incus server.
+	defaultUserAgent = "cluster-api-provider-incus"
+
+	// defaultHTTPTimeout bounds a single API request to the Incus server.
+	// Long running work is done in operations, so requests return quickly.
+	defaultHTTPTimeout = 30 * time.Second
+
+	// defaultConnectTimeout bounds establishing a new connection to the
+	// Incus server.
+	defaultConnectTimeout = 10 * time.Second
+
+	// defaultConnectAttempts and defaultConnectMaxDelay bound the retries of
+	// Connect while the Incus daemon is unreachable.
+	defaultConnectAttempts = 5
+	defaultConnectMaxDelay = 10 * time.Second
+
+	// defaultMaxConcurrentOperations bounds the mutating operations, such
+	// as creating or deleting an instance, that run on the server at once.
+	defaultMaxConcurrentOperations = 10
+
+	// connectRetryBaseDelay is the wait before the first Connect retry; it
+	// doubles with every further attempt.
+	connectRetryBaseDelay = 500 * time.Millisecond
+)
+
+// Errors returned by the client can be matched with errors.Is. They wrap the
+// underlying Incus error, which stays available to errors.As.
+var (
+	// ErrInstanceNotFound is returned by methods acting on a named instance
+	// when the instance does not exist.
+	ErrInstanceNotFound = errors.New("instance not found")
+
+	// ErrInstanceExists is returned by CreateInstance when an instance of
+	// the same name already exists.
+	ErrInstanceExists = errors.New("instance already exists")
+
+	// ErrConnection is returned when the Incus daemon cannot be reached or
+	// the connection to it breaks. Configuration errors are not wrapped.
+	ErrConnection = errors.New("connection to Incus failed")
+
+	// ErrTransient is returned when the Incus daemon is temporarily unable
+	// to serve a request, e.g. because it is busy or starting up. The same
+	// request may succeed later.
+	ErrTransient = errors.New("Incus is temporarily unavailable")
+
+	// ErrInvalidRequest is returned by CreateInstance when the request is
+	// rejected as invalid, e.g. because its image does not exist. Retrying
+	// the same request fails again.
+	ErrInvalidRequest = errors.New("invalid instance request")
+)
+
+// InstanceInfo describes an existing instance.
+type InstanceInfo struct {
+	Name string
+	// Type is "virtual-machine" or "container".
+	Type string
+	// Status is the instance status reported by Incus, e.g. "Running".
+	Status string
+	// Location is the Incus cluster member the instance runs on. It is empty
+	// on a standalone server.
+	Location string
+	// Addresses are the global IP addresses of the instance's network
+	// interfaces, ordered by interface name.
+	Addresses []string
+	// Config is the config set on the instance itself, without the keys
+	// inherited from its profiles.
+	Config map[string]string
+	// Profiles are the profiles applied to the instance, in order.
+	Profiles []string
+	// Devices are the devices set on the instance itself, without those
+	// inherited from its profiles.
+	Devices map[string]map[string]string
+	// CPULimit and MemoryLimit are the effective limits.cpu and
+	// limits.memory, including values inherited from profiles.
+	CPULimit    string
+	MemoryLimit string
+}
+
+// stopTimeout is how long DeleteInstance and MoveInstance let a running
+// instance shut down cleanly before it is stopped forcefully.
+const stopTimeout = 30 * time.Second
+
+// abandonedCreateCleanupTimeout bounds the removal of an instance whose
+// creation was cancelled. It leaves room to stop the instance.
+const abandonedCreateCleanupTimeout = 2 * stopTimeout
+
+// resourceLimits returns the instance config keys for a limits.cpu value and
+// a memory size.
+func resourceLimits(cpuLimit string, memoryMiB int) map[string]string {
+	return map[string]string{
+		"limits.cpu":    cpuLimit,
+		"limits.memory": fmt.Sprintf("%dMiB", memoryMiB),
+	}
+}
+
+// CPULimit returns the limits.cpu value for a vCPU count, or for a set of
+// host CPUs to pin the instance to if pinning is set. Incus reads a lone
+// number as a count, so a single pinned CPU is written as a range.
+func CPULimit(cpus int, pinning string) string {
+	switch {
+	case pinning == "":
+		return strconv.Itoa(cpus)
+	case !strings.ContainsAny(pinning, ",-"):
+		return pinning + "-" + pinning
+	}
+	return pinning
+}
+
+// qemuBalloonSection is the generated qemu.conf section for the VM memory
+// balloon device. Listing it without keys in raw.qemu.conf removes it.
+const qemuBalloonSection = `[device "qemu_balloon"]`
+
 // clientImpl implements Client using the Incus Go library.
 type clientImpl struct {
+	clientConfig
+	// mu guards server, which is established lazily and dropped when a call
+	// fails at the transport level so the next call reconnects.
+	mu     sync.Mutex
+	server incus.InstanceServer
+	// dial opens a new connection; it defaults to connect and is replaced in
+	// tests.
+	dial func(ctx context.Context) (incus.InstanceServer, error)
+	// project, when set, scopes all operations to the named Incus project.
+	project string
+	// projects caches the clients returned by UseProject.
+	projects map[string]*clientImpl
+	// instanceLocks serializes mutating operations on the same instance
+	// name so concurrent reconciles cannot interleave destructively.
+	instanceLocks keyedMutex
+}
+
+// clientConfig holds the settings of a client, set by its ClientOptions.
+// The clients returned by UseProject share them.
+type clientConfig struct {
 	socketPath string
-	server     incus.InstanceServer
+	// remoteURL, when set, connects to a remote Incus server over HTTPS
+	// instead of the local unix socket.
+	remoteURL     string
+	tlsClientCert string
+	tlsClientKey  string
+	tlsServerCert string
+	// serverCertFingerprint, when set, is the SHA-256 fingerprint the
+	// remote server's certificate must have, in lower case hex.
+	serverCertFingerprint string
+	// insecureSkipVerify disables all checks of the remote server's
+	// certificate.
+	insecureSkipVerify bool
+	// userAgent is sent with every API request.
+	userAgent string
+	// httpTimeout bounds a single API request; zero disables the timeout.
+	httpTimeout time.Duration
+	// connectTimeout bounds dialing a new connection; zero disables it.
+	connectTimeout time.Duration
+	// connectAttempts and connectMaxDelay configure the retries of Connect.
+	connectAttempts int
+	connectMaxDelay time.Duration
+	// operations bounds the mutating operations in flight on the Incus
+	// server.
+	operations semaphore
 }
 
 // ClientOption configures the Incus client.
@@ -51,132 +487,1914 @@ func WithSocketPath(path string) ClientOption {
 	}
 }
 
+// WithRemote connects to a remote Incus server over HTTPS at url, using the
+// given PEM encoded client certificate and key. tlsServerCert pins the server
+// certificate; when empty the system CAs are used to verify the server.
+func WithRemote(url, tlsClientCert, tlsClientKey, tlsServerCert string) ClientOption {
+	return func(c *clientImpl) {
+		c.remoteURL = url
+		c.tlsClientCert = tlsClientCert
+		c.tlsClientKey = tlsClientKey
+		c.tlsServerCert = tlsServerCert
+	}
+}
+
+// WithServerCertFingerprint pins the SHA-256 fingerprint of the remote
+// server's certificate, as "incus info" shows it; colons are allowed. The
+// connection fails unless the server presents a certificate with that
+// fingerprint, and the certificate is then trusted without checking it
+// against the system CAs or the host name.
+func WithServerCertFingerprint(fingerprint string) ClientOption {
+	return func(c *clientImpl) {
+		c.serverCertFingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	}
+}
+
+// WithInsecureSkipVerify connects to the remote server without checking its
+// certificate at all, which exposes the connection to man-in-the-middle
+// attacks. It is meant for disposable test environments only.
+func WithInsecureSkipVerify() ClientOption {
+	return func(c *clientImpl) {
+		c.insecureSkipVerify = true
+	}
+}
+
+// WithProject scopes all operations of the client to the named Incus project
+// instead of the default project.
+func WithProject(name string) ClientOption {
+	return func(c *clientImpl) {
+		c.project = name
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with every request to Incus.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *clientImpl) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithHTTPTimeout bounds each API request to Incus. Zero disables the
+// timeout.
+func WithHTTPTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientImpl) {
+		c.httpTimeout = timeout
+	}
+}
+
+// WithConnectTimeout bounds establishing a new connection to Incus, which
+// happens on the first call and after a connection error. Zero disables the
+// timeout.
+func WithConnectTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientImpl) {
+		c.connectTimeout = timeout
+	}
+}
+
+// WithConnectRetry makes Connect try up to attempts times before giving up,
+// waiting between attempts with exponential backoff capped at maxDelay.
+func WithConnectRetry(attempts int, maxDelay time.Duration) ClientOption {
+	return func(c *clientImpl) {
+		c.connectAttempts = attempts
+		c.connectMaxDelay = maxDelay
+	}
+}
+
+// WithMaxConcurrentOperations bounds the mutating operations, such as
+// creating or deleting instances, that run on the Incus server at once, so
+// large scale-ups do not overwhelm the daemon. Zero removes the limit.
+func WithMaxConcurrentOperations(n int) ClientOption {
+	return func(c *clientImpl) {
+		c.operations = newSemaphore(n)
+	}
+}
+
 // NewClient creates a new Incus client.
 func NewClient(opts ...ClientOption) Client {
-	c := &clientImpl{
-		socketPath: os.Getenv("INCUS_SOCKET"),
-	}
+	c := &clientImpl{clientConfig: clientConfig{
+		socketPath:      os.Getenv("INCUS_SOCKET"),
+		userAgent:       defaultUserAgent,
+		httpTimeout:     defaultHTTPTimeout,
+		connectTimeout:  defaultConnectTimeout,
+		connectAttempts: defaultConnectAttempts,
+		connectMaxDelay: defaultConnectMaxDelay,
+		operations:      newSemaphore(defaultMaxConcurrentOperations),
+	}}
+	c.dial = c.connect
 	for _, opt := range opts {
 		opt(c)
 	}
 	return c
 }
 
-// Connect establishes a connection to the Incus daemon.
+// Connect establishes a connection to the Incus daemon unless one is already
+// open. While the daemon is unreachable it retries with capped exponential
+// backoff, see WithConnectRetry; configuration errors are not retried. Other
+// methods connect lazily and do not retry.
 func (c *clientImpl) Connect(ctx context.Context) error {
-	if c.server != nil {
+	attempts := max(c.connectAttempts, 1)
+	delay := connectRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		_, err := c.getServer(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt == attempts || ctx.Err() != nil || !isConnectionError(err) || errors.Is(err, errServerCertMismatch) {
+			return fmt.Errorf("failed to connect to Incus after %d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(min(delay, c.connectMaxDelay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("failed to connect to Incus after %d attempts: %w", attempt, errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// Ping requests the server environment, the cheapest call the Incus API
+// offers, connecting first if there is no connection. The request itself
+// cannot be cancelled, so it is left to finish in the background when ctx
+// is done first.
+func (c *clientImpl) Ping(ctx context.Context) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := server.GetServer()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to ping Incus: %w", c.apiError(server, err))
+		}
 		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to ping Incus: %w: %w", ErrConnection, ctx.Err())
+	}
+}
+
+// getServer returns the open connection to the Incus daemon, connecting first
+// if there is none.
+func (c *clientImpl) getServer(ctx context.Context) (incus.InstanceServer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.server != nil {
+		return c.server, nil
 	}
-	args := &incus.ConnectionArgs{}
-	if ctx != nil {
-		args = &incus.ConnectionArgs{}
+	dialCtx := ctx
+	if c.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, c.connectTimeout)
+		defer cancel()
 	}
-	server, err := incus.ConnectIncusUnixWithContext(ctx, c.socketPath, args)
+	server, err := c.dial(dialCtx)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Incus: %w", err)
+		return nil, err
+	}
+	if c.project != "" {
+		server = server.UseProject(c.project)
 	}
 	c.server = server
-	return nil
+	return server, nil
 }
 
-// CreateInstance creates a new Incus VM instance from an image.
-func (c *clientImpl) CreateInstance(ctx context.Context, name, image string, cpus, memoryMiB, rootDiskSizeGiB int) error {
-	if err := c.Connect(ctx); err != nil {
-		return err
+// UseProject returns a client scoped to the named project. It has the
+// settings of c and is cached, so repeated calls share one connection.
+func (c *clientImpl) UseProject(name string) Client {
+	if name == "" || name == c.project {
+		return c
 	}
 
-	// Default to reasonable values if not specified
-	if cpus < 1 {
-		cpus = 2
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.projects[name]; ok {
+		return p
 	}
-	if memoryMiB < 1 {
-		memoryMiB = 2048
+	if c.projects == nil {
+		c.projects = map[string]*clientImpl{}
 	}
-	if image == "" {
-		image = "images:ubuntu/24.04"
+	p := &clientImpl{
+		clientConfig: c.clientConfig,
+		dial:         c.dial,
+		project:      name,
 	}
+	c.projects[name] = p
+	return p
+}
 
-	instancePut := api.InstancePut{
-		Config: map[string]string{
-			"limits.cpu":          fmt.Sprintf("%d", cpus),
-			"limits.memory":       fmt.Sprintf("%dMiB", memoryMiB),
-			"security.secureboot": "false",
-		},
-		Profiles: []string{"default"},
+// lockInstance takes the lock of the named instance and then a slot for a
+// mutating operation on the server. The returned function releases both.
+func (c *clientImpl) lockInstance(ctx context.Context, name string) (func(), error) {
+	unlock, err := c.instanceLocks.lock(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	release, err := c.operations.acquire(ctx)
+	if err != nil {
+		unlock()
+		return nil, err
 	}
+	return func() {
+		release()
+		unlock()
+	}, nil
+}
 
-	// Override root disk size if specified
-	if rootDiskSizeGiB > 0 {
-		instancePut.Devices = map[string]map[string]string{
-			"root": {
-				"type": "disk",
-				"pool": "default",
-				"path": "/",
-				"size": fmt.Sprintf("%dGiB", rootDiskSizeGiB),
-			},
-		}
+// apiError classifies err returned by server. If it shows the connection
+// itself is broken, e.g. because the daemon restarted, server is forgotten so
+// that the next call reconnects, and the error wraps ErrConnection. API errors
+// leave the connection in place; those that show the daemon is temporarily
+// unavailable wrap ErrTransient, others are returned unchanged.
+func (c *clientImpl) apiError(server incus.InstanceServer, err error) error {
+	if isTransientError(err) {
+		return fmt.Errorf("%w: %w", ErrTransient, err)
+	}
+	if !isConnectionError(err) {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.server == server {
+		c.server = nil
+	}
+	return fmt.Errorf("%w: %w", ErrConnection, err)
+}
+
+// instanceError is apiError for requests about the named instance; a 404
+// wraps ErrInstanceNotFound.
+func (c *clientImpl) instanceError(server incus.InstanceServer, name string, err error) error {
+	if api.StatusErrorCheck(err, http.StatusNotFound) {
+		return fmt.Errorf("%w: %s: %w", ErrInstanceNotFound, name, err)
 	}
+	return c.apiError(server, err)
+}
 
-	req := api.InstancesPost{
-		Name:         name,
-		Type:         api.InstanceTypeVM,
-		InstancePut:  instancePut,
-		Source: api.InstanceSource{
-			Type:  "image",
-			Alias: image,
-		},
-		Start: true,
+// createError is apiError for requests creating an instance; a 400 or 404,
+// e.g. for an image or profile that does not exist, wraps ErrInvalidRequest.
+func (c *clientImpl) createError(server incus.InstanceServer, err error) error {
+	if api.StatusErrorCheck(err, http.StatusBadRequest, http.StatusNotFound) {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
 	}
+	return c.apiError(server, err)
+}
+
+// isTransientError reports whether err is an API error showing that the
+// daemon could not serve the request at the moment.
+func isTransientError(err error) bool {
+	return api.StatusErrorCheck(err, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+}
 
-	op, err := c.server.CreateInstance(req)
+// closeIdleConnections closes the idle connections of server's HTTP client.
+// Unlike Disconnect, it does not disturb requests or event listeners in use.
+func closeIdleConnections(server incus.InstanceServer) {
+	httpClient, err := server.GetHTTPClient()
 	if err != nil {
-		return fmt.Errorf("failed to create instance: %w", err)
+		return
+	}
+	httpClient.CloseIdleConnections()
+}
+
+// isConnectionError reports whether err was raised by the transport rather
+// than returned by the Incus API.
+func isConnectionError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// isConflictError reports whether err is a 409 Conflict, which Incus answers
+// when the name of an object it is asked to create is taken.
+func isConflictError(err error) bool {
+	return api.StatusErrorCheck(err, http.StatusConflict)
+}
+
+// connect opens a new connection to the configured Incus daemon.
+func (c *clientImpl) connect(ctx context.Context) (incus.InstanceServer, error) {
+	if err := c.validateConnection(); err != nil {
+		return nil, err
+	}
+
+	args := &incus.ConnectionArgs{
+		UserAgent: c.userAgent,
+		// The Incus library installs its own transport on this client.
+		HTTPClient: &http.Client{Timeout: c.httpTimeout},
 	}
 
-	if err := op.Wait(); err != nil {
-		return fmt.Errorf("failed waiting for instance creation: %w", err)
+	var server incus.InstanceServer
+	var err error
+	if c.remoteURL != "" {
+		args.TLSClientCert = c.tlsClientCert
+		args.TLSClientKey = c.tlsClientKey
+		args.TLSServerCert = c.tlsServerCert
+		args.InsecureSkipVerify = c.insecureSkipVerify
+		if c.serverCertFingerprint != "" {
+			args.TransportWrapper = pinServerCert(c.serverCertFingerprint)
+		}
+		server, err = incus.ConnectIncusWithContext(ctx, c.remoteURL, args)
+	} else {
+		server, err = incus.ConnectIncusUnixWithContext(ctx, c.socketPath, args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+	// The connection keeps the context it was made with for all later
+	// requests; it must outlive the call that happened to open it.
+	if s, ok := server.(interface {
+		WithContext(ctx context.Context) incus.InstanceServer
+	}); ok {
+		server = s.WithContext(context.Background())
 	}
+	return server, nil
+}
 
+// validateConnection checks that the client is configured for either the
+// local unix socket (an empty path selects the Incus default) or a complete
+// remote endpoint with at most one way of trusting the server.
+func (c *clientImpl) validateConnection() error {
+	remote := c.remoteURL != "" || c.tlsClientCert != "" || c.tlsClientKey != "" || c.tlsServerCert != "" ||
+		c.serverCertFingerprint != "" || c.insecureSkipVerify
+	if !remote {
+		return nil
+	}
+	if c.remoteURL == "" || c.tlsClientCert == "" || c.tlsClientKey == "" {
+		return fmt.Errorf("incomplete remote Incus configuration: a URL, client certificate and client key are required")
+	}
+	if !strings.HasPrefix(c.remoteURL, "https://") {
+		return fmt.Errorf("remote Incus URL %q must use https", c.remoteURL)
+	}
+	trust := 0
+	for _, set := range []bool{c.tlsServerCert != "", c.serverCertFingerprint != "", c.insecureSkipVerify} {
+		if set {
+			trust++
+		}
+	}
+	if trust > 1 {
+		return fmt.Errorf("conflicting remote Incus configuration: set at most one of a server certificate, its fingerprint and insecure skip verify")
+	}
+	if c.serverCertFingerprint != "" && !fingerprintPattern.MatchString(c.serverCertFingerprint) {
+		return fmt.Errorf("server certificate fingerprint %q is not a SHA-256 fingerprint", c.serverCertFingerprint)
+	}
 	return nil
 }
 
-// DeleteInstance deletes an Incus instance.
-func (c *clientImpl) DeleteInstance(ctx context.Context, name string) error {
-	if err := c.Connect(ctx); err != nil {
+// fingerprintPattern matches a SHA-256 fingerprint in lower case hex.
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errServerCertMismatch is returned when the remote server presents a
+// certificate other than the pinned one.
+var errServerCertMismatch = errors.New("server certificate does not match the pinned fingerprint")
+
+// pinServerCert returns a transport wrapper that accepts only a server
+// certificate with the SHA-256 fingerprint, in place of the usual chain and
+// host name checks.
+func pinServerCert(fingerprint string) func(*http.Transport) incus.HTTPTransporter {
+	return func(t *http.Transport) incus.HTTPTransporter {
+		t.TLSClientConfig.InsecureSkipVerify = true
+		t.TLSClientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errServerCertMismatch
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if got := hex.EncodeToString(sum[:]); got != fingerprint {
+				return fmt.Errorf("%w: got %s", errServerCertMismatch, got)
+			}
+			return nil
+		}
+		return pinnedTransport{transport: t}
+	}
+}
+
+// pinnedTransport is the http.Transport of a connection with a pinned server
+// certificate.
+type pinnedTransport struct {
+	transport *http.Transport
+}
+
+// RoundTrip sends req over the wrapped transport.
+func (t pinnedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport.RoundTrip(req)
+}
+
+// Transport returns the wrapped transport.
+func (t pinnedTransport) Transport() *http.Transport {
+	return t.transport
+}
+
+// PlanInstance returns the request CreateInstance would submit for req,
+// without contacting the Incus server. The cluster member selected by
+// req.Target is not part of the request, and a root disk override is planned
+// on top of a root disk in the "default" pool rather than the one the
+// profiles define.
+func (c *clientImpl) PlanInstance(_ context.Context, req CreateInstanceRequest) (api.InstancesPost, error) {
+	return instancesPost(req, nil)
+}
+
+// CreateInstance creates a new Incus VM instance from an image.
+func (c *clientImpl) CreateInstance(ctx context.Context, req CreateInstanceRequest) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, req.Name)
+	if err != nil {
 		return err
 	}
+	defer unlock()
+
+	var profileRoot map[string]string
+	if overridesRootDisk(req) {
+		profileRoot, err = c.profileRootDevice(server, req.Profiles)
+		if err != nil {
+			return err
+		}
+	}
+	post, err := instancesPost(req, profileRoot)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
 
-	op, err := c.server.DeleteInstance(name)
+	target := server
+	if req.Target != "" {
+		target = server.UseTarget(req.Target)
+	}
+	if len(req.DataDisks) > 0 {
+		// The data volumes are named after the instance; created for a
+		// name that is taken, they would be left behind on every retry.
+		if _, _, err := server.GetInstance(req.Name); err == nil {
+			return fmt.Errorf("%w: %s", ErrInstanceExists, req.Name)
+		} else if !api.StatusErrorCheck(err, http.StatusNotFound) {
+			return fmt.Errorf("failed to look up instance %s: %w", req.Name, c.apiError(server, err))
+		}
+		if err := c.createDataVolumes(target, req); err != nil {
+			return err
+		}
+	}
+	op, err := target.CreateInstance(post)
 	if err != nil {
-		return fmt.Errorf("failed to delete instance: %w", err)
+		if isConflictError(err) {
+			return fmt.Errorf("%w: %s", ErrInstanceExists, req.Name)
+		}
+		return fmt.Errorf("failed to create instance: %w", c.createError(server, err))
 	}
 
-	if err := op.Wait(); err != nil {
-		return fmt.Errorf("failed waiting for instance deletion: %w", err)
+	if err := waitOperation(ctx, op); err != nil {
+		if isConflictError(err) {
+			return fmt.Errorf("%w: %s", ErrInstanceExists, req.Name)
+		}
+		if ctx.Err() != nil {
+			// The creation was cancelled, but may have got far enough to
+			// leave an instance behind that nobody would manage.
+			cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abandonedCreateCleanupTimeout)
+			defer cancel()
+			if cleanupErr := c.deleteInstance(cleanupCtx, server, req.Name); cleanupErr != nil && !errors.Is(cleanupErr, ErrInstanceNotFound) {
+				return fmt.Errorf("failed waiting for instance creation: %w; failed to remove the abandoned instance: %w", c.apiError(server, err), cleanupErr)
+			}
+		}
+		return fmt.Errorf("failed waiting for instance creation: %w", c.apiError(server, err))
 	}
 
 	return nil
 }
 
-// InstanceExists checks if an instance exists.
-func (c *clientImpl) InstanceExists(ctx context.Context, name string) (bool, error) {
-	if err := c.Connect(ctx); err != nil {
-		return false, err
+// waitOperation waits for op to finish. If ctx is done first, op is cancelled
+// so that Incus does not carry on unattended; operations Incus cannot cancel
+// keep running.
+func waitOperation(ctx context.Context, op incus.Operation) error {
+	err := op.WaitContext(ctx)
+	if err != nil && ctx.Err() != nil {
+		_ = op.Cancel()
 	}
+	return err
+}
 
-	_, _, err := c.server.GetInstance(name)
-	if err != nil {
-		if api.StatusErrorCheck(err, http.StatusNotFound) {
-			return false, nil
+// profileRootDevice returns the root disk the instance inherits from the
+// named profiles, or nil if none of them has one. Like Incus, a later profile
+// overrides an earlier one.
+func (c *clientImpl) profileRootDevice(server incus.InstanceServer, profiles []string) (map[string]string, error) {
+	if len(profiles) == 0 {
+		profiles = []string{"default"}
+	}
+	var root map[string]string
+	for _, name := range profiles {
+		profile, _, err := server.GetProfile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get profile %s: %w", name, c.apiError(server, err))
+		}
+		if device, ok := profile.Devices["root"]; ok {
+			root = device
 		}
-		return false, err
 	}
-	return true, nil
+	return root, nil
 }
 
-// Close closes the connection. The Incus client doesn't expose a close method,
-// but we clear the reference for consistency.
-func (c *clientImpl) Close() error {
-	c.server = nil
+// overridesRootDisk reports whether req changes the root disk inherited from
+// the profiles, rather than one given in req.Devices.
+func overridesRootDisk(req CreateInstanceRequest) bool {
+	_, explicit := req.Devices["root"]
+	return !explicit && changesRootDisk(req)
+}
+
+// changesRootDisk reports whether req sets the size, pool or IO limits of
+// the root disk.
+func changesRootDisk(req CreateInstanceRequest) bool {
+	return req.RootDiskSizeGiB > 0 || req.StoragePool != "" ||
+		req.RootDiskReadIOPS > 0 || req.RootDiskWriteIOPS > 0 ||
+		req.RootDiskReadBps > 0 || req.RootDiskWriteBps > 0 ||
+		req.RootDiskMaxIOPS > 0 || req.RootDiskMaxBps > 0
+}
+
+// rootDevice returns a copy of the root disk base with the size, pool and
+// IO limits requested by req. Without a base it starts from a root disk in
+// the "default" pool.
+func rootDevice(req CreateInstanceRequest, base map[string]string) map[string]string {
+	root := maps.Clone(base)
+	if root == nil {
+		root = map[string]string{"type": "disk", "pool": "default", "path": "/"}
+	}
+	if req.StoragePool != "" {
+		root["pool"] = req.StoragePool
+	}
+	if req.RootDiskSizeGiB > 0 {
+		root["size"] = fmt.Sprintf("%dGiB", req.RootDiskSizeGiB)
+	}
+	if limit := ioLimit(req.RootDiskReadIOPS, req.RootDiskReadBps); limit != "" {
+		root["limits.read"] = limit
+	}
+	if limit := ioLimit(req.RootDiskWriteIOPS, req.RootDiskWriteBps); limit != "" {
+		root["limits.write"] = limit
+	}
+	if limit := ioLimit(req.RootDiskMaxIOPS, req.RootDiskMaxBps); limit != "" {
+		root["limits.max"] = limit
+	}
+	return root
+}
+
+// ioLimit returns the value of a disk limits.read, limits.write or limits.max
+// key for a cap of iops operations or bps bytes per second, or "" if neither
+// is set.
+func ioLimit(iops, bps int64) string {
+	switch {
+	case iops > 0:
+		return fmt.Sprintf("%diops", iops)
+	case bps > 0:
+		return fmt.Sprintf("%dB", bps)
+	default:
+		return ""
+	}
+}
+
+// instancesPost builds the request CreateInstance submits for req. profileRoot
+// is the root disk inherited from the profiles, if known.
+func instancesPost(req CreateInstanceRequest, profileRoot map[string]string) (api.InstancesPost, error) {
+	name, image := req.Name, req.Image
+	cpus, memoryMiB := req.CPUs, req.MemoryMiB
+
+	if req.NUMANodes != "" {
+		if err := validateNodeSet(req.NUMANodes); err != nil {
+			return api.InstancesPost{}, fmt.Errorf("invalid NUMA node set: %w", err)
+		}
+	}
+	if req.CPUPinning != "" {
+		if err := validateNodeSet(req.CPUPinning); err != nil {
+			return api.InstancesPost{}, fmt.Errorf("invalid CPU set: %w", err)
+		}
+	}
+
+	instanceType, err := parseInstanceType(req.InstanceType)
+	if err != nil {
+		return api.InstancesPost{}, err
+	}
+	source, err := imageSource(image, req.ImageServer, req.ImageProtocol)
+	if err != nil {
+		return api.InstancesPost{}, err
+	}
+	if instanceType == api.InstanceTypeContainer && (req.MemoryBallooning != nil || req.CloudInitDatasource != "" || req.SecureBoot != nil) {
+		return api.InstancesPost{}, fmt.Errorf("memory ballooning, the cloud-init datasource hint and secure boot only apply to virtual machines")
+	}
+	if instanceType == api.InstanceTypeVM && (req.Nesting || req.Privileged || req.MemorySwap != nil || req.MemoryEnforce != "") {
+		return api.InstancesPost{}, fmt.Errorf("nesting, privileged mode and memory swap and enforcement only apply to containers")
+	}
+	if (req.RootDiskReadIOPS > 0 && req.RootDiskReadBps > 0) || (req.RootDiskWriteIOPS > 0 && req.RootDiskWriteBps > 0) ||
+		(req.RootDiskMaxIOPS > 0 && req.RootDiskMaxBps > 0) {
+		return api.InstancesPost{}, fmt.Errorf("a root disk IO limit is either in operations or in bytes per second, not both")
+	}
+	if (req.RootDiskMaxIOPS > 0 || req.RootDiskMaxBps > 0) &&
+		(req.RootDiskReadIOPS > 0 || req.RootDiskWriteIOPS > 0 || req.RootDiskReadBps > 0 || req.RootDiskWriteBps > 0) {
+		return api.InstancesPost{}, fmt.Errorf("the overall root disk IO limit cannot be combined with read and write limits")
+	}
+	if req.RootDiskReadIOPS < 0 || req.RootDiskWriteIOPS < 0 || req.RootDiskReadBps < 0 || req.RootDiskWriteBps < 0 ||
+		req.RootDiskMaxIOPS < 0 || req.RootDiskMaxBps < 0 {
+		return api.InstancesPost{}, fmt.Errorf("root disk IO limits must not be negative")
+	}
+	if req.MemoryEnforce != "" && req.MemoryEnforce != "hard" && req.MemoryEnforce != "soft" {
+		return api.InstancesPost{}, fmt.Errorf("invalid memory enforcement %q: must be hard or soft", req.MemoryEnforce)
+	}
+	if len(req.DNSServers) > 0 && req.NetworkConfig != "" {
+		return api.InstancesPost{}, fmt.Errorf("DNS servers cannot be combined with a network config; set its nameservers instead")
+	}
+	for _, server := range req.DNSServers {
+		if net.ParseIP(server) == nil {
+			return api.InstancesPost{}, fmt.Errorf("invalid DNS server %q: must be an IP address", server)
+		}
+	}
+
+	// Default to reasonable values if not specified
+	if cpus < 1 {
+		cpus = 2
+	}
+	if memoryMiB < 1 {
+		memoryMiB = 2048
+	}
+
+	instancePut := api.InstancePut{
+		Description: req.Description,
+		Config:      resourceLimits(CPULimit(cpus, req.CPUPinning), memoryMiB),
+		Profiles:    req.Profiles,
+	}
+	if len(instancePut.Profiles) == 0 {
+		instancePut.Profiles = []string{"default"}
+	}
+	// Secure boot is a VM firmware setting. It is off unless requested.
+	if instanceType == api.InstanceTypeVM {
+		instancePut.Config["security.secureboot"] = "false"
+	}
+	for k, v := range req.Config {
+		instancePut.Config[k] = v
+	}
+	if req.NUMANodes != "" {
+		instancePut.Config["limits.cpu.nodes"] = req.NUMANodes
+	}
+	if req.SecureBoot != nil {
+		instancePut.Config["security.secureboot"] = strconv.FormatBool(*req.SecureBoot)
+	}
+	if req.Nesting {
+		instancePut.Config["security.nesting"] = "true"
+	}
+	if req.Privileged {
+		instancePut.Config["security.privileged"] = "true"
+	}
+	if req.MemorySwap != nil {
+		instancePut.Config["limits.memory.swap"] = strconv.FormatBool(*req.MemorySwap)
+	}
+	if req.MemoryEnforce != "" {
+		instancePut.Config["limits.memory.enforce"] = req.MemoryEnforce
+	}
+	if req.BootAutostart != nil {
+		instancePut.Config["boot.autostart"] = strconv.FormatBool(*req.BootAutostart)
+	}
+	if req.BootPriority > 0 {
+		instancePut.Config["boot.autostart.priority"] = strconv.Itoa(req.BootPriority)
+	}
+	if req.UserData != "" {
+		instancePut.Config["cloud-init.user-data"] = req.UserData
+	}
+	if req.VendorData != "" {
+		if strings.HasPrefix(req.VendorData, "#cloud-config") {
+			if err := validateYAMLMapping(req.VendorData); err != nil {
+				return api.InstancesPost{}, fmt.Errorf("invalid cloud-init vendor-data: %w", err)
+			}
+		}
+		instancePut.Config["cloud-init.vendor-data"] = req.VendorData
+	}
+	if req.NetworkConfig != "" {
+		if err := validateYAMLMapping(req.NetworkConfig); err != nil {
+			return api.InstancesPost{}, fmt.Errorf("invalid cloud-init network-config: %w", err)
+		}
+		instancePut.Config["cloud-init.network-config"] = req.NetworkConfig
+	}
+	if len(req.DNSServers) > 0 {
+		networkConfig, err := dnsNetworkConfig(req.DNSServers)
+		if err != nil {
+			return api.InstancesPost{}, err
+		}
+		instancePut.Config["cloud-init.network-config"] = networkConfig
+	}
+	if req.Hostname != "" {
+		// Incus appends user.meta-data to the meta-data it generates, and
+		// the last local-hostname wins.
+		instancePut.Config["user.meta-data"] = appendLine(instancePut.Config["user.meta-data"], "local-hostname: "+req.Hostname)
+	}
+	if req.MemoryBallooning != nil && !*req.MemoryBallooning {
+		instancePut.Config["raw.qemu.conf"] = appendLine(instancePut.Config["raw.qemu.conf"], qemuBalloonSection)
+	}
+	if req.CloudInitDatasource != "" {
+		hint := fmt.Sprintf("-smbios type=1,serial=ds=%s", req.CloudInitDatasource)
+		instancePut.Config["raw.qemu"] = strings.TrimSpace(instancePut.Config["raw.qemu"] + " " + hint)
+	}
+
+	instancePut.Devices = map[string]map[string]string{}
+	for name, device := range req.Devices {
+		instancePut.Devices[name] = device
+	}
+
+	// An instance device replaces the profile device of the same name
+	// wholesale, so the override starts from the root disk the instance
+	// would otherwise get.
+	if changesRootDisk(req) {
+		base := profileRoot
+		if root, ok := req.Devices["root"]; ok {
+			base = root
+		}
+		instancePut.Devices["root"] = rootDevice(req, base)
+	}
+
+	// Overrides the eth0 NIC of the default profile.
+	if req.Network != "" {
+		instancePut.Devices["eth0"] = map[string]string{
+			"type":    "nic",
+			"name":    "eth0",
+			"network": req.Network,
+		}
+	}
+
+	for _, nic := range req.NetworkInterfaces {
+		network := nic.Network
+		if network == "" {
+			network = req.Network
+		}
+		if network == "" {
+			return api.InstancesPost{}, fmt.Errorf("network interface %s must name a network", nic.Name)
+		}
+		device := map[string]string{
+			"type":    "nic",
+			"name":    nic.Name,
+			"network": network,
+		}
+		if nic.IPv4Address != "" {
+			device["ipv4.address"] = nic.IPv4Address
+		}
+		if nic.HWAddr != "" {
+			device["hwaddr"] = nic.HWAddr
+		}
+		instancePut.Devices[nic.Name] = device
+	}
+
+	for i, disk := range req.DataDisks {
+		switch {
+		case disk.SizeGiB < 1:
+			return api.InstancesPost{}, fmt.Errorf("data disk %d must have a positive size", i)
+		case disk.Pool == "":
+			return api.InstancesPost{}, fmt.Errorf("data disk %d must name a storage pool", i)
+		case disk.Path == "" && instanceType == api.InstanceTypeContainer:
+			return api.InstancesPost{}, fmt.Errorf("data disk %d needs a path, containers cannot attach block devices", i)
+		}
+		device := map[string]string{
+			"type":   "disk",
+			"pool":   disk.Pool,
+			"source": dataVolumeName(name, i),
+		}
+		if disk.Path != "" {
+			device["path"] = disk.Path
+		}
+		instancePut.Devices[DataDeviceName(i)] = device
+	}
+
+	for i, gpu := range req.GPUs {
+		switch {
+		case gpu.Product != "" && gpu.Vendor == "":
+			return api.InstancesPost{}, fmt.Errorf("GPU %d selects a product without a vendor", i)
+		case gpu.PCI == "" && gpu.Vendor == "" && instanceType == api.InstanceTypeVM:
+			return api.InstancesPost{}, fmt.Errorf("GPU %d must select a GPU by PCI address or vendor, virtual machines cannot take every GPU", i)
+		}
+		device := map[string]string{
+			"type":    "gpu",
+			"gputype": "physical",
+		}
+		if gpu.Vendor != "" {
+			device["vendorid"] = gpu.Vendor
+		}
+		if gpu.Product != "" {
+			device["productid"] = gpu.Product
+		}
+		if gpu.PCI != "" {
+			device["pci"] = gpu.PCI
+		}
+		instancePut.Devices[GPUDeviceName(i)] = device
+	}
+
+	return api.InstancesPost{
+		Name:        name,
+		Type:        instanceType,
+		InstancePut: instancePut,
+		Source:      source,
+		Start:       true,
+	}, nil
+}
+
+// DataDeviceName returns the device name of the data disk at index i.
+func DataDeviceName(i int) string {
+	return fmt.Sprintf("data%d", i)
+}
+
+// GPUDeviceName returns the device name of the GPU at index i.
+func GPUDeviceName(i int) string {
+	return fmt.Sprintf("gpu%d", i)
+}
+
+// dataVolumeName returns the name of the custom volume backing the data disk
+// at index i of the named instance.
+func dataVolumeName(instance string, i int) string {
+	return fmt.Sprintf("%s-%s", instance, DataDeviceName(i))
+}
+
+// createDataVolumes creates the custom volumes backing the data disks of req.
+// Volumes left behind by an earlier attempt are reused.
+func (c *clientImpl) createDataVolumes(server incus.InstanceServer, req CreateInstanceRequest) error {
+	for i, disk := range req.DataDisks {
+		contentType := "block"
+		if disk.Path != "" {
+			contentType = "filesystem"
+		}
+		volume := api.StorageVolumesPost{
+			Name:        dataVolumeName(req.Name, i),
+			Type:        "custom",
+			ContentType: contentType,
+			StorageVolumePut: api.StorageVolumePut{
+				Config: map[string]string{"size": fmt.Sprintf("%dGiB", disk.SizeGiB)},
+			},
+		}
+		err := server.CreateStoragePoolVolume(disk.Pool, volume)
+		if err != nil && !isConflictError(err) {
+			return fmt.Errorf("failed to create volume %s in pool %s: %w", volume.Name, disk.Pool, c.apiError(server, err))
+		}
+	}
+	return nil
+}
+
+// deleteDataVolumes deletes the custom volumes backing the data disks of the
+// named instance, found among its devices. Volumes that are already gone are
+// skipped.
+func (c *clientImpl) deleteDataVolumes(server incus.InstanceServer, name string, devices map[string]map[string]string) error {
+	for i := 0; ; i++ {
+		device, ok := devices[DataDeviceName(i)]
+		if !ok {
+			return nil
+		}
+		volume := dataVolumeName(name, i)
+		if device["type"] != "disk" || device["source"] != volume || device["pool"] == "" {
+			continue
+		}
+		err := server.DeleteStoragePoolVolume(device["pool"], "custom", volume)
+		if err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+			return fmt.Errorf("failed to delete volume %s in pool %s: %w", volume, device["pool"], c.apiError(server, err))
+		}
+	}
+}
+
+// imageSource returns the instance source for image, an alias or fingerprint,
+// on the given image server. Without a server the image is resolved by the
+// Incus server itself.
+func imageSource(image, server, protocol string) (api.InstanceSource, error) {
+	if image == "" {
+		image = "images:ubuntu/24.04"
+	}
+	source := api.InstanceSource{Type: "image"}
+	if server != "" {
+		switch protocol {
+		case "":
+			protocol = "simplestreams"
+		case "simplestreams", "incus":
+		default:
+			return source, fmt.Errorf("unsupported image server protocol %q", protocol)
+		}
+		source.Server = server
+		source.Protocol = protocol
+	}
+	if isFingerprint(image) {
+		source.Fingerprint = image
+	} else {
+		source.Alias = image
+	}
+	return source, nil
+}
+
+// isFingerprint reports whether image looks like an image fingerprint or an
+// unambiguous prefix of one, rather than an alias.
+func isFingerprint(image string) bool {
+	if len(image) < 12 || len(image) > 64 {
+		return false
+	}
+	for _, r := range image {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseInstanceType maps an instance type name to its api.InstanceType,
+// defaulting to a virtual machine.
+func parseInstanceType(name string) (api.InstanceType, error) {
+	switch api.InstanceType(name) {
+	case "", api.InstanceTypeVM:
+		return api.InstanceTypeVM, nil
+	case api.InstanceTypeContainer:
+		return api.InstanceTypeContainer, nil
+	default:
+		return "", fmt.Errorf("unknown instance type %q", name)
+	}
+}
+
+// maxInstanceNameLength is the longest instance name Incus accepts.
+const maxInstanceNameLength = 63
+
+// SanitizeInstanceName returns an Incus instance name for an object named
+// name. Names Incus already accepts are returned unchanged. Otherwise every
+// character other than a letter, digit or hyphen is replaced with a hyphen,
+// the result is shortened to fit the length limit and a hash of the original
+// name is appended, so that distinct names cannot map to the same instance.
+func SanitizeInstanceName(name string) string {
+	if validInstanceName(name) {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+
+	base := strings.Map(func(r rune) rune {
+		if r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, name)
+	base = strings.Trim(base, "-")
+	if len(base) > maxInstanceNameLength-len(suffix) {
+		base = strings.TrimRight(base[:maxInstanceNameLength-len(suffix)], "-")
+	}
+	if base == "" {
+		base = "instance"
+	}
+	return base + suffix
+}
+
+// validInstanceName mirrors the hostname rules Incus applies to instance
+// names.
+func validInstanceName(name string) bool {
+	if len(name) < 1 || len(name) > maxInstanceNameLength {
+		return false
+	}
+	if strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") {
+		return false
+	}
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return false
+	}
+	for _, r := range name {
+		if r != '-' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateNodeSet checks a comma separated list of NUMA node or CPU IDs and
+// ranges such as "0", "0,1" or "0-3,6".
+func validateNodeSet(set string) error {
+	for _, part := range strings.Split(set, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return fmt.Errorf("%q is not a node ID", lo)
+		}
+		if !isRange {
+			continue
+		}
+		last, err := strconv.Atoi(hi)
+		if err != nil || last < 0 {
+			return fmt.Errorf("%q is not a node ID", hi)
+		}
+		if last < first {
+			return fmt.Errorf("range %q is reversed", part)
+		}
+	}
+	return nil
+}
+
+// validateYAMLMapping checks that doc is a YAML document holding a mapping,
+// or nothing but comments.
+func validateYAMLMapping(doc string) error {
+	var m map[string]interface{}
+	return yaml.Unmarshal([]byte(doc), &m)
+}
+
+// dnsNetworkConfig returns a cloud-init network-config (v2) that configures
+// every ethernet interface through DHCP, with servers as its only resolvers.
+// Interfaces are matched by name since a virtual machine names them after
+// their PCI slot.
+func dnsNetworkConfig(servers []string) (string, error) {
+	noDNS := map[string]interface{}{"use-dns": false}
+	out, err := yaml.Marshal(map[string]interface{}{
+		"version": 2,
+		"ethernets": map[string]interface{}{
+			"all": map[string]interface{}{
+				"match":           map[string]interface{}{"name": "e*"},
+				"dhcp4":           true,
+				"dhcp4-overrides": noDNS,
+				"dhcp6":           true,
+				"dhcp6-overrides": noDNS,
+				"nameservers":     map[string]interface{}{"addresses": servers},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render network-config: %w", err)
+	}
+	return string(out), nil
+}
+
+// appendLine appends line to a multi-line config value.
+func appendLine(value, line string) string {
+	if value == "" {
+		return line
+	}
+	return value + "\n" + line
+}
+
+// DeleteInstance deletes an Incus instance.
+func (c *clientImpl) DeleteInstance(ctx context.Context, name string) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.deleteInstance(ctx, server, name)
+}
+
+// deleteInstance implements DeleteInstance; the caller holds the instance
+// lock.
+func (c *clientImpl) deleteInstance(ctx context.Context, server incus.InstanceServer, name string) error {
+	// The devices tell which data volumes to delete along with the instance.
+	inst, _, err := server.GetInstance(name)
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", c.instanceError(server, name, err))
+	}
+
+	// Incus refuses to delete a running instance.
+	if err := c.stopInstance(ctx, server, name, stopTimeout); err != nil {
+		return err
+	}
+
+	op, err := server.DeleteInstance(name)
+	if err != nil {
+		return fmt.Errorf("failed to delete instance: %w", c.instanceError(server, name, err))
+	}
+
+	if err := waitOperation(ctx, op); err != nil {
+		return fmt.Errorf("failed waiting for instance deletion: %w", c.instanceError(server, name, err))
+	}
+
+	// Volumes on a local pool of an Incus cluster live on the member that
+	// ran the instance.
+	volumeServer := server
+	if location := instanceLocation(inst.Location); location != "" {
+		volumeServer = server.UseTarget(location)
+	}
+	return c.deleteDataVolumes(volumeServer, name, inst.Devices)
+}
+
+// StopInstance stops a running instance, giving it timeout to shut down
+// cleanly before forcing it off. Stopping an instance that is not running is
+// a no-op.
+func (c *clientImpl) StopInstance(ctx context.Context, name string, timeout time.Duration) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.stopInstance(ctx, server, name, timeout)
+}
+
+// StartInstance starts a stopped instance. Starting an instance that is
+// already running is a no-op.
+func (c *clientImpl) StartInstance(ctx context.Context, name string) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, _, err := server.GetInstanceState(name)
+	if err != nil {
+		return fmt.Errorf("failed to get instance state: %w", c.instanceError(server, name, err))
+	}
+	if state.StatusCode == api.Running {
+		return nil
+	}
+	if err := c.updateInstanceState(ctx, server, name, api.InstanceStatePut{Action: "start"}); err != nil {
+		return fmt.Errorf("failed to start instance: %w", err)
+	}
+	return nil
+}
+
+// MoveInstance moves the named instance to targetMember. An instance that is
+// already there is left alone.
+func (c *clientImpl) MoveInstance(ctx context.Context, name, targetMember string) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inst, _, err := server.GetInstance(name)
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", c.instanceError(server, name, err))
+	}
+	if inst.Location == targetMember {
+		return nil
+	}
+
+	// Containers cannot be migrated live, so a running one is moved cold.
+	running := inst.StatusCode == api.Running
+	live := running && inst.Type == string(api.InstanceTypeVM)
+	if running && !live {
+		if err := c.stopInstance(ctx, server, name, stopTimeout); err != nil {
+			return err
+		}
+	}
+
+	op, err := server.UseTarget(targetMember).MigrateInstance(name, api.InstancePost{Name: name, Migration: true, Live: live})
+	if err != nil {
+		return fmt.Errorf("failed to move instance to %s: %w", targetMember, c.instanceError(server, name, err))
+	}
+	if err := waitOperation(ctx, op); err != nil {
+		return fmt.Errorf("failed waiting for instance move to %s: %w", targetMember, c.apiError(server, err))
+	}
+
+	if running && !live {
+		if err := c.updateInstanceState(ctx, server, name, api.InstanceStatePut{Action: "start"}); err != nil {
+			return fmt.Errorf("failed to start instance after moving it: %w", err)
+		}
+	}
+	return nil
+}
+
+// stopInstance implements StopInstance; the caller holds the instance lock.
+func (c *clientImpl) stopInstance(ctx context.Context, server incus.InstanceServer, name string, timeout time.Duration) error {
+	state, _, err := server.GetInstanceState(name)
+	if err != nil {
+		return fmt.Errorf("failed to get instance state: %w", c.instanceError(server, name, err))
+	}
+	if state.StatusCode == api.Stopped {
+		return nil
+	}
+
+	graceful := api.InstanceStatePut{Action: "stop", Timeout: int(timeout.Seconds())}
+	err = c.updateInstanceState(ctx, server, name, graceful)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to stop instance: %w", err)
+	}
+
+	if err := c.updateInstanceState(ctx, server, name, api.InstanceStatePut{Action: "stop", Force: true}); err != nil {
+		return fmt.Errorf("failed to stop instance: %w", err)
+	}
+	return nil
+}
+
+// updateInstanceState changes the instance state and waits for the operation.
+func (c *clientImpl) updateInstanceState(ctx context.Context, server incus.InstanceServer, name string, state api.InstanceStatePut) error {
+	op, err := server.UpdateInstanceState(name, state, "")
+	if err != nil {
+		return c.apiError(server, err)
+	}
+	if err := waitOperation(ctx, op); err != nil {
+		return c.apiError(server, err)
+	}
+	return nil
+}
+
+// InstanceExists checks if an instance exists.
+func (c *clientImpl) InstanceExists(ctx context.Context, name string) (bool, error) {
+	_, err := c.GetInstance(ctx, name)
+	if errors.Is(err, ErrInstanceNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetInstance returns the state and config of an instance in a single
+// request.
+func (c *clientImpl) GetInstance(ctx context.Context, name string) (*InstanceInfo, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inst, _, err := server.GetInstanceFull(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", c.instanceError(server, name, err))
+	}
+
+	info := &InstanceInfo{
+		Name:        inst.Name,
+		Type:        inst.Type,
+		Status:      inst.Status,
+		Location:    instanceLocation(inst.Location),
+		Config:      inst.Config,
+		Profiles:    inst.Profiles,
+		Devices:     inst.Devices,
+		CPULimit:    inst.ExpandedConfig["limits.cpu"],
+		MemoryLimit: inst.ExpandedConfig["limits.memory"],
+	}
+	if info.Config == nil {
+		info.Config = map[string]string{}
+	}
+	if inst.State != nil {
+		info.Addresses = globalAddresses(inst.State)
+	}
+	return info, nil
+}
+
+// GetInstanceConfig returns the config set on the instance itself, without
+// the keys inherited from its profiles. It returns nil if the instance does
+// not exist.
+func (c *clientImpl) GetInstanceConfig(ctx context.Context, name string) (map[string]string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inst, _, err := server.GetInstance(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, c.apiError(server, err)
+	}
+	if inst.Config == nil {
+		return map[string]string{}, nil
+	}
+	return inst.Config, nil
+}
+
+// NetworkExists checks whether an Incus network with the given name exists.
+func (c *clientImpl) NetworkExists(ctx context.Context, name string) (bool, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = server.GetNetwork(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, c.apiError(server, err)
+	}
+	return true, nil
+}
+
+// ProfileExists checks whether an Incus profile with the given name exists.
+func (c *clientImpl) ProfileExists(ctx context.Context, name string) (bool, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = server.GetProfile(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, c.apiError(server, err)
+	}
+	return true, nil
+}
+
+// ImageExists checks whether the Incus server has an image with the given
+// alias or fingerprint.
+func (c *clientImpl) ImageExists(ctx context.Context, image string) (bool, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if isFingerprint(image) {
+		_, _, err = server.GetImage(image)
+	} else {
+		_, _, err = server.GetImageAlias(image)
+	}
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, c.apiError(server, err)
+	}
+	return true, nil
+}
+
+// StoragePoolExists checks whether an Incus storage pool with the given name
+// exists.
+func (c *clientImpl) StoragePoolExists(ctx context.Context, name string) (bool, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = server.GetStoragePool(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, c.apiError(server, err)
+	}
+	return true, nil
+}
+
+// EnsureNetwork creates a managed bridge network with the given config unless
+// a network with that name already exists. It reports whether the network was
+// created.
+func (c *clientImpl) EnsureNetwork(ctx context.Context, name string, config map[string]string) (bool, error) {
+	exists, err := c.NetworkExists(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	post := api.NetworksPost{
+		Name: name,
+		Type: "bridge",
+		NetworkPut: api.NetworkPut{
+			Config: config,
+		},
+	}
+	if err := server.CreateNetwork(post); err != nil {
+		return false, fmt.Errorf("failed to create network: %w", c.apiError(server, err))
+	}
+	return true, nil
+}
+
+// NetworkConfig returns the config of the named network, or nil if the network
+// does not exist.
+func (c *clientImpl) NetworkConfig(ctx context.Context, name string) (map[string]string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	network, _, err := server.GetNetwork(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, c.apiError(server, err)
+	}
+	if network.Config == nil {
+		return map[string]string{}, nil
+	}
+	return network.Config, nil
+}
+
+// NetworkInstances returns the sorted names of the instances that use the named
+// network, as reported in its used_by list. A network that does not exist is
+// used by none.
+func (c *clientImpl) NetworkInstances(ctx context.Context, name string) ([]string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	network, _, err := server.GetNetwork(name)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, c.apiError(server, err)
+	}
+	var instances []string
+	for _, user := range network.UsedBy {
+		u, err := url.Parse(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse user %q of network %s: %w", user, name, err)
+		}
+		if instance, ok := strings.CutPrefix(u.Path, "/1.0/instances/"); ok {
+			instances = append(instances, instance)
+		}
+	}
+	slices.Sort(instances)
+	return instances, nil
+}
+
+// GetClusterMembers returns the name, status and load of every member of the
+// Incus cluster. A standalone server has no members.
+func (c *clientImpl) GetClusterMembers(ctx context.Context) ([]ClusterMember, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !server.IsClustered() {
+		return nil, nil
+	}
+
+	members, err := server.GetClusterMembers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster members: %w", c.apiError(server, err))
+	}
+	result := make([]ClusterMember, 0, len(members))
+	for _, m := range members {
+		member := ClusterMember{Name: m.ServerName, Status: m.Status}
+		if m.Status == "Online" {
+			state, _, err := server.GetClusterMemberState(m.ServerName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get state of cluster member %s: %w", m.ServerName, c.apiError(server, err))
+			}
+			if len(state.SysInfo.LoadAverages) > 0 {
+				member.Load = state.SysInfo.LoadAverages[0]
+			}
+		}
+		result = append(result, member)
+	}
+	return result, nil
+}
+
+// GetServerInfo returns the version, API extensions and storage driver of
+// the server. Virtual machines are supported if QEMU is among its instance
+// drivers.
+func (c *clientImpl) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, _, err := server.GetServer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server info: %w", c.apiError(server, err))
+	}
+	virtualMachines := false
+	for _, driver := range strings.Split(info.Environment.Driver, "|") {
+		if strings.TrimSpace(driver) == "qemu" {
+			virtualMachines = true
+		}
+	}
+	return &ServerInfo{
+		Version:         info.Environment.ServerVersion,
+		APIExtensions:   info.APIExtensions,
+		StorageDriver:   info.Environment.Storage,
+		VirtualMachines: virtualMachines,
+	}, nil
+}
+
+// DeleteNetwork deletes the named network. A network that does not exist is
+// not an error.
+func (c *clientImpl) DeleteNetwork(ctx context.Context, name string) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := server.DeleteNetwork(name); err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete network: %w", c.apiError(server, err))
+	}
+	return nil
+}
+
+// FindInstanceByConfig returns the name of the first instance whose config has
+// key set to value, or an empty string if no instance matches.
+func (c *clientImpl) FindInstanceByConfig(ctx context.Context, key, value string) (string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	instances, err := server.GetInstances(api.InstanceTypeAny)
+	if err != nil {
+		return "", fmt.Errorf("failed to list instances: %w", c.apiError(server, err))
+	}
+	for _, inst := range instances {
+		if inst.Config[key] == value {
+			return inst.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// ListInstances returns the instances whose config matches selector.
+func (c *clientImpl) ListInstances(ctx context.Context, selector map[string]string) ([]InstanceInfo, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := server.GetInstances(api.InstanceTypeAny)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", c.apiError(server, err))
+	}
+	var result []InstanceInfo
+	for _, inst := range instances {
+		if !matchesSelector(inst.Config, selector) {
+			continue
+		}
+		result = append(result, InstanceInfo{
+			Name:     inst.Name,
+			Type:     inst.Type,
+			Status:   inst.Status,
+			Location: instanceLocation(inst.Location),
+			Config:   inst.Config,
+		})
+	}
+	return result, nil
+}
+
+// matchesSelector reports whether config has every key of selector set to
+// its value.
+func matchesSelector(config, selector map[string]string) bool {
+	for k, v := range selector {
+		if config[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// InstanceLocation returns the cluster member the instance runs on, or an
+// empty string when the server is not clustered.
+func (c *clientImpl) InstanceLocation(ctx context.Context, name string) (string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	inst, _, err := server.GetInstance(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get instance: %w", c.instanceError(server, name, err))
+	}
+	return instanceLocation(inst.Location), nil
+}
+
+// instanceLocation returns the cluster member of an instance from the
+// location Incus reports. Standalone servers report the placeholder "none".
+func instanceLocation(location string) string {
+	if location == "none" {
+		return ""
+	}
+	return location
+}
+
+// GetInstanceState returns the status and IP addresses of an instance.
+// Loopback and link-local addresses are left out.
+func (c *clientImpl) GetInstanceState(ctx context.Context, name string) (*InstanceState, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := server.GetInstanceState(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance state: %w", c.instanceError(server, name, err))
+	}
+
+	return &InstanceState{Status: state.Status, Addresses: globalAddresses(state)}, nil
+}
+
+// GetConsoleLog returns the console log of the named instance.
+func (c *clientImpl) GetConsoleLog(ctx context.Context, name string) (string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	log, err := server.GetInstanceConsoleLog(name, &incus.InstanceConsoleLogArgs{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get console log: %w", c.instanceError(server, name, err))
+	}
+	defer func() { _ = log.Close() }()
+
+	content, err := io.ReadAll(log)
+	if err != nil {
+		return "", fmt.Errorf("failed to read console log: %w", err)
+	}
+	return string(content), nil
+}
+
+// Exec runs a command in the named instance.
+func (c *clientImpl) Exec(ctx context.Context, name string, cmd []string) (string, string, int, error) {
+	if len(cmd) == 0 {
+		return "", "", 0, fmt.Errorf("no command to run in instance %s", name)
+	}
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	dataDone := make(chan bool)
+	op, err := server.ExecInstance(name, api.InstanceExecPost{
+		Command:   cmd,
+		WaitForWS: true,
+	}, &incus.InstanceExecArgs{
+		Stdin:    bytes.NewReader(nil),
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+		DataDone: dataDone,
+	})
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to run command in instance: %w", c.instanceError(server, name, err))
+	}
+	if err := waitOperation(ctx, op); err != nil {
+		if ctx.Err() != nil {
+			return "", "", 0, fmt.Errorf("command in instance %s did not finish: %w", name, ctx.Err())
+		}
+		return "", "", 0, fmt.Errorf("failed to run command in instance: %w", c.apiError(server, err))
+	}
+	// The output may still be in flight once the operation has finished.
+	select {
+	case <-dataDone:
+	case <-ctx.Done():
+		return "", "", 0, fmt.Errorf("output of the command in instance %s did not arrive: %w", name, ctx.Err())
+	}
+
+	exitCode, ok := op.Get().Metadata["return"].(float64)
+	if !ok {
+		return "", "", 0, fmt.Errorf("Incus did not report the exit code of the command in instance %s", name)
+	}
+	return stdout.String(), stderr.String(), int(exitCode), nil
+}
+
+// globalAddresses returns the global IP addresses of an instance, ordered by
+// interface name.
+func globalAddresses(state *api.InstanceState) []string {
+	var addresses []string
+	for _, iface := range slices.Sorted(maps.Keys(state.Network)) {
+		for _, addr := range state.Network[iface].Addresses {
+			if addr.Scope != "global" {
+				continue
+			}
+			addresses = append(addresses, addr.Address)
+		}
+	}
+	return addresses
+}
+
+// InstanceWarnings returns the messages of unresolved server warnings raised
+// against the named instance of the client's project, such as deprecated or
+// ignored config keys.
+func (c *clientImpl) InstanceWarnings(ctx context.Context, name string) ([]string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings, err := server.GetWarnings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warnings: %w", c.apiError(server, err))
+	}
+
+	// An instance of the same name may exist in another project; its
+	// warnings only differ in their project.
+	project := c.project
+	if project == "" {
+		project = api.ProjectDefaultName
+	}
+	var messages []string
+	for _, w := range warnings {
+		if w.Status == "resolved" || w.Project != project {
+			continue
+		}
+		u, err := url.Parse(w.EntityURL)
+		if err != nil || u.Path != "/1.0/instances/"+name {
+			continue
+		}
+		messages = append(messages, w.LastMessage)
+	}
+	return messages, nil
+}
+
+// UpdateInstanceConfig sets the given config keys on an existing instance. An
+// empty value removes the key. The instance is only updated if a key actually
+// changes.
+func (c *clientImpl) UpdateInstanceConfig(ctx context.Context, name string, config map[string]string) error {
+	return c.updateInstance(ctx, name, func(put *api.InstancePut) bool {
+		if put.Config == nil {
+			put.Config = map[string]string{}
+		}
+		changed := false
+		for k, v := range config {
+			current, ok := put.Config[k]
+			switch {
+			case v == "" && ok:
+				delete(put.Config, k)
+				changed = true
+			case v != "" && current != v:
+				put.Config[k] = v
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// UpdateInstanceProfiles replaces the profiles of an existing instance. The
+// instance is only updated if the list actually changes.
+func (c *clientImpl) UpdateInstanceProfiles(ctx context.Context, name string, profiles []string) error {
+	return c.updateInstance(ctx, name, func(put *api.InstancePut) bool {
+		if slices.Equal(put.Profiles, profiles) {
+			return false
+		}
+		put.Profiles = profiles
+		return true
+	})
+}
+
+// UpdateInstanceDevices sets the given devices on an existing instance. A nil
+// device removes the device of that name. Incus hot-plugs the changes into a
+// running instance where the device type allows it and rejects them
+// otherwise. The instance is only updated if a device actually changes.
+func (c *clientImpl) UpdateInstanceDevices(ctx context.Context, name string, devices map[string]map[string]string) error {
+	return c.updateInstance(ctx, name, func(put *api.InstancePut) bool {
+		if put.Devices == nil {
+			put.Devices = map[string]map[string]string{}
+		}
+		changed := false
+		for k, device := range devices {
+			current, ok := put.Devices[k]
+			switch {
+			case device == nil && ok:
+				delete(put.Devices, k)
+				changed = true
+			case device != nil && (!ok || !maps.Equal(current, device)):
+				put.Devices[k] = device
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// updateInstance applies update to the writable fields of an existing
+// instance and saves them if update reports a change.
+func (c *clientImpl) updateInstance(ctx context.Context, name string, update func(put *api.InstancePut) bool) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inst, etag, err := server.GetInstance(name)
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", c.instanceError(server, name, err))
+	}
+
+	put := inst.Writable()
+	if !update(&put) {
+		return nil
+	}
+
+	op, err := server.UpdateInstance(name, put, etag)
+	if err != nil {
+		return fmt.Errorf("failed to update instance: %w", c.instanceError(server, name, err))
+	}
+
+	if err := waitOperation(ctx, op); err != nil {
+		return fmt.Errorf("failed waiting for instance update: %w", c.instanceError(server, name, err))
+	}
+
+	return nil
+}
+
+// SetInstanceLabels sets the given user.* config keys on an existing instance,
+// such as the labels that tie it to its owner. An empty value removes the key.
+// Keys outside the user.* namespace are rejected, since they change how the
+// instance runs.
+func (c *clientImpl) SetInstanceLabels(ctx context.Context, name string, labels map[string]string) error {
+	for k := range labels {
+		if !strings.HasPrefix(k, "user.") {
+			return fmt.Errorf("instance label %q is not a user.* config key", k)
+		}
+	}
+	return c.UpdateInstanceConfig(ctx, name, labels)
+}
+
+// UpdateInstanceResources sets limits.cpu and limits.memory of an existing
+// instance. It does nothing if both already have the requested values.
+func (c *clientImpl) UpdateInstanceResources(ctx context.Context, name string, cpuLimit string, memoryMiB int) error {
+	return c.UpdateInstanceConfig(ctx, name, resourceLimits(cpuLimit, memoryMiB))
+}
+
+// CreateSnapshot takes a snapshot of the instance.
+func (c *clientImpl) CreateSnapshot(ctx context.Context, instance, name string, stateful bool) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, instance)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	op, err := server.CreateInstanceSnapshot(instance, api.InstanceSnapshotsPost{Name: name, Stateful: stateful})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot %s: %w", name, c.instanceError(server, instance, err))
+	}
+	if err := waitOperation(ctx, op); err != nil {
+		return fmt.Errorf("failed waiting for snapshot %s: %w", name, c.apiError(server, err))
+	}
+	return nil
+}
+
+// RestoreSnapshot restores the instance to the named snapshot.
+func (c *clientImpl) RestoreSnapshot(ctx context.Context, instance, name string, stateful bool) error {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockInstance(ctx, instance)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	op, err := server.UpdateInstance(instance, api.InstancePut{Restore: name, Stateful: stateful}, "")
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot %s: %w", name, c.instanceError(server, instance, err))
+	}
+	if err := waitOperation(ctx, op); err != nil {
+		return fmt.Errorf("failed waiting for restore of snapshot %s: %w", name, c.apiError(server, err))
+	}
+	return nil
+}
+
+// ListSnapshots returns the names of the snapshots of the instance.
+func (c *clientImpl) ListSnapshots(ctx context.Context, instance string) ([]string, error) {
+	server, err := c.getServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := server.GetInstanceSnapshotNames(instance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", c.instanceError(server, instance, err))
+	}
+	return names, nil
+}
+
+// Close releases the connection, and those of the project clients, by closing
+// the idle connections of its HTTP transport. The next call reconnects.
+// Requests in flight keep their connection until they finish. Close may be
+// called more than once.
+func (c *clientImpl) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.server != nil {
+		closeIdleConnections(c.server)
+		c.server = nil
+	}
+	for _, p := range c.projects {
+		if err := p.Close(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
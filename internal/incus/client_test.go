@@ -0,0 +1,3180 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package incus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	incus "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeOperation is an incus.Operation that has already completed.
+type fakeOperation struct {
+	incus.Operation
+	err error
+}
+
+func (o *fakeOperation) Wait() error {
+	return o.err
+}
+
+func (o *fakeOperation) WaitContext(_ context.Context) error {
+	return o.err
+}
+
+// hangingOperation never completes on its own; only WaitContext returns,
+// once its context is done.
+type hangingOperation struct {
+	incus.Operation
+	cancelled bool
+}
+
+func (o *hangingOperation) Cancel() error {
+	o.cancelled = true
+	return nil
+}
+
+func (o *hangingOperation) WaitContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// fakeServer records the requests made through the incus.InstanceServer
+// methods used by clientImpl. Unimplemented methods panic via the embedded
+// nil interface.
+type fakeServer struct {
+	incus.InstanceServer
+	created []api.InstancesPost
+	// volumes records the custom volumes created, by pool.
+	volumes map[string][]api.StorageVolumesPost
+	// target is the cluster member selected with UseTarget.
+	target  string
+	targets []string
+	// profiles holds the devices of each profile. When nil, every profile
+	// has the root disk of a stock default profile.
+	profiles map[string]map[string]map[string]string
+}
+
+func (s *fakeServer) GetProfile(name string) (*api.Profile, string, error) {
+	if s.profiles == nil {
+		root := map[string]string{"type": "disk", "pool": "default", "path": "/"}
+		return &api.Profile{Name: name, ProfilePut: api.ProfilePut{Devices: map[string]map[string]string{"root": root}}}, "", nil
+	}
+	devices, ok := s.profiles[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Profile not found")
+	}
+	return &api.Profile{Name: name, ProfilePut: api.ProfilePut{Devices: devices}}, "", nil
+}
+
+func (s *fakeServer) CreateInstance(req api.InstancesPost) (incus.Operation, error) {
+	s.created = append(s.created, req)
+	s.targets = append(s.targets, s.target)
+	return &fakeOperation{}, nil
+}
+
+func (s *fakeServer) GetInstance(name string) (*api.Instance, string, error) {
+	for _, req := range s.created {
+		if req.Name == name {
+			return &api.Instance{Name: name}, "", nil
+		}
+	}
+	return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+}
+
+func (s *fakeServer) CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) error {
+	if s.volumes == nil {
+		s.volumes = map[string][]api.StorageVolumesPost{}
+	}
+	s.volumes[pool] = append(s.volumes[pool], volume)
+	return nil
+}
+
+func (s *fakeServer) UseTarget(name string) incus.InstanceServer {
+	return &targetServer{fakeServer: s, name: name}
+}
+
+// targetServer is a fakeServer scoped to a cluster member by UseTarget.
+type targetServer struct {
+	*fakeServer
+	name string
+}
+
+func (s *targetServer) CreateInstance(req api.InstancesPost) (incus.Operation, error) {
+	s.target = s.name
+	defer func() { s.target = "" }()
+	return s.fakeServer.CreateInstance(req)
+}
+
+func newTestClient(server incus.InstanceServer) *clientImpl {
+	return &clientImpl{
+		server: server,
+		dial: func(_ context.Context) (incus.InstanceServer, error) {
+			return server, nil
+		},
+	}
+}
+
+// hangingServer starts instance creations that never finish. With
+// leaveInstance, the instance exists while its creation hangs.
+type hangingServer struct {
+	incus.InstanceServer
+	leaveInstance bool
+	op            *hangingOperation
+	exists        bool
+	deleted       bool
+}
+
+func (s *hangingServer) CreateInstance(_ api.InstancesPost) (incus.Operation, error) {
+	s.op = &hangingOperation{}
+	s.exists = s.leaveInstance
+	return s.op, nil
+}
+
+func (s *hangingServer) GetInstance(name string) (*api.Instance, string, error) {
+	if !s.exists {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return &api.Instance{Name: name}, "", nil
+}
+
+func (s *hangingServer) GetInstanceState(_ string) (*api.InstanceState, string, error) {
+	return &api.InstanceState{Status: "Stopped", StatusCode: api.Stopped}, "", nil
+}
+
+func (s *hangingServer) DeleteInstance(_ string) (incus.Operation, error) {
+	s.exists = false
+	s.deleted = true
+	return &fakeOperation{}, nil
+}
+
+func TestCreateInstanceWaitRespectsContext(t *testing.T) {
+	c := newTestClient(&hangingServer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.CreateInstance(ctx, CreateInstanceRequest{Name: "vm"})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("CreateInstance() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateInstance() did not return after its context was cancelled")
+	}
+}
+
+func TestCreateInstanceCancelRemovesInstance(t *testing.T) {
+	server := &hangingServer{leaveInstance: true}
+	c := newTestClient(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := c.CreateInstance(ctx, CreateInstanceRequest{Name: "vm"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateInstance() error = %v, want %v", err, context.Canceled)
+	}
+	if !server.op.cancelled {
+		t.Error("the creation operation was not cancelled")
+	}
+	if !server.deleted || server.exists {
+		t.Error("the instance left by the cancelled creation was not deleted")
+	}
+}
+
+func TestCreateInstanceMemoryBallooning(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name       string
+		ballooning *bool
+		wantConf   string
+	}{
+		{name: "unset", ballooning: nil, wantConf: ""},
+		{name: "enabled", ballooning: &enabled, wantConf: ""},
+		{name: "disabled", ballooning: &disabled, wantConf: qemuBalloonSection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+				Name:             "vm",
+				MemoryBallooning: tt.ballooning,
+			})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if got := server.created[0].Config["raw.qemu.conf"]; got != tt.wantConf {
+				t.Errorf("raw.qemu.conf = %q, want %q", got, tt.wantConf)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceMemoryBallooningKeepsRawQemuConf(t *testing.T) {
+	disabled := false
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:             "vm",
+		Config:           map[string]string{"raw.qemu.conf": "[global]"},
+		MemoryBallooning: &disabled,
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	want := "[global]\n" + qemuBalloonSection
+	if got := server.created[0].Config["raw.qemu.conf"]; got != want {
+		t.Errorf("raw.qemu.conf = %q, want %q", got, want)
+	}
+}
+
+func TestCreateInstanceCloudInitDatasource(t *testing.T) {
+	tests := []struct {
+		name       string
+		datasource string
+		rawQemu    string
+		want       string
+	}{
+		{name: "unset", want: ""},
+		{name: "nocloud", datasource: "nocloud", want: "-smbios type=1,serial=ds=nocloud"},
+		{name: "appends to raw.qemu", datasource: "nocloud", rawQemu: "-cpu host", want: "-cpu host -smbios type=1,serial=ds=nocloud"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			req := CreateInstanceRequest{Name: "vm", CloudInitDatasource: tt.datasource}
+			if tt.rawQemu != "" {
+				req.Config = map[string]string{"raw.qemu": tt.rawQemu}
+			}
+			if err := c.CreateInstance(context.Background(), req); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if got := server.created[0].Config["raw.qemu"]; got != tt.want {
+				t.Errorf("raw.qemu = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceCloudInitData(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	req := CreateInstanceRequest{
+		Name:          "vm",
+		UserData:      "#cloud-config\nruncmd: [kubeadm join]\n",
+		VendorData:    "#cloud-config\npackages: [chrony]\n",
+		NetworkConfig: "version: 2\nethernets:\n  enp5s0:\n    dhcp4: true\n",
+	}
+	if err := c.CreateInstance(context.Background(), req); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	config := server.created[0].Config
+	for key, want := range map[string]string{
+		"cloud-init.user-data":      req.UserData,
+		"cloud-init.vendor-data":    req.VendorData,
+		"cloud-init.network-config": req.NetworkConfig,
+	} {
+		if got := config[key]; got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// Vendor-data that is not a cloud-config, such as a script, is passed
+	// through as is.
+	script := "#!/bin/sh\necho a: b: c\n"
+	if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-2", VendorData: script}); err != nil {
+		t.Fatalf("CreateInstance() error = %v for a vendor-data script", err)
+	}
+	if got := server.created[1].Config["cloud-init.vendor-data"]; got != script {
+		t.Errorf("cloud-init.vendor-data = %q, want %q", got, script)
+	}
+}
+
+func TestCreateInstanceHostname(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	req := CreateInstanceRequest{
+		Name:     "vm",
+		Hostname: "worker-0.example.com",
+		Config:   map[string]string{"user.meta-data": "local-hostname: vm\npublic-keys: []"},
+	}
+	if err := c.CreateInstance(context.Background(), req); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	// Incus prepends the local-hostname of the instance name; the last one
+	// wins.
+	metaData := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte("local-hostname: vm\n"+server.created[0].Config["user.meta-data"]), &metaData); err != nil {
+		t.Fatalf("user.meta-data is not valid YAML: %v", err)
+	}
+	if got := metaData["local-hostname"]; got != "worker-0.example.com" {
+		t.Errorf("local-hostname = %v, want worker-0.example.com", got)
+	}
+	if _, ok := metaData["public-keys"]; !ok {
+		t.Errorf("user.meta-data = %q, want the configured keys kept", server.created[0].Config["user.meta-data"])
+	}
+
+	if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-2"}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if got, ok := server.created[1].Config["user.meta-data"]; ok {
+		t.Errorf("user.meta-data = %q without a hostname, want it unset", got)
+	}
+}
+
+func TestCreateInstanceDNSServers(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	req := CreateInstanceRequest{Name: "vm", DNSServers: []string{"10.0.0.53", "2001:db8::53"}}
+	if err := c.CreateInstance(context.Background(), req); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	var networkConfig struct {
+		Version   int `json:"version"`
+		Ethernets map[string]struct {
+			DHCP4       bool `json:"dhcp4"`
+			Nameservers struct {
+				Addresses []string `json:"addresses"`
+			} `json:"nameservers"`
+		} `json:"ethernets"`
+	}
+	if err := yaml.Unmarshal([]byte(server.created[0].Config["cloud-init.network-config"]), &networkConfig); err != nil {
+		t.Fatalf("cloud-init.network-config is not valid YAML: %v", err)
+	}
+	if networkConfig.Version != 2 || len(networkConfig.Ethernets) != 1 {
+		t.Fatalf("network-config = %+v, want a v2 config with one ethernet entry", networkConfig)
+	}
+	for name, ethernet := range networkConfig.Ethernets {
+		if !ethernet.DHCP4 {
+			t.Errorf("ethernet %s does not use DHCP", name)
+		}
+		if !slices.Equal(ethernet.Nameservers.Addresses, req.DNSServers) {
+			t.Errorf("nameservers of %s = %v, want %v", name, ethernet.Nameservers.Addresses, req.DNSServers)
+		}
+	}
+}
+
+func TestCreateInstanceRejectsInvalidCloudInitData(t *testing.T) {
+	tests := []CreateInstanceRequest{
+		{Name: "vm", VendorData: "#cloud-config\npackages: [chrony\n"},
+		{Name: "vm", NetworkConfig: "version: 2\n  ethernets: {\n"},
+		{Name: "vm", NetworkConfig: "- not\n- a mapping\n"},
+		{Name: "vm", DNSServers: []string{"dns.example.com"}},
+		{Name: "vm", DNSServers: []string{"10.0.0.53"}, NetworkConfig: "version: 2\n"},
+	}
+	for _, req := range tests {
+		server := &fakeServer{}
+		if err := newTestClient(server).CreateInstance(context.Background(), req); err == nil {
+			t.Errorf("CreateInstance(%+v) succeeded, want an error", req)
+		}
+		if len(server.created) != 0 {
+			t.Errorf("CreateInstance(%+v) submitted the instance", req)
+		}
+	}
+}
+
+func TestCreateInstanceNUMANodes(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", NUMANodes: "0-1,3"})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if got := server.created[0].Config["limits.cpu.nodes"]; got != "0-1,3" {
+		t.Errorf("limits.cpu.nodes = %q, want %q", got, "0-1,3")
+	}
+}
+
+func TestCreateInstanceDescription(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", Description: "worker"})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if got := server.created[0].Description; got != "worker" {
+		t.Errorf("Description = %q, want %q", got, "worker")
+	}
+}
+
+func TestCreateInstanceCPUPinning(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpus    int
+		pinning string
+		want    string
+	}{
+		{name: "count", cpus: 4, want: "4"},
+		{name: "range", cpus: 4, pinning: "0-3", want: "0-3"},
+		{name: "list", pinning: "0,2,4-5", want: "0,2,4-5"},
+		{name: "single CPU", pinning: "2", want: "2-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", CPUs: tt.cpus, CPUPinning: tt.pinning})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if got := server.created[0].Config["limits.cpu"]; got != tt.want {
+				t.Errorf("limits.cpu = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	server := &fakeServer{}
+	if err := newTestClient(server).CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", CPUPinning: "3-1"}); err == nil {
+		t.Error("CreateInstance() with a reversed CPU range succeeded, want an error")
+	}
+}
+
+func TestCreateInstanceBootConfig(t *testing.T) {
+	autostart := true
+	tests := []struct {
+		name string
+		req  CreateInstanceRequest
+		want map[string]string
+	}{
+		{name: "unset", req: CreateInstanceRequest{Name: "vm"}, want: map[string]string{}},
+		{
+			name: "autostart with priority",
+			req:  CreateInstanceRequest{Name: "vm", BootAutostart: &autostart, BootPriority: 10},
+			want: map[string]string{"boot.autostart": "true", "boot.autostart.priority": "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			if err := newTestClient(server).CreateInstance(context.Background(), tt.req); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			got := map[string]string{}
+			for k, v := range server.created[0].Config {
+				if strings.HasPrefix(k, "boot.") {
+					got[k] = v
+				}
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("boot config = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		wantNIC map[string]string
+	}{
+		{name: "default profile", network: ""},
+		{name: "named network", network: "capi-net", wantNIC: map[string]string{"type": "nic", "name": "eth0", "network": "capi-net"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", Network: tt.network})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			nic, ok := server.created[0].Devices["eth0"]
+			if tt.wantNIC == nil {
+				if ok {
+					t.Errorf("eth0 = %v, want no device", nic)
+				}
+				return
+			}
+			if !maps.Equal(nic, tt.wantNIC) {
+				t.Errorf("eth0 = %v, want %v", nic, tt.wantNIC)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceGPUs(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name: "vm",
+		GPUs: []GPUDevice{
+			{PCI: "0000:01:00.0"},
+			{Vendor: "10de", Product: "2330"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	devices := server.created[0].Devices
+	wantGPU0 := map[string]string{"type": "gpu", "gputype": "physical", "pci": "0000:01:00.0"}
+	if !maps.Equal(devices["gpu0"], wantGPU0) {
+		t.Errorf("gpu0 = %v, want %v", devices["gpu0"], wantGPU0)
+	}
+	wantGPU1 := map[string]string{"type": "gpu", "gputype": "physical", "vendorid": "10de", "productid": "2330"}
+	if !maps.Equal(devices["gpu1"], wantGPU1) {
+		t.Errorf("gpu1 = %v, want %v", devices["gpu1"], wantGPU1)
+	}
+}
+
+func TestCreateInstanceRejectsInvalidGPUs(t *testing.T) {
+	tests := []CreateInstanceRequest{
+		{Name: "vm", GPUs: []GPUDevice{{}}},
+		{Name: "c1", InstanceType: "container", GPUs: []GPUDevice{{Product: "2330"}}},
+	}
+	for _, req := range tests {
+		server := &fakeServer{}
+		if err := newTestClient(server).CreateInstance(context.Background(), req); err == nil {
+			t.Errorf("CreateInstance(%+v) succeeded, want an error", req)
+		}
+		if len(server.created) != 0 {
+			t.Errorf("CreateInstance(%+v) submitted the instance", req)
+		}
+	}
+}
+
+func TestCreateInstanceNetworkInterfaces(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:    "vm",
+		Network: "capi-net",
+		NetworkInterfaces: []NetworkInterface{
+			{Name: "eth0", IPv4Address: "10.0.0.10", HWAddr: "00:16:3e:12:34:56"},
+			{Name: "eth1", Network: "storage-net"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	devices := server.created[0].Devices
+	wantEth0 := map[string]string{"type": "nic", "name": "eth0", "network": "capi-net", "ipv4.address": "10.0.0.10", "hwaddr": "00:16:3e:12:34:56"}
+	if !maps.Equal(devices["eth0"], wantEth0) {
+		t.Errorf("eth0 = %v, want %v", devices["eth0"], wantEth0)
+	}
+	wantEth1 := map[string]string{"type": "nic", "name": "eth1", "network": "storage-net"}
+	if !maps.Equal(devices["eth1"], wantEth1) {
+		t.Errorf("eth1 = %v, want %v", devices["eth1"], wantEth1)
+	}
+
+	err = c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:              "vm2",
+		NetworkInterfaces: []NetworkInterface{{Name: "eth0", IPv4Address: "10.0.0.11"}},
+	})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("CreateInstance() error = %v for an interface without a network, want ErrInvalidRequest", err)
+	}
+}
+
+func TestCreateInstanceStoragePool(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      CreateInstanceRequest
+		wantRoot map[string]string
+	}{
+		{name: "profile root disk", req: CreateInstanceRequest{}},
+		{name: "size in the default pool", req: CreateInstanceRequest{RootDiskSizeGiB: 20},
+			wantRoot: map[string]string{"type": "disk", "pool": "default", "path": "/", "size": "20GiB"}},
+		{name: "requested pool", req: CreateInstanceRequest{StoragePool: "fast", RootDiskSizeGiB: 20},
+			wantRoot: map[string]string{"type": "disk", "pool": "fast", "path": "/", "size": "20GiB"}},
+		{name: "requested pool without size", req: CreateInstanceRequest{StoragePool: "fast"},
+			wantRoot: map[string]string{"type": "disk", "pool": "fast", "path": "/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			tt.req.Name = "vm"
+			if err := c.CreateInstance(context.Background(), tt.req); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			root, ok := server.created[0].Devices["root"]
+			if tt.wantRoot == nil {
+				if ok {
+					t.Errorf("root = %v, want no device", root)
+				}
+				return
+			}
+			if !maps.Equal(root, tt.wantRoot) {
+				t.Errorf("root = %v, want %v", root, tt.wantRoot)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceRootDiskKeepsProfilePool(t *testing.T) {
+	server := &fakeServer{profiles: map[string]map[string]map[string]string{
+		"default": {
+			"root": {"type": "disk", "pool": "default", "path": "/"},
+			"eth0": {"type": "nic", "network": "incusbr0", "name": "eth0"},
+		},
+		// The later profile overrides the root disk of the default one.
+		"ssd": {
+			"root": {"type": "disk", "pool": "nvme", "path": "/", "io.bus": "nvme"},
+		},
+	}}
+	c := newTestClient(server)
+
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:            "vm",
+		Profiles:        []string{"default", "ssd"},
+		RootDiskSizeGiB: 40,
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	want := map[string]string{"type": "disk", "pool": "nvme", "path": "/", "io.bus": "nvme", "size": "40GiB"}
+	if root := server.created[0].Devices["root"]; !maps.Equal(root, want) {
+		t.Errorf("root = %v, want %v", root, want)
+	}
+	if _, ok := server.profiles["ssd"]["root"]["size"]; ok {
+		t.Error("the profile's root device was modified")
+	}
+
+	// A missing profile fails the create instead of guessing the root disk.
+	err = c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:            "vm-2",
+		Profiles:        []string{"missing"},
+		RootDiskSizeGiB: 40,
+	})
+	if err == nil {
+		t.Error("CreateInstance() succeeded with a missing profile")
+	}
+}
+
+func TestCreateInstanceRootDiskIOLimits(t *testing.T) {
+	server := &fakeServer{profiles: map[string]map[string]map[string]string{
+		"default": {"root": {"type": "disk", "pool": "nvme", "path": "/"}},
+	}}
+	c := newTestClient(server)
+
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:             "vm",
+		RootDiskReadIOPS: 500,
+		RootDiskWriteBps: 10 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	want := map[string]string{"type": "disk", "pool": "nvme", "path": "/", "limits.read": "500iops", "limits.write": "10485760B"}
+	if root := server.created[0].Devices["root"]; !maps.Equal(root, want) {
+		t.Errorf("root = %v, want %v", root, want)
+	}
+
+	// Incus takes a single read limit.
+	err = c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:             "vm-2",
+		RootDiskReadIOPS: 500,
+		RootDiskReadBps:  1024,
+	})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("CreateInstance() error = %v, want ErrInvalidRequest", err)
+	}
+
+	err = c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:           "vm-3",
+		RootDiskMaxBps: 20 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	want = map[string]string{"type": "disk", "pool": "nvme", "path": "/", "limits.max": "20971520B"}
+	if root := server.created[1].Devices["root"]; !maps.Equal(root, want) {
+		t.Errorf("root = %v, want %v", root, want)
+	}
+
+	// limits.max overrides limits.read and limits.write.
+	err = c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:             "vm-4",
+		RootDiskMaxIOPS:  2000,
+		RootDiskReadIOPS: 500,
+	})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("CreateInstance() error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestCreateInstanceDataDisks(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name: "vm",
+		DataDisks: []DataDisk{
+			{SizeGiB: 50, Pool: "fast"},
+			{SizeGiB: 200, Pool: "bulk", Path: "/var/lib/data"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	devices := server.created[0].Devices
+	if want := map[string]string{"type": "disk", "pool": "fast", "source": "vm-data0"}; !maps.Equal(devices["data0"], want) {
+		t.Errorf("data0 = %v, want %v", devices["data0"], want)
+	}
+	if want := map[string]string{"type": "disk", "pool": "bulk", "source": "vm-data1", "path": "/var/lib/data"}; !maps.Equal(devices["data1"], want) {
+		t.Errorf("data1 = %v, want %v", devices["data1"], want)
+	}
+
+	wantVolumes := map[string]api.StorageVolumesPost{
+		"fast": {Name: "vm-data0", Type: "custom", ContentType: "block",
+			StorageVolumePut: api.StorageVolumePut{Config: map[string]string{"size": "50GiB"}}},
+		"bulk": {Name: "vm-data1", Type: "custom", ContentType: "filesystem",
+			StorageVolumePut: api.StorageVolumePut{Config: map[string]string{"size": "200GiB"}}},
+	}
+	for pool, want := range wantVolumes {
+		if got := server.volumes[pool]; len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("volumes in pool %s = %+v, want %+v", pool, got, want)
+		}
+	}
+}
+
+func TestCreateInstanceRejectsInvalidDataDisks(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CreateInstanceRequest
+	}{
+		{name: "zero size", req: CreateInstanceRequest{DataDisks: []DataDisk{{Pool: "fast"}}}},
+		{name: "no pool", req: CreateInstanceRequest{DataDisks: []DataDisk{{SizeGiB: 10}}}},
+		{name: "block device for a container", req: CreateInstanceRequest{InstanceType: "container",
+			DataDisks: []DataDisk{{SizeGiB: 10, Pool: "fast"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			tt.req.Name = "vm"
+			if err := c.CreateInstance(context.Background(), tt.req); err == nil {
+				t.Fatal("CreateInstance() error = nil, want an error")
+			}
+			if len(server.created) != 0 || len(server.volumes) != 0 {
+				t.Errorf("created instances %v and volumes %v, want none", server.created, server.volumes)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceImageSource(t *testing.T) {
+	const fingerprint = "2f1a3b6c8d9e0f1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192"
+	tests := []struct {
+		name string
+		req  CreateInstanceRequest
+		want api.InstanceSource
+	}{
+		{name: "default image", req: CreateInstanceRequest{},
+			want: api.InstanceSource{Type: "image", Alias: "images:ubuntu/24.04"}},
+		{name: "remote image server",
+			req: CreateInstanceRequest{Image: "ubuntu/24.04/cloud", ImageServer: "https://images.example.com"},
+			want: api.InstanceSource{Type: "image", Alias: "ubuntu/24.04/cloud",
+				Server: "https://images.example.com", Protocol: "simplestreams"}},
+		{name: "incus image server by fingerprint",
+			req: CreateInstanceRequest{Image: fingerprint, ImageServer: "https://incus.example.com:8443", ImageProtocol: "incus"},
+			want: api.InstanceSource{Type: "image", Fingerprint: fingerprint,
+				Server: "https://incus.example.com:8443", Protocol: "incus"}},
+		{name: "local fingerprint prefix", req: CreateInstanceRequest{Image: "2f1a3b6c8d9e"},
+			want: api.InstanceSource{Type: "image", Fingerprint: "2f1a3b6c8d9e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			tt.req.Name = "vm"
+			if err := c.CreateInstance(context.Background(), tt.req); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if got := server.created[0].Source; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Source = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceRejectsUnknownImageProtocol(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:          "vm",
+		ImageServer:   "https://images.example.com",
+		ImageProtocol: "lxd",
+	})
+	if err == nil {
+		t.Fatal("CreateInstance() error = nil, want an error for an unknown protocol")
+	}
+	if len(server.created) != 0 {
+		t.Errorf("created %d instances, want none", len(server.created))
+	}
+}
+
+func TestPlanInstanceMatchesCreate(t *testing.T) {
+	ballooning := false
+	req := CreateInstanceRequest{
+		Name:             "vm",
+		Image:            "ubuntu/24.04/cloud",
+		ImageServer:      "https://images.example.com",
+		CPUs:             4,
+		MemoryMiB:        8192,
+		RootDiskSizeGiB:  40,
+		StoragePool:      "fast",
+		Config:           map[string]string{"user.role": "worker"},
+		Devices:          map[string]map[string]string{"data": {"type": "disk", "pool": "fast", "source": "data"}},
+		MemoryBallooning: &ballooning,
+		NUMANodes:        "0-1",
+		UserData:         "#cloud-config\n",
+		Profiles:         []string{"default", "k8s"},
+		Network:          "capi-net",
+		Target:           "member-2",
+	}
+
+	// Planning must not need a connection.
+	plan, err := NewClient().PlanInstance(context.Background(), req)
+	if err != nil {
+		t.Fatalf("PlanInstance() error = %v", err)
+	}
+
+	server := &fakeServer{}
+	c := newTestClient(server)
+	if err := c.CreateInstance(context.Background(), req); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if !reflect.DeepEqual(plan, server.created[0]) {
+		t.Errorf("PlanInstance() = %+v, want the created request %+v", plan, server.created[0])
+	}
+}
+
+func TestPlanInstanceRejectsInvalidRequest(t *testing.T) {
+	_, err := NewClient().PlanInstance(context.Background(), CreateInstanceRequest{Name: "vm", NUMANodes: "0-"})
+	if err == nil {
+		t.Error("PlanInstance() error = nil, want an error for an invalid NUMA node set")
+	}
+}
+
+// conflictServer fails every create with err.
+type conflictServer struct {
+	incus.InstanceServer
+	err error
+}
+
+func (s *conflictServer) CreateInstance(api.InstancesPost) (incus.Operation, error) {
+	return nil, s.err
+}
+
+func TestCreateInstanceExists(t *testing.T) {
+	c := newTestClient(&conflictServer{err: api.StatusErrorf(http.StatusConflict, "Instance already exists")})
+	if got := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-1"}); !errors.Is(got, ErrInstanceExists) {
+		t.Errorf("CreateInstance() error = %v, want ErrInstanceExists", got)
+	}
+
+	// Only a 409 Conflict means the name is taken.
+	for _, err := range []error{
+		api.StatusErrorf(http.StatusInternalServerError, "boom"),
+		api.StatusErrorf(http.StatusInternalServerError, "Failed creating instance: target already exists"),
+	} {
+		c := newTestClient(&conflictServer{err: err})
+		if got := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-1"}); errors.Is(got, ErrInstanceExists) {
+			t.Errorf("CreateInstance() error = %v for %q, want an error other than ErrInstanceExists", got, err)
+		}
+	}
+}
+
+// volumeConflictServer fails every custom volume creation with err.
+type volumeConflictServer struct {
+	fakeServer
+	err error
+}
+
+func (s *volumeConflictServer) CreateStoragePoolVolume(string, api.StorageVolumesPost) error {
+	return s.err
+}
+
+func TestCreateInstanceExistingDataVolume(t *testing.T) {
+	req := CreateInstanceRequest{Name: "vm-1", DataDisks: []DataDisk{{SizeGiB: 10, Pool: "fast"}}}
+
+	// A volume left behind by an earlier attempt is reused.
+	server := &volumeConflictServer{err: api.StatusErrorf(http.StatusConflict, "Volume by that name already exists")}
+	if err := newTestClient(server).CreateInstance(context.Background(), req); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if len(server.created) != 1 {
+		t.Errorf("created %d instances, want 1", len(server.created))
+	}
+
+	// Only a 409 Conflict means the volume exists.
+	server = &volumeConflictServer{err: api.StatusErrorf(http.StatusInternalServerError, "Failed mounting: target already exists")}
+	if err := newTestClient(server).CreateInstance(context.Background(), req); err == nil {
+		t.Error("CreateInstance() error = nil, want the volume creation error")
+	}
+	if len(server.created) != 0 {
+		t.Errorf("created %d instances after a failed volume creation, want 0", len(server.created))
+	}
+}
+
+func TestCreateInstanceDataDisksNameTaken(t *testing.T) {
+	server := &fakeServer{created: []api.InstancesPost{{Name: "vm-1"}}}
+	c := newTestClient(server)
+
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:      "vm-1",
+		DataDisks: []DataDisk{{SizeGiB: 10, Pool: "fast"}},
+	})
+	if !errors.Is(err, ErrInstanceExists) {
+		t.Errorf("CreateInstance() error = %v, want ErrInstanceExists", err)
+	}
+	if len(server.volumes) != 0 {
+		t.Errorf("created volumes %v for a taken name, want none", server.volumes)
+	}
+}
+
+func TestCreateInstanceTarget(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+
+	if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-1"}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm-2", Target: "member-2"}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if want := []string{"", "member-2"}; !slices.Equal(server.targets, want) {
+		t.Errorf("targets = %v, want %v", server.targets, want)
+	}
+}
+
+// clusterServer reports whether it is clustered, its members and their
+// load.
+type clusterServer struct {
+	incus.InstanceServer
+	members []api.ClusterMember
+	loads   map[string]float64
+}
+
+func (s *clusterServer) IsClustered() bool {
+	return s.members != nil
+}
+
+func (s *clusterServer) GetClusterMembers() ([]api.ClusterMember, error) {
+	return s.members, nil
+}
+
+func (s *clusterServer) GetClusterMemberState(name string) (*api.ClusterMemberState, string, error) {
+	load, ok := s.loads[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Cluster member not found")
+	}
+	return &api.ClusterMemberState{SysInfo: api.ClusterMemberSysInfo{LoadAverages: []float64{load, 0.5, 0.25}}}, "", nil
+}
+
+func TestGetClusterMembers(t *testing.T) {
+	c := newTestClient(&clusterServer{})
+	members, err := c.GetClusterMembers(context.Background())
+	if err != nil || members != nil {
+		t.Errorf("GetClusterMembers() = %v, %v for a standalone server, want nil, nil", members, err)
+	}
+
+	c = newTestClient(&clusterServer{
+		members: []api.ClusterMember{
+			{ServerName: "member-1", Status: "Online"},
+			{ServerName: "member-2", Status: "Offline"},
+		},
+		loads: map[string]float64{"member-1": 1.5},
+	})
+	members, err = c.GetClusterMembers(context.Background())
+	if err != nil {
+		t.Fatalf("GetClusterMembers() error = %v", err)
+	}
+	want := []ClusterMember{{Name: "member-1", Status: "Online", Load: 1.5}, {Name: "member-2", Status: "Offline"}}
+	if !slices.Equal(members, want) {
+		t.Errorf("GetClusterMembers() = %v, want %v", members, want)
+	}
+}
+
+// serverInfoServer reports a fixed server description.
+type serverInfoServer struct {
+	incus.InstanceServer
+	server api.Server
+}
+
+func (s *serverInfoServer) GetServer() (*api.Server, string, error) {
+	return &s.server, "", nil
+}
+
+func TestGetServerInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		wantVM bool
+	}{
+		{name: "containers and virtual machines", driver: "lxc | qemu", wantVM: true},
+		{name: "containers only", driver: "lxc", wantVM: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &serverInfoServer{}
+			server.server.APIExtensions = []string{"instances", "virtual-machines"}
+			server.server.Environment.ServerVersion = "6.0.4"
+			server.server.Environment.Storage = "zfs"
+			server.server.Environment.Driver = tt.driver
+
+			info, err := newTestClient(server).GetServerInfo(context.Background())
+			if err != nil {
+				t.Fatalf("GetServerInfo() error = %v", err)
+			}
+			want := ServerInfo{
+				Version:         "6.0.4",
+				APIExtensions:   []string{"instances", "virtual-machines"},
+				StorageDriver:   "zfs",
+				VirtualMachines: tt.wantVM,
+			}
+			if !reflect.DeepEqual(*info, want) {
+				t.Errorf("GetServerInfo() = %+v, want %+v", *info, want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceDevices(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:            "vm",
+		RootDiskSizeGiB: 20,
+		Devices: map[string]map[string]string{
+			"data": {"type": "disk", "pool": "default", "source": "data-vol"},
+			"root": {"type": "disk", "pool": "fast", "path": "/"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	devices := server.created[0].Devices
+	if got := devices["data"]["source"]; got != "data-vol" {
+		t.Errorf("data source = %q, want %q", got, "data-vol")
+	}
+	if got := devices["root"]["size"]; got != "20GiB" {
+		t.Errorf("root size = %q, want the generated root disk", got)
+	}
+}
+
+func TestCreateInstanceProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []string
+		want     []string
+	}{
+		{name: "default", want: []string{"default"}},
+		{name: "custom", profiles: []string{"default", "storage-fast"}, want: []string{"default", "storage-fast"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", Profiles: tt.profiles})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if got := server.created[0].Profiles; !slices.Equal(got, tt.want) {
+				t.Errorf("profiles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceType(t *testing.T) {
+	tests := []struct {
+		name           string
+		instanceType   string
+		wantType       api.InstanceType
+		wantSecureboot bool
+	}{
+		{name: "default", wantType: api.InstanceTypeVM, wantSecureboot: true},
+		{name: "virtual machine", instanceType: "virtual-machine", wantType: api.InstanceTypeVM, wantSecureboot: true},
+		{name: "container", instanceType: "container", wantType: api.InstanceTypeContainer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			c := newTestClient(server)
+			err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", InstanceType: tt.instanceType})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			created := server.created[0]
+			if created.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", created.Type, tt.wantType)
+			}
+			if _, ok := created.Config["security.secureboot"]; ok != tt.wantSecureboot {
+				t.Errorf("security.secureboot set = %v, want %v", ok, tt.wantSecureboot)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceRejectsUnknownType(t *testing.T) {
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm", InstanceType: "microvm"})
+	if err == nil {
+		t.Fatal("CreateInstance() succeeded with an unknown instance type")
+	}
+	if len(server.created) != 0 {
+		t.Error("instance was created with an unknown instance type")
+	}
+}
+
+func TestCreateInstanceRejectsVMOptionsForContainers(t *testing.T) {
+	disabled := false
+	server := &fakeServer{}
+	c := newTestClient(server)
+	err := c.CreateInstance(context.Background(), CreateInstanceRequest{
+		Name:             "ct",
+		InstanceType:     "container",
+		MemoryBallooning: &disabled,
+	})
+	if err == nil {
+		t.Fatal("CreateInstance() accepted memory ballooning for a container")
+	}
+}
+
+func TestCreateInstanceSecurityOptions(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name    string
+		req     CreateInstanceRequest
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "vm defaults",
+			req:  CreateInstanceRequest{Name: "vm"},
+			want: map[string]string{"security.secureboot": "false"},
+		},
+		{
+			name: "vm secure boot",
+			req:  CreateInstanceRequest{Name: "vm", SecureBoot: &enabled},
+			want: map[string]string{"security.secureboot": "true"},
+		},
+		{
+			name: "vm secure boot disabled",
+			req:  CreateInstanceRequest{Name: "vm", SecureBoot: &disabled},
+			want: map[string]string{"security.secureboot": "false"},
+		},
+		{
+			name: "vm secure boot from config",
+			req:  CreateInstanceRequest{Name: "vm", Config: map[string]string{"security.secureboot": "true"}},
+			want: map[string]string{"security.secureboot": "true"},
+		},
+		{
+			name: "secure boot field overrides config",
+			req:  CreateInstanceRequest{Name: "vm", SecureBoot: &disabled, Config: map[string]string{"security.secureboot": "true"}},
+			want: map[string]string{"security.secureboot": "false"},
+		},
+		{
+			name: "container defaults",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container"},
+			want: map[string]string{},
+		},
+		{
+			name: "container nesting",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container", Nesting: true},
+			want: map[string]string{"security.nesting": "true"},
+		},
+		{
+			name: "container privileged",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container", Privileged: true},
+			want: map[string]string{"security.privileged": "true"},
+		},
+		{
+			name: "container nesting and privileged",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container", Nesting: true, Privileged: true},
+			want: map[string]string{"security.nesting": "true", "security.privileged": "true"},
+		},
+		{
+			name:    "container secure boot",
+			req:     CreateInstanceRequest{Name: "ct", InstanceType: "container", SecureBoot: &disabled},
+			wantErr: true,
+		},
+		{
+			name:    "vm nesting",
+			req:     CreateInstanceRequest{Name: "vm", Nesting: true},
+			wantErr: true,
+		},
+		{
+			name:    "vm privileged",
+			req:     CreateInstanceRequest{Name: "vm", Privileged: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			err := newTestClient(server).CreateInstance(context.Background(), tt.req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Errorf("CreateInstance() error = %v, want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			got := map[string]string{}
+			for k, v := range server.created[0].Config {
+				if strings.HasPrefix(k, "security.") {
+					got[k] = v
+				}
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("security config = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceMemoryOptions(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name    string
+		req     CreateInstanceRequest
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container"},
+			want: map[string]string{},
+		},
+		{
+			name: "swap disabled",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container", MemorySwap: &disabled},
+			want: map[string]string{"limits.memory.swap": "false"},
+		},
+		{
+			name: "swap enabled and soft enforcement",
+			req:  CreateInstanceRequest{Name: "ct", InstanceType: "container", MemorySwap: &enabled, MemoryEnforce: "soft"},
+			want: map[string]string{"limits.memory.swap": "true", "limits.memory.enforce": "soft"},
+		},
+		{
+			name: "fields override config",
+			req: CreateInstanceRequest{Name: "ct", InstanceType: "container", MemoryEnforce: "hard",
+				Config: map[string]string{"limits.memory.enforce": "soft"}},
+			want: map[string]string{"limits.memory.enforce": "hard"},
+		},
+		{
+			name:    "unknown enforcement",
+			req:     CreateInstanceRequest{Name: "ct", InstanceType: "container", MemoryEnforce: "strict"},
+			wantErr: true,
+		},
+		{
+			name:    "vm swap",
+			req:     CreateInstanceRequest{Name: "vm", MemorySwap: &disabled},
+			wantErr: true,
+		},
+		{
+			name:    "vm enforcement",
+			req:     CreateInstanceRequest{Name: "vm", MemoryEnforce: "soft"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			err := newTestClient(server).CreateInstance(context.Background(), tt.req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Errorf("CreateInstance() error = %v, want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			got := map[string]string{}
+			for _, k := range []string{"limits.memory.swap", "limits.memory.enforce"} {
+				if v, ok := server.created[0].Config[k]; ok {
+					got[k] = v
+				}
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("memory config = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNodeSet(t *testing.T) {
+	tests := []struct {
+		set     string
+		wantErr bool
+	}{
+		{set: "0"},
+		{set: "0,1"},
+		{set: "0-3"},
+		{set: "0-1,3,5-7"},
+		{set: "", wantErr: true},
+		{set: "a", wantErr: true},
+		{set: "0,", wantErr: true},
+		{set: "-1", wantErr: true},
+		{set: "3-1", wantErr: true},
+		{set: "0-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.set, func(t *testing.T) {
+			err := validateNodeSet(tt.set)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNodeSet(%q) error = %v, wantErr %v", tt.set, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// blockingServer holds every CreateInstance call until release is closed and
+// tracks how many calls run at once.
+type blockingServer struct {
+	incus.InstanceServer
+	entered chan string
+	release chan struct{}
+
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func newBlockingServer() *blockingServer {
+	return &blockingServer{
+		entered: make(chan string, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *blockingServer) CreateInstance(req api.InstancesPost) (incus.Operation, error) {
+	s.mu.Lock()
+	s.active++
+	s.maxActive = max(s.maxActive, s.active)
+	s.mu.Unlock()
+
+	s.entered <- req.Name
+	<-s.release
+
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return &fakeOperation{}, nil
+}
+
+// UseProject returns s itself, so that all projects share its counters.
+func (s *blockingServer) UseProject(string) incus.InstanceServer {
+	return s
+}
+
+func TestConcurrentCreatesAreBounded(t *testing.T) {
+	const limit, machines = 3, 30
+	server := newBlockingServer()
+	server.entered = make(chan string, machines)
+	c := newTestClient(server)
+	c.operations = newSemaphore(limit)
+
+	// Projects share the limit of the server.
+	clients := []Client{c, c.UseProject("tenant-a"), c.UseProject("tenant-b")}
+	var wg sync.WaitGroup
+	for i := range machines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := clients[i%len(clients)]
+			req := CreateInstanceRequest{Name: fmt.Sprintf("vm-%d", i), Config: map[string]string{"user.index": fmt.Sprint(i)}}
+			if err := client.CreateInstance(context.Background(), req); err != nil {
+				t.Errorf("CreateInstance() error = %v", err)
+			}
+		}()
+	}
+
+	for range limit {
+		<-server.entered
+	}
+	select {
+	case name := <-server.entered:
+		t.Fatalf("create of %s started with %d operations in flight", name, limit)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(server.release)
+	wg.Wait()
+	if server.maxActive != limit {
+		t.Errorf("max concurrent operations = %d, want %d", server.maxActive, limit)
+	}
+}
+
+func TestCreateInstanceSerializesSameName(t *testing.T) {
+	server := newBlockingServer()
+	c := newTestClient(server)
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm"}); err != nil {
+				t.Errorf("CreateInstance() error = %v", err)
+			}
+		}()
+	}
+
+	<-server.entered
+	select {
+	case <-server.entered:
+		t.Fatal("second operation on the same instance started while the first was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(server.release)
+	<-server.entered
+	wg.Wait()
+
+	if server.maxActive != 1 {
+		t.Errorf("max concurrent operations = %d, want 1", server.maxActive)
+	}
+}
+
+func TestCreateInstanceDoesNotSerializeDifferentNames(t *testing.T) {
+	server := newBlockingServer()
+	c := newTestClient(server)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"vm-a", "vm-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.CreateInstance(context.Background(), CreateInstanceRequest{Name: name}); err != nil {
+				t.Errorf("CreateInstance() error = %v", err)
+			}
+		}()
+	}
+
+	<-server.entered
+	<-server.entered
+	close(server.release)
+	wg.Wait()
+
+	if server.maxActive != 2 {
+		t.Errorf("max concurrent operations = %d, want 2", server.maxActive)
+	}
+}
+
+func TestCreateInstanceLockWaitRespectsContext(t *testing.T) {
+	server := newBlockingServer()
+	c := newTestClient(server)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.CreateInstance(context.Background(), CreateInstanceRequest{Name: "vm"})
+	}()
+	<-server.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.CreateInstance(ctx, CreateInstanceRequest{Name: "vm"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CreateInstance() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(server.release)
+	<-done
+}
+
+func TestValidateConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr string
+	}{
+		{name: "default socket"},
+		{name: "explicit socket", opts: []ClientOption{WithSocketPath("/run/incus.socket")}},
+		{name: "complete remote", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", "")}},
+		{name: "remote without key", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "", "")}, wantErr: "incomplete"},
+		{name: "credentials without url", opts: []ClientOption{WithRemote("", "cert", "key", "")}, wantErr: "incomplete"},
+		{name: "plain http remote", opts: []ClientOption{WithRemote("http://incus:8443", "cert", "key", "")}, wantErr: "https"},
+		{name: "pinned fingerprint", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", ""), WithServerCertFingerprint(strings.Repeat("AB:", 31) + "AB")}},
+		{name: "insecure", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", ""), WithInsecureSkipVerify()}},
+		{name: "malformed fingerprint", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", ""), WithServerCertFingerprint("abcd")}, wantErr: "SHA-256"},
+		{name: "fingerprint without remote", opts: []ClientOption{WithServerCertFingerprint("abababababababababababababababababababababababababababababababab")}, wantErr: "incomplete"},
+		{name: "fingerprint and insecure", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", ""), WithServerCertFingerprint("abababababababababababababababababababababababababababababababab"), WithInsecureSkipVerify()}, wantErr: "conflicting"},
+		{name: "certificate and fingerprint", opts: []ClientOption{WithRemote("https://incus:8443", "cert", "key", "server"), WithServerCertFingerprint("abababababababababababababababababababababababababababababababab")}, wantErr: "conflicting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(tt.opts...).(*clientImpl)
+			err := c.validateConnection()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateConnection() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateConnection() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectRemote(t *testing.T) {
+	var sawClientCert bool
+	var userAgent string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawClientCert = len(r.TLS.PeerCertificates) > 0
+		userAgent = r.UserAgent()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"sync","status":"Success","status_code":200,"metadata":{"api_version":"1.0","auth":"trusted"}}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	clientCert, clientKey := generateClientCert(t)
+
+	c := NewClient(WithRemote(srv.URL, clientCert, clientKey, serverCert), WithUserAgent("test-agent")).(*clientImpl)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if !sawClientCert {
+		t.Error("server did not receive the client certificate")
+	}
+	if userAgent != "test-agent" {
+		t.Errorf("User-Agent = %q, want %q", userAgent, "test-agent")
+	}
+}
+
+func TestConnectServerCertFingerprint(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"sync","status":"Success","status_code":200,"metadata":{"api_version":"1.0","auth":"trusted"}}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	var parts []string
+	for _, b := range sum {
+		parts = append(parts, fmt.Sprintf("%02X", b))
+	}
+	fingerprint := strings.Join(parts, ":")
+	clientCert, clientKey := generateClientCert(t)
+
+	t.Run("matching", func(t *testing.T) {
+		c := NewClient(WithRemote(srv.URL, clientCert, clientKey, ""), WithServerCertFingerprint(fingerprint))
+		if err := c.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+	})
+
+	t.Run("mismatching", func(t *testing.T) {
+		c := NewClient(WithRemote(srv.URL, clientCert, clientKey, ""), WithServerCertFingerprint(strings.Repeat("0", 64)),
+			WithConnectRetry(3, time.Millisecond))
+		err := c.Connect(context.Background())
+		if !errors.Is(err, errServerCertMismatch) {
+			t.Fatalf("Connect() error = %v, want %v", err, errServerCertMismatch)
+		}
+		if !strings.Contains(err.Error(), "after 1 attempts") {
+			t.Errorf("Connect() error = %v, want no retries of a certificate mismatch", err)
+		}
+	})
+
+	t.Run("unpinned", func(t *testing.T) {
+		// The test server's certificate is not signed by a system CA.
+		c := NewClient(WithRemote(srv.URL, clientCert, clientKey, ""), WithConnectRetry(1, 0))
+		if err := c.Connect(context.Background()); err == nil {
+			t.Fatal("Connect() succeeded without a way to trust the server")
+		}
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		c := NewClient(WithRemote(srv.URL, clientCert, clientKey, ""), WithInsecureSkipVerify())
+		if err := c.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+	})
+}
+
+func TestConnectHTTPTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	defer close(release)
+
+	serverCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	clientCert, clientKey := generateClientCert(t)
+
+	c := NewClient(WithRemote(srv.URL, clientCert, clientKey, serverCert), WithHTTPTimeout(100*time.Millisecond), WithConnectRetry(1, 0))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Connect(context.Background())
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Connect() succeeded against a server that never responds")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connect() did not time out against a server that never responds")
+	}
+}
+
+func TestConnectIncompleteRemote(t *testing.T) {
+	c := NewClient(WithRemote("https://incus:8443", "", "", ""))
+	if err := c.Connect(context.Background()); err == nil {
+		t.Fatal("Connect() succeeded with an incomplete remote configuration")
+	}
+}
+
+// instanceServer answers GetInstance with err, or with an instance if err is nil.
+type instanceServer struct {
+	incus.InstanceServer
+	err error
+}
+
+func (s *instanceServer) GetInstance(name string) (*api.Instance, string, error) {
+	if s.err != nil {
+		return nil, "", s.err
+	}
+	return &api.Instance{Name: name}, "", nil
+}
+
+func (s *instanceServer) GetInstanceFull(name string) (*api.InstanceFull, string, error) {
+	inst, etag, err := s.GetInstance(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return &api.InstanceFull{Instance: *inst}, etag, nil
+}
+
+// powerServer tracks the power state of a single instance. Graceful stops
+// fail when stopErr is set, like a guest that ignores the shutdown request.
+type powerServer struct {
+	incus.InstanceServer
+	running bool
+	stopErr error
+	actions []api.InstanceStatePut
+	deleted bool
+	// devices are the devices of the instance; deletedVolumes records the
+	// volumes deleted as "<pool>/<name>".
+	devices        map[string]map[string]string
+	deletedVolumes []string
+}
+
+func (s *powerServer) GetInstance(name string) (*api.Instance, string, error) {
+	return &api.Instance{Name: name, Location: "none", InstancePut: api.InstancePut{Devices: s.devices}}, "", nil
+}
+
+func (s *powerServer) DeleteStoragePoolVolume(pool, volType, name string) error {
+	if !s.deleted {
+		return api.StatusErrorf(http.StatusBadRequest, "The storage volume is still in use")
+	}
+	s.deletedVolumes = append(s.deletedVolumes, pool+"/"+name)
+	return nil
+}
+
+func (s *powerServer) GetInstanceState(_ string) (*api.InstanceState, string, error) {
+	if s.running {
+		return &api.InstanceState{Status: "Running", StatusCode: api.Running}, "", nil
+	}
+	return &api.InstanceState{Status: "Stopped", StatusCode: api.Stopped}, "", nil
+}
+
+func (s *powerServer) UpdateInstanceState(_ string, state api.InstanceStatePut, _ string) (incus.Operation, error) {
+	s.actions = append(s.actions, state)
+	if !state.Force && s.stopErr != nil {
+		return &fakeOperation{err: s.stopErr}, nil
+	}
+	s.running = state.Action == "start"
+	return &fakeOperation{}, nil
+}
+
+func (s *powerServer) DeleteInstance(_ string) (incus.Operation, error) {
+	if s.running {
+		return nil, api.StatusErrorf(http.StatusBadRequest, "Instance is running")
+	}
+	s.deleted = true
+	return &fakeOperation{}, nil
+}
+
+func TestDeleteInstanceStopsRunningInstance(t *testing.T) {
+	server := &powerServer{running: true}
+	c := newTestClient(server)
+
+	if err := c.DeleteInstance(context.Background(), "vm"); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if !server.deleted {
+		t.Error("instance was not deleted")
+	}
+	want := []api.InstanceStatePut{{Action: "stop", Timeout: int(stopTimeout.Seconds())}}
+	if !slices.Equal(server.actions, want) {
+		t.Errorf("state changes = %v, want %v", server.actions, want)
+	}
+}
+
+func TestStartInstance(t *testing.T) {
+	for _, running := range []bool{false, true} {
+		server := &powerServer{running: running}
+		c := newTestClient(server)
+
+		if err := c.StartInstance(context.Background(), "vm"); err != nil {
+			t.Fatalf("StartInstance() error = %v", err)
+		}
+		if !server.running {
+			t.Error("instance is not running")
+		}
+		var want []api.InstanceStatePut
+		if !running {
+			want = []api.InstanceStatePut{{Action: "start"}}
+		}
+		if !slices.Equal(server.actions, want) {
+			t.Errorf("state changes for running=%v = %v, want %v", running, server.actions, want)
+		}
+	}
+}
+
+// imageServer holds one image, aliased "ubuntu/24.04".
+type imageServer struct {
+	incus.InstanceServer
+	err error
+}
+
+const imageServerFingerprint = "0a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f6789"
+
+func (s *imageServer) GetImage(fingerprint string) (*api.Image, string, error) {
+	if s.err != nil {
+		return nil, "", s.err
+	}
+	if !strings.HasPrefix(imageServerFingerprint, fingerprint) {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Image not found")
+	}
+	return &api.Image{Fingerprint: imageServerFingerprint}, "", nil
+}
+
+func (s *imageServer) GetImageAlias(name string) (*api.ImageAliasesEntry, string, error) {
+	if s.err != nil {
+		return nil, "", s.err
+	}
+	if name != "ubuntu/24.04" {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Image alias not found")
+	}
+	return &api.ImageAliasesEntry{Name: name, ImageAliasesEntryPut: api.ImageAliasesEntryPut{Target: imageServerFingerprint}}, "", nil
+}
+
+func TestImageExists(t *testing.T) {
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "ubuntu/24.04", want: true},
+		{image: "debian/12", want: false},
+		{image: imageServerFingerprint, want: true},
+		{image: imageServerFingerprint[:12], want: true},
+		{image: "ffffffffffff", want: false},
+	}
+	c := newTestClient(&imageServer{})
+	for _, tt := range tests {
+		got, err := c.ImageExists(context.Background(), tt.image)
+		if err != nil {
+			t.Fatalf("ImageExists(%q) error = %v", tt.image, err)
+		}
+		if got != tt.want {
+			t.Errorf("ImageExists(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+
+	c = newTestClient(&imageServer{err: api.StatusErrorf(http.StatusInternalServerError, "database is locked")})
+	if _, err := c.ImageExists(context.Background(), "ubuntu/24.04"); err == nil {
+		t.Error("ImageExists() succeeded although the server failed")
+	}
+}
+
+// consoleServer returns a canned console log for the instance "vm".
+type consoleServer struct {
+	incus.InstanceServer
+	log string
+}
+
+func (s *consoleServer) GetInstanceConsoleLog(name string, _ *incus.InstanceConsoleLogArgs) (io.ReadCloser, error) {
+	if name != "vm" {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return io.NopCloser(strings.NewReader(s.log)), nil
+}
+
+func TestGetConsoleLog(t *testing.T) {
+	const consoleLog = "[    0.000000] Linux version 6.8.0\ncloud-init: finished\n"
+	c := newTestClient(&consoleServer{log: consoleLog})
+
+	got, err := c.GetConsoleLog(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("GetConsoleLog() error = %v", err)
+	}
+	if got != consoleLog {
+		t.Errorf("GetConsoleLog() = %q, want %q", got, consoleLog)
+	}
+
+	if _, err := c.GetConsoleLog(context.Background(), "missing"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("GetConsoleLog() of a missing instance error = %v, want %v", err, ErrInstanceNotFound)
+	}
+}
+
+// warningServer returns canned server warnings.
+type warningServer struct {
+	incus.InstanceServer
+	warnings []api.Warning
+}
+
+func (s *warningServer) GetWarnings() ([]api.Warning, error) {
+	return s.warnings, nil
+}
+
+func (s *warningServer) UseProject(string) incus.InstanceServer {
+	return s
+}
+
+func TestInstanceWarnings(t *testing.T) {
+	server := &warningServer{warnings: []api.Warning{
+		{Project: "default", EntityURL: "/1.0/instances/vm", LastMessage: "default", WarningPut: api.WarningPut{Status: "new"}},
+		{Project: "a", EntityURL: "/1.0/instances/vm?project=a", LastMessage: "a", WarningPut: api.WarningPut{Status: "new"}},
+		{Project: "a", EntityURL: "/1.0/instances/vm?project=a", LastMessage: "a resolved", WarningPut: api.WarningPut{Status: "resolved"}},
+		{Project: "a", EntityURL: "/1.0/instances/other?project=a", LastMessage: "other", WarningPut: api.WarningPut{Status: "new"}},
+		{Project: "b", EntityURL: "/1.0/instances/vm?project=b", LastMessage: "b", WarningPut: api.WarningPut{Status: "acknowledged"}},
+	}}
+	c := newTestClient(server)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		client Client
+		want   []string
+	}{
+		{c, []string{"default"}},
+		{c.UseProject("a"), []string{"a"}},
+		{c.UseProject("b"), []string{"b"}},
+		{c.UseProject("c"), nil},
+	} {
+		got, err := tc.client.InstanceWarnings(ctx, "vm")
+		if err != nil {
+			t.Fatalf("InstanceWarnings() error = %v", err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("InstanceWarnings() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+// execOperation is a finished exec operation that exited with exitCode.
+type execOperation struct {
+	fakeOperation
+	exitCode int
+}
+
+func (o *execOperation) Get() api.Operation {
+	return api.Operation{Metadata: map[string]any{"return": float64(o.exitCode)}}
+}
+
+// execServer runs every command in the instance "vm", writing canned output
+// and exiting with exitCode. With hang set, the command never finishes.
+type execServer struct {
+	incus.InstanceServer
+	stdout, stderr string
+	exitCode       int
+	hang           *hangingOperation
+	commands       [][]string
+}
+
+func (s *execServer) ExecInstance(name string, exec api.InstanceExecPost, args *incus.InstanceExecArgs) (incus.Operation, error) {
+	if name != "vm" {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	s.commands = append(s.commands, exec.Command)
+	if s.hang != nil {
+		return s.hang, nil
+	}
+	_, _ = io.WriteString(args.Stdout, s.stdout)
+	_, _ = io.WriteString(args.Stderr, s.stderr)
+	close(args.DataDone)
+	return &execOperation{exitCode: s.exitCode}, nil
+}
+
+func TestExec(t *testing.T) {
+	server := &execServer{stdout: "ok\n", stderr: "warning: slow disk\n"}
+	c := newTestClient(server)
+
+	stdout, stderr, exitCode, err := c.Exec(context.Background(), "vm", []string{"cloud-init", "status", "--wait"})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if stdout != "ok\n" || stderr != "warning: slow disk\n" || exitCode != 0 {
+		t.Errorf("Exec() = %q, %q, %d, want %q, %q, 0", stdout, stderr, exitCode, "ok\n", "warning: slow disk\n")
+	}
+	if want := [][]string{{"cloud-init", "status", "--wait"}}; !reflect.DeepEqual(server.commands, want) {
+		t.Errorf("commands = %v, want %v", server.commands, want)
+	}
+
+	// A failing command is reported through its exit code, not as an error.
+	server.exitCode = 2
+	if _, _, exitCode, err := c.Exec(context.Background(), "vm", []string{"false"}); err != nil || exitCode != 2 {
+		t.Errorf("Exec() exit code = %d, error = %v, want 2 and no error", exitCode, err)
+	}
+
+	if _, _, _, err := c.Exec(context.Background(), "missing", []string{"true"}); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("Exec() in a missing instance error = %v, want %v", err, ErrInstanceNotFound)
+	}
+	if _, _, _, err := c.Exec(context.Background(), "vm", nil); err == nil {
+		t.Error("Exec() succeeded without a command")
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	server := &execServer{hang: &hangingOperation{}}
+	c := newTestClient(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, _, err := c.Exec(ctx, "vm", []string{"sleep", "infinity"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !server.hang.cancelled {
+		t.Error("the exec operation was not cancelled")
+	}
+}
+
+// moveServer records the instance moves and state changes requested of it.
+type moveServer struct {
+	incus.InstanceServer
+	instance api.Instance
+	moves    []string
+	live     []bool
+	actions  []string
+}
+
+func (s *moveServer) GetInstance(_ string) (*api.Instance, string, error) {
+	inst := s.instance
+	return &inst, "", nil
+}
+
+func (s *moveServer) GetInstanceState(_ string) (*api.InstanceState, string, error) {
+	return &api.InstanceState{Status: s.instance.Status, StatusCode: s.instance.StatusCode}, "", nil
+}
+
+func (s *moveServer) UpdateInstanceState(_ string, state api.InstanceStatePut, _ string) (incus.Operation, error) {
+	s.actions = append(s.actions, state.Action)
+	if state.Action == "stop" {
+		s.instance.StatusCode = api.Stopped
+	}
+	return &fakeOperation{}, nil
+}
+
+func (s *moveServer) UseTarget(name string) incus.InstanceServer {
+	return &moveTargetServer{moveServer: s, name: name}
+}
+
+// moveTargetServer is a moveServer scoped to a cluster member by UseTarget.
+type moveTargetServer struct {
+	*moveServer
+	name string
+}
+
+func (s *moveTargetServer) MigrateInstance(_ string, req api.InstancePost) (incus.Operation, error) {
+	s.moves = append(s.moves, s.name)
+	s.live = append(s.live, req.Live)
+	s.instance.Location = s.name
+	return &fakeOperation{}, nil
+}
+
+func TestMoveInstance(t *testing.T) {
+	tests := []struct {
+		name        string
+		instance    api.Instance
+		wantMoves   []string
+		wantLive    []bool
+		wantActions []string
+	}{
+		{
+			name:      "running virtual machine is moved live",
+			instance:  api.Instance{Name: "vm", Type: "virtual-machine", Location: "member-1", StatusCode: api.Running},
+			wantMoves: []string{"member-2"},
+			wantLive:  []bool{true},
+		},
+		{
+			name:      "stopped virtual machine is moved cold",
+			instance:  api.Instance{Name: "vm", Type: "virtual-machine", Location: "member-1", StatusCode: api.Stopped},
+			wantMoves: []string{"member-2"},
+			wantLive:  []bool{false},
+		},
+		{
+			name:        "running container is stopped and started again",
+			instance:    api.Instance{Name: "ct", Type: "container", Location: "member-1", StatusCode: api.Running},
+			wantMoves:   []string{"member-2"},
+			wantLive:    []bool{false},
+			wantActions: []string{"stop", "start"},
+		},
+		{
+			name:     "instance already on the member is left alone",
+			instance: api.Instance{Name: "vm", Type: "virtual-machine", Location: "member-2", StatusCode: api.Running},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &moveServer{instance: tt.instance}
+			c := newTestClient(server)
+
+			if err := c.MoveInstance(context.Background(), tt.instance.Name, "member-2"); err != nil {
+				t.Fatalf("MoveInstance() error = %v", err)
+			}
+			if !slices.Equal(server.moves, tt.wantMoves) {
+				t.Errorf("moves = %v, want %v", server.moves, tt.wantMoves)
+			}
+			if !slices.Equal(server.live, tt.wantLive) {
+				t.Errorf("live = %v, want %v", server.live, tt.wantLive)
+			}
+			if !slices.Equal(server.actions, tt.wantActions) {
+				t.Errorf("state changes = %v, want %v", server.actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestDeleteInstanceDeletesDataVolumes(t *testing.T) {
+	server := &powerServer{devices: map[string]map[string]string{
+		"data0": {"type": "disk", "pool": "fast", "source": "vm-data0"},
+		"data1": {"type": "disk", "pool": "bulk", "source": "vm-data1", "path": "/var/lib/data"},
+		// Disks the provider did not create are left alone.
+		"data2":   {"type": "disk", "pool": "fast", "source": "shared"},
+		"scratch": {"type": "disk", "pool": "fast", "source": "vm-scratch"},
+	}}
+	c := newTestClient(server)
+
+	if err := c.DeleteInstance(context.Background(), "vm"); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	want := []string{"fast/vm-data0", "bulk/vm-data1"}
+	if !slices.Equal(server.deletedVolumes, want) {
+		t.Errorf("deleted volumes = %v, want %v", server.deletedVolumes, want)
+	}
+}
+
+func TestDeleteInstanceForcesStop(t *testing.T) {
+	server := &powerServer{running: true, stopErr: errors.New("shutdown timed out")}
+	c := newTestClient(server)
+
+	if err := c.DeleteInstance(context.Background(), "vm"); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if !server.deleted {
+		t.Error("instance was not deleted")
+	}
+	if n := len(server.actions); n != 2 || !server.actions[1].Force {
+		t.Errorf("state changes = %v, want a graceful then a forced stop", server.actions)
+	}
+}
+
+func TestDeleteInstanceAlreadyStopped(t *testing.T) {
+	server := &powerServer{}
+	c := newTestClient(server)
+
+	if err := c.DeleteInstance(context.Background(), "vm"); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if len(server.actions) != 0 {
+		t.Errorf("state changes = %v, want none", server.actions)
+	}
+}
+
+// stateServer reports a fixed instance state.
+type stateServer struct {
+	incus.InstanceServer
+	state *api.InstanceState
+}
+
+func (s *stateServer) GetInstanceState(_ string) (*api.InstanceState, string, error) {
+	return s.state, "", nil
+}
+
+func TestGetInstanceState(t *testing.T) {
+	server := &stateServer{state: &api.InstanceState{
+		Status: "Running",
+		Network: map[string]api.InstanceStateNetwork{
+			"lo": {Addresses: []api.InstanceStateNetworkAddress{
+				{Family: "inet", Address: "127.0.0.1", Scope: "local"},
+			}},
+			"eth1": {Addresses: []api.InstanceStateNetworkAddress{
+				{Family: "inet", Address: "192.168.1.5", Scope: "global"},
+			}},
+			"eth0": {Addresses: []api.InstanceStateNetworkAddress{
+				{Family: "inet", Address: "10.0.0.2", Scope: "global"},
+				{Family: "inet6", Address: "fd42::2", Scope: "global"},
+				{Family: "inet6", Address: "fe80::2", Scope: "link"},
+			}},
+		},
+	}}
+	c := newTestClient(server)
+
+	state, err := c.GetInstanceState(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("GetInstanceState() error = %v", err)
+	}
+	if state.Status != "Running" {
+		t.Errorf("status = %q, want %q", state.Status, "Running")
+	}
+	want := []string{"10.0.0.2", "fd42::2", "192.168.1.5"}
+	if !slices.Equal(state.Addresses, want) {
+		t.Errorf("addresses = %v, want %v", state.Addresses, want)
+	}
+}
+
+func TestGetInstanceConfig(t *testing.T) {
+	c := newTestClient(&instanceServer{})
+	config, err := c.GetInstanceConfig(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("GetInstanceConfig() error = %v", err)
+	}
+	if config == nil {
+		t.Error("GetInstanceConfig() = nil for an existing instance")
+	}
+
+	c = newTestClient(&instanceServer{err: api.StatusErrorf(http.StatusNotFound, "Instance not found")})
+	config, err = c.GetInstanceConfig(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("GetInstanceConfig() error = %v", err)
+	}
+	if config != nil {
+		t.Errorf("GetInstanceConfig() = %v for a missing instance, want nil", config)
+	}
+}
+
+// configServer serves a single instance with config, profiles and devices
+// and records updates.
+type configServer struct {
+	incus.InstanceServer
+	config   map[string]string
+	profiles []string
+	devices  map[string]map[string]string
+	updates  []api.InstancePut
+}
+
+func (s *configServer) GetInstance(name string) (*api.Instance, string, error) {
+	return &api.Instance{Name: name, InstancePut: api.InstancePut{
+		Config:   maps.Clone(s.config),
+		Profiles: slices.Clone(s.profiles),
+		Devices:  maps.Clone(s.devices),
+	}}, "etag", nil
+}
+
+func (s *configServer) UpdateInstance(_ string, put api.InstancePut, _ string) (incus.Operation, error) {
+	s.updates = append(s.updates, put)
+	s.config = put.Config
+	s.profiles = put.Profiles
+	s.devices = put.Devices
+	return &fakeOperation{}, nil
+}
+
+func TestUpdateInstanceResources(t *testing.T) {
+	server := &configServer{config: map[string]string{
+		"limits.cpu":    "2",
+		"limits.memory": "2048MiB",
+		"user.keep":     "yes",
+	}}
+	c := newTestClient(server)
+
+	if err := c.UpdateInstanceResources(context.Background(), "vm", "2", 4096); err != nil {
+		t.Fatalf("UpdateInstanceResources() error = %v", err)
+	}
+	want := map[string]string{"limits.cpu": "2", "limits.memory": "4096MiB", "user.keep": "yes"}
+	if !maps.Equal(server.config, want) {
+		t.Errorf("config = %v, want %v", server.config, want)
+	}
+
+	if err := c.UpdateInstanceResources(context.Background(), "vm", "2", 4096); err != nil {
+		t.Fatalf("UpdateInstanceResources() error = %v", err)
+	}
+	if len(server.updates) != 1 {
+		t.Errorf("got %d updates, want 1 for an unchanged instance", len(server.updates))
+	}
+}
+
+func TestUpdateInstanceProfiles(t *testing.T) {
+	server := &configServer{
+		config:   map[string]string{"user.keep": "yes"},
+		profiles: []string{"default"},
+	}
+	c := newTestClient(server)
+
+	if err := c.UpdateInstanceProfiles(context.Background(), "vm", []string{"default", "gpu"}); err != nil {
+		t.Fatalf("UpdateInstanceProfiles() error = %v", err)
+	}
+	if want := []string{"default", "gpu"}; !slices.Equal(server.profiles, want) {
+		t.Errorf("profiles = %v, want %v", server.profiles, want)
+	}
+	if server.config["user.keep"] != "yes" {
+		t.Errorf("config = %v, want it kept", server.config)
+	}
+
+	if err := c.UpdateInstanceProfiles(context.Background(), "vm", []string{"default", "gpu"}); err != nil {
+		t.Fatalf("UpdateInstanceProfiles() error = %v", err)
+	}
+	if len(server.updates) != 1 {
+		t.Errorf("got %d updates, want 1 for unchanged profiles", len(server.updates))
+	}
+}
+
+func TestUpdateInstanceDevices(t *testing.T) {
+	server := &configServer{devices: map[string]map[string]string{
+		"root":  {"type": "disk", "pool": "default", "path": "/"},
+		"extra": {"type": "disk", "source": "/srv", "path": "/srv"},
+		"old":   {"type": "nic", "network": "lan"},
+	}}
+	c := newTestClient(server)
+
+	err := c.UpdateInstanceDevices(context.Background(), "vm", map[string]map[string]string{
+		"extra": {"type": "disk", "source": "/data", "path": "/srv"},
+		"new":   {"type": "nic", "network": "storage"},
+		"old":   nil,
+		"gone":  nil,
+	})
+	if err != nil {
+		t.Fatalf("UpdateInstanceDevices() error = %v", err)
+	}
+	want := map[string]map[string]string{
+		"root":  {"type": "disk", "pool": "default", "path": "/"},
+		"extra": {"type": "disk", "source": "/data", "path": "/srv"},
+		"new":   {"type": "nic", "network": "storage"},
+	}
+	if !maps.EqualFunc(server.devices, want, maps.Equal) {
+		t.Errorf("devices = %v, want %v", server.devices, want)
+	}
+
+	err = c.UpdateInstanceDevices(context.Background(), "vm", map[string]map[string]string{
+		"new":  {"type": "nic", "network": "storage"},
+		"gone": nil,
+	})
+	if err != nil {
+		t.Fatalf("UpdateInstanceDevices() error = %v", err)
+	}
+	if len(server.updates) != 1 {
+		t.Errorf("got %d updates, want 1 for unchanged devices", len(server.updates))
+	}
+}
+
+func TestSetInstanceLabels(t *testing.T) {
+	server := &configServer{config: map[string]string{
+		"limits.cpu":            "2",
+		"user.capi.machine-uid": "old",
+		"user.capi.cluster":     "old-cluster",
+	}}
+	c := newTestClient(server)
+
+	err := c.SetInstanceLabels(context.Background(), "vm", map[string]string{
+		"user.capi.machine-uid": "new",
+		"user.capi.cluster":     "",
+	})
+	if err != nil {
+		t.Fatalf("SetInstanceLabels() error = %v", err)
+	}
+	want := map[string]string{"limits.cpu": "2", "user.capi.machine-uid": "new"}
+	if !maps.Equal(server.config, want) {
+		t.Errorf("config = %v, want %v", server.config, want)
+	}
+
+	err = c.SetInstanceLabels(context.Background(), "vm", map[string]string{"limits.cpu": "4"})
+	if err == nil {
+		t.Error("SetInstanceLabels() succeeded for a non-user key")
+	}
+	if len(server.updates) != 1 {
+		t.Errorf("got %d updates, want 1", len(server.updates))
+	}
+}
+
+// fullServer answers GetInstanceFull with inst.
+type fullServer struct {
+	incus.InstanceServer
+	inst *api.InstanceFull
+}
+
+func (s *fullServer) GetInstanceFull(_ string) (*api.InstanceFull, string, error) {
+	return s.inst, "", nil
+}
+
+func TestGetInstance(t *testing.T) {
+	server := &fullServer{inst: &api.InstanceFull{
+		Instance: api.Instance{
+			Name:     "vm",
+			Type:     "virtual-machine",
+			Status:   "Running",
+			Location: "member-1",
+			InstancePut: api.InstancePut{
+				Config:   map[string]string{"limits.memory": "4096MiB"},
+				Profiles: []string{"default", "gpu"},
+				Devices:  map[string]map[string]string{"extra": {"type": "disk", "source": "/srv", "path": "/srv"}},
+			},
+			ExpandedConfig: map[string]string{"limits.cpu": "2", "limits.memory": "4096MiB"},
+		},
+		State: &api.InstanceState{
+			Network: map[string]api.InstanceStateNetwork{
+				"eth0": {Addresses: []api.InstanceStateNetworkAddress{
+					{Family: "inet", Address: "10.0.0.2", Scope: "global"},
+					{Family: "inet6", Address: "fe80::2", Scope: "link"},
+				}},
+			},
+		},
+	}}
+	c := newTestClient(server)
+
+	info, err := c.GetInstance(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("GetInstance() error = %v", err)
+	}
+	want := &InstanceInfo{
+		Name:        "vm",
+		Type:        "virtual-machine",
+		Status:      "Running",
+		Location:    "member-1",
+		Addresses:   []string{"10.0.0.2"},
+		Config:      map[string]string{"limits.memory": "4096MiB"},
+		Profiles:    []string{"default", "gpu"},
+		Devices:     map[string]map[string]string{"extra": {"type": "disk", "source": "/srv", "path": "/srv"}},
+		CPULimit:    "2",
+		MemoryLimit: "4096MiB",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("GetInstance() = %+v, want %+v", info, want)
+	}
+}
+
+// listServer lists a fixed set of instances.
+type listServer struct {
+	incus.InstanceServer
+	instances []api.Instance
+}
+
+func (s *listServer) GetInstances(api.InstanceType) ([]api.Instance, error) {
+	return s.instances, nil
+}
+
+func TestListInstances(t *testing.T) {
+	c := newTestClient(&listServer{instances: []api.Instance{
+		{Name: "a", Location: "none", InstancePut: api.InstancePut{Config: map[string]string{"user.cluster": "one", "user.role": "worker"}}},
+		{Name: "b", Location: "member-1", InstancePut: api.InstancePut{Config: map[string]string{"user.cluster": "one"}}},
+		{Name: "c", InstancePut: api.InstancePut{Config: map[string]string{"user.cluster": "two"}}},
+		{Name: "d"},
+	}})
+
+	tests := []struct {
+		selector map[string]string
+		want     []string
+	}{
+		{selector: nil, want: []string{"a", "b", "c", "d"}},
+		{selector: map[string]string{"user.cluster": "one"}, want: []string{"a", "b"}},
+		{selector: map[string]string{"user.cluster": "one", "user.role": "worker"}, want: []string{"a"}},
+		{selector: map[string]string{"user.cluster": "three"}, want: nil},
+	}
+	for _, tt := range tests {
+		instances, err := c.ListInstances(context.Background(), tt.selector)
+		if err != nil {
+			t.Fatalf("ListInstances(%v) error = %v", tt.selector, err)
+		}
+		var names []string
+		for _, inst := range instances {
+			names = append(names, inst.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("ListInstances(%v) = %v, want %v", tt.selector, names, tt.want)
+		}
+	}
+
+	instances, _ := c.ListInstances(context.Background(), map[string]string{"user.cluster": "one"})
+	if instances[0].Location != "" || instances[1].Location != "member-1" {
+		t.Errorf("locations = %q, %q, want \"\", \"member-1\"", instances[0].Location, instances[1].Location)
+	}
+}
+
+func TestGetInstanceNotFound(t *testing.T) {
+	c := newTestClient(&instanceServer{err: api.StatusErrorf(http.StatusNotFound, "Instance not found")})
+
+	_, err := c.GetInstance(context.Background(), "vm")
+	if !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("GetInstance() error = %v, want %v", err, ErrInstanceNotFound)
+	}
+
+	exists, err := c.InstanceExists(context.Background(), "vm")
+	if err != nil || exists {
+		t.Errorf("InstanceExists() = %v, %v, want false, nil", exists, err)
+	}
+}
+
+func TestReconnectAfterDroppedConnection(t *testing.T) {
+	dropped := &instanceServer{err: &url.Error{Op: "Get", URL: "http://unix.socket/1.0/instances/vm", Err: syscall.ECONNREFUSED}}
+	healthy := &instanceServer{}
+	servers := []incus.InstanceServer{dropped, healthy}
+	dials := 0
+	c := &clientImpl{dial: func(_ context.Context) (incus.InstanceServer, error) {
+		server := servers[dials]
+		dials++
+		return server, nil
+	}}
+
+	if _, err := c.InstanceExists(context.Background(), "vm"); err == nil {
+		t.Fatal("InstanceExists() succeeded over a dropped connection")
+	}
+	exists, err := c.InstanceExists(context.Background(), "vm")
+	if err != nil {
+		t.Fatalf("InstanceExists() after reconnect error = %v", err)
+	}
+	if !exists {
+		t.Error("InstanceExists() = false, want true")
+	}
+	if dials != 2 {
+		t.Errorf("dials = %d, want 2", dials)
+	}
+}
+
+func TestKeepConnectionOnAPIError(t *testing.T) {
+	dials := 0
+	c := &clientImpl{dial: func(_ context.Context) (incus.InstanceServer, error) {
+		dials++
+		return &instanceServer{err: api.StatusErrorf(http.StatusInternalServerError, "boom")}, nil
+	}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.InstanceExists(context.Background(), "vm"); err == nil {
+			t.Fatal("InstanceExists() succeeded, want API error")
+		}
+	}
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+}
+
+// snapshotServer keeps the snapshots of instances in memory.
+type snapshotServer struct {
+	incus.InstanceServer
+	// snapshots maps instance names to their snapshots.
+	snapshots map[string][]api.InstanceSnapshotsPost
+	restores  []api.InstancePut
+}
+
+func (s *snapshotServer) CreateInstanceSnapshot(instance string, snapshot api.InstanceSnapshotsPost) (incus.Operation, error) {
+	if _, ok := s.snapshots[instance]; !ok {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	s.snapshots[instance] = append(s.snapshots[instance], snapshot)
+	return &fakeOperation{}, nil
+}
+
+func (s *snapshotServer) GetInstanceSnapshotNames(instance string) ([]string, error) {
+	snapshots, ok := s.snapshots[instance]
+	if !ok {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	names := []string{}
+	for _, snap := range snapshots {
+		names = append(names, snap.Name)
+	}
+	return names, nil
+}
+
+func (s *snapshotServer) UpdateInstance(_ string, put api.InstancePut, _ string) (incus.Operation, error) {
+	s.restores = append(s.restores, put)
+	return &fakeOperation{}, nil
+}
+
+func TestSnapshots(t *testing.T) {
+	server := &snapshotServer{snapshots: map[string][]api.InstanceSnapshotsPost{"vm": nil}}
+	c := newTestClient(server)
+	ctx := context.Background()
+
+	if err := c.CreateSnapshot(ctx, "vm", "before-upgrade", false); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+	if err := c.CreateSnapshot(ctx, "vm", "with-memory", true); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+	want := []api.InstanceSnapshotsPost{{Name: "before-upgrade"}, {Name: "with-memory", Stateful: true}}
+	if !reflect.DeepEqual(server.snapshots["vm"], want) {
+		t.Errorf("snapshots = %+v, want %+v", server.snapshots["vm"], want)
+	}
+
+	names, err := c.ListSnapshots(ctx, "vm")
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+	if !slices.Equal(names, []string{"before-upgrade", "with-memory"}) {
+		t.Errorf("ListSnapshots() = %v, want [before-upgrade with-memory]", names)
+	}
+
+	if err := c.RestoreSnapshot(ctx, "vm", "with-memory", true); err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if len(server.restores) != 1 || server.restores[0].Restore != "with-memory" || !server.restores[0].Stateful {
+		t.Errorf("restores = %+v, want a stateful restore of with-memory", server.restores)
+	}
+
+	if err := c.CreateSnapshot(ctx, "missing", "snap", false); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("CreateSnapshot() error = %v for a missing instance, want ErrInstanceNotFound", err)
+	}
+	if _, err := c.ListSnapshots(ctx, "missing"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("ListSnapshots() error = %v for a missing instance, want ErrInstanceNotFound", err)
+	}
+}
+
+// failingServer fails every instance request with err.
+type failingServer struct {
+	instanceServer
+}
+
+func (s *failingServer) GetInstanceState(string) (*api.InstanceState, string, error) {
+	return nil, "", s.err
+}
+
+func (s *failingServer) GetProfile(string) (*api.Profile, string, error) {
+	return nil, "", s.err
+}
+
+func (s *failingServer) CreateInstance(api.InstancesPost) (incus.Operation, error) {
+	return nil, s.err
+}
+
+func TestErrorClassification(t *testing.T) {
+	notFound := api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	refused := &url.Error{Op: "Get", URL: "http://unix.socket/1.0/instances/vm", Err: syscall.ECONNREFUSED}
+	internal := api.StatusErrorf(http.StatusInternalServerError, "boom")
+	busy := api.StatusErrorf(http.StatusServiceUnavailable, "Daemon is busy")
+
+	calls := map[string]func(Client) error{
+		"GetInstance": func(c Client) error {
+			_, err := c.GetInstance(context.Background(), "vm")
+			return err
+		},
+		"GetInstanceState": func(c Client) error {
+			_, err := c.GetInstanceState(context.Background(), "vm")
+			return err
+		},
+		"InstanceLocation": func(c Client) error {
+			_, err := c.InstanceLocation(context.Background(), "vm")
+			return err
+		},
+		"UpdateInstanceConfig": func(c Client) error {
+			return c.UpdateInstanceConfig(context.Background(), "vm", map[string]string{"user.key": "value"})
+		},
+		"StopInstance": func(c Client) error {
+			return c.StopInstance(context.Background(), "vm", time.Second)
+		},
+		"StartInstance": func(c Client) error {
+			return c.StartInstance(context.Background(), "vm")
+		},
+		"DeleteInstance": func(c Client) error {
+			return c.DeleteInstance(context.Background(), "vm")
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call(newTestClient(&failingServer{instanceServer{err: notFound}}))
+			if !errors.Is(err, ErrInstanceNotFound) || errors.Is(err, ErrConnection) {
+				t.Errorf("error = %v for a missing instance, want ErrInstanceNotFound", err)
+			}
+			if !api.StatusErrorCheck(err, http.StatusNotFound) {
+				t.Errorf("error = %v does not wrap the Incus status error", err)
+			}
+
+			err = call(newTestClient(&failingServer{instanceServer{err: refused}}))
+			if !errors.Is(err, ErrConnection) || errors.Is(err, ErrInstanceNotFound) {
+				t.Errorf("error = %v for a refused connection, want ErrConnection", err)
+			}
+			var urlErr *url.Error
+			if !errors.As(err, &urlErr) {
+				t.Errorf("error = %v does not wrap the transport error", err)
+			}
+
+			err = call(newTestClient(&failingServer{instanceServer{err: busy}}))
+			if !errors.Is(err, ErrTransient) || errors.Is(err, ErrConnection) {
+				t.Errorf("error = %v for a busy server, want ErrTransient", err)
+			}
+
+			err = call(newTestClient(&failingServer{instanceServer{err: internal}}))
+			if err == nil || errors.Is(err, ErrConnection) || errors.Is(err, ErrInstanceNotFound) || errors.Is(err, ErrTransient) {
+				t.Errorf("error = %v for an API error, want an unclassified error", err)
+			}
+		})
+	}
+
+	t.Run("CreateInstance", func(t *testing.T) {
+		req := CreateInstanceRequest{Name: "vm", Image: "images:missing", Profiles: []string{"default"}}
+		for _, tc := range []struct {
+			name string
+			err  error
+			want error
+		}{
+			{name: "MissingImage", err: api.StatusErrorf(http.StatusNotFound, "Image not found"), want: ErrInvalidRequest},
+			{name: "BadRequest", err: api.StatusErrorf(http.StatusBadRequest, "Invalid devices"), want: ErrInvalidRequest},
+			{name: "Busy", err: busy, want: ErrTransient},
+			{name: "TooManyRequests", err: api.StatusErrorf(http.StatusTooManyRequests, "Too many requests"), want: ErrTransient},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				err := newTestClient(&failingServer{instanceServer{err: tc.err}}).CreateInstance(context.Background(), req)
+				if !errors.Is(err, tc.want) {
+					t.Errorf("CreateInstance() error = %v, want %v", err, tc.want)
+				}
+			})
+		}
+
+		invalid := req
+		invalid.VendorData = "#cloud-config\n- not a mapping\n"
+		err := newTestClient(&fakeServer{}).CreateInstance(context.Background(), invalid)
+		if !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("CreateInstance() error = %v for invalid vendor-data, want ErrInvalidRequest", err)
+		}
+	})
+
+	t.Run("ProfileExists", func(t *testing.T) {
+		_, err := newTestClient(&failingServer{instanceServer{err: refused}}).ProfileExists(context.Background(), "default")
+		if !errors.Is(err, ErrConnection) {
+			t.Errorf("ProfileExists() error = %v, want ErrConnection", err)
+		}
+	})
+
+	t.Run("Connect", func(t *testing.T) {
+		c := NewClient(WithSocketPath(filepath.Join(t.TempDir(), "missing.socket")), WithConnectRetry(1, time.Millisecond))
+		if err := c.Connect(context.Background()); !errors.Is(err, ErrConnection) {
+			t.Errorf("Connect() error = %v, want ErrConnection", err)
+		}
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		c := NewClient(WithRemote("http://incus.example.com:8443", "cert", "key", ""))
+		if err := c.Connect(context.Background()); err == nil || errors.Is(err, ErrConnection) {
+			t.Errorf("Connect() error = %v, want a configuration error", err)
+		}
+	})
+}
+
+// pingServer answers GetServer after delay with err.
+type pingServer struct {
+	incus.InstanceServer
+	delay time.Duration
+	err   error
+}
+
+func (s *pingServer) GetServer() (*api.Server, string, error) {
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return nil, "", s.err
+	}
+	return &api.Server{}, "", nil
+}
+
+func TestPing(t *testing.T) {
+	if err := newTestClient(&pingServer{}).Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	refused := &url.Error{Op: "Get", URL: "http://unix.socket/1.0", Err: syscall.ECONNREFUSED}
+	if err := newTestClient(&pingServer{err: refused}).Ping(context.Background()); !errors.Is(err, ErrConnection) {
+		t.Errorf("Ping() error = %v for a dropped connection, want ErrConnection", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := newTestClient(&pingServer{delay: time.Second}).Ping(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrConnection) {
+		t.Errorf("Ping() error = %v for a hung server, want ErrConnection and %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Ping() took %v, want it to give up at the deadline", elapsed)
+	}
+}
+
+func TestPingClosedSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "incus.socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socket, err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+
+	c := NewClient(WithSocketPath(socket), WithConnectRetry(1, time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Ping(ctx); !errors.Is(err, ErrConnection) {
+		t.Errorf("Ping() error = %v against a closed socket, want ErrConnection", err)
+	}
+}
+
+func TestConnectRespectsContext(t *testing.T) {
+	c := &clientImpl{dial: func(_ context.Context) (incus.InstanceServer, error) {
+		t.Fatal("dial called with a cancelled context")
+		return nil, nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Connect(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Connect() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	c := &clientImpl{
+		clientConfig: clientConfig{connectTimeout: 20 * time.Millisecond},
+		dial: func(ctx context.Context) (incus.InstanceServer, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	start := time.Now()
+	err := c.Connect(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Connect() took %v, want it bounded by the connect timeout", elapsed)
+	}
+}
+
+func TestConnectRetries(t *testing.T) {
+	dials := 0
+	c := &clientImpl{
+		clientConfig: clientConfig{connectAttempts: 5, connectMaxDelay: time.Millisecond},
+		dial: func(_ context.Context) (incus.InstanceServer, error) {
+			dials++
+			if dials <= 3 {
+				return nil, syscall.ECONNREFUSED
+			}
+			return &instanceServer{}, nil
+		},
+	}
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if dials != 4 {
+		t.Errorf("dials = %d, want 4", dials)
+	}
+}
+
+func TestConnectDoesNotRetryConfigurationErrors(t *testing.T) {
+	dials := 0
+	c := &clientImpl{
+		clientConfig: clientConfig{connectAttempts: 5, connectMaxDelay: time.Millisecond},
+		dial: func(_ context.Context) (incus.InstanceServer, error) {
+			dials++
+			return nil, errors.New("incomplete remote Incus configuration")
+		},
+	}
+
+	if err := c.Connect(context.Background()); err == nil {
+		t.Fatal("Connect() succeeded, want configuration error")
+	}
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	dials := 0
+	c := &clientImpl{
+		clientConfig: clientConfig{connectAttempts: 3, connectMaxDelay: time.Millisecond},
+		dial: func(_ context.Context) (incus.InstanceServer, error) {
+			dials++
+			return nil, syscall.ECONNREFUSED
+		},
+	}
+
+	err := c.Connect(context.Background())
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Connect() error = %v, want it to wrap %v", err, syscall.ECONNREFUSED)
+	}
+	if dials != 3 {
+		t.Errorf("dials = %d, want 3", dials)
+	}
+}
+
+func TestConnectRetryRespectsContext(t *testing.T) {
+	c := &clientImpl{
+		clientConfig: clientConfig{connectAttempts: 5, connectMaxDelay: time.Hour},
+		dial: func(_ context.Context) (incus.InstanceServer, error) {
+			return nil, syscall.ECONNREFUSED
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.Connect(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Connect() took %v after its context expired", elapsed)
+	}
+}
+
+// projectServer keeps instances per project, like an Incus server with
+// project isolation.
+type projectServer struct {
+	incus.InstanceServer
+	project   string
+	instances map[string]map[string]bool
+}
+
+func newProjectServer() *projectServer {
+	return &projectServer{project: "default", instances: map[string]map[string]bool{}}
+}
+
+func (s *projectServer) UseProject(name string) incus.InstanceServer {
+	return &projectServer{project: name, instances: s.instances}
+}
+
+func (s *projectServer) CreateInstance(req api.InstancesPost) (incus.Operation, error) {
+	if s.instances[s.project] == nil {
+		s.instances[s.project] = map[string]bool{}
+	}
+	s.instances[s.project][req.Name] = true
+	return &fakeOperation{}, nil
+}
+
+func (s *projectServer) GetInstance(name string) (*api.Instance, string, error) {
+	if !s.instances[s.project][name] {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return &api.Instance{Name: name, Project: s.project}, "", nil
+}
+
+func (s *projectServer) GetInstanceFull(name string) (*api.InstanceFull, string, error) {
+	inst, etag, err := s.GetInstance(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return &api.InstanceFull{Instance: *inst}, etag, nil
+}
+
+func (s *projectServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	if !s.instances[s.project][name] {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return &api.InstanceState{Status: "Stopped", StatusCode: api.Stopped}, "", nil
+}
+
+func (s *projectServer) DeleteInstance(name string) (incus.Operation, error) {
+	if !s.instances[s.project][name] {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	delete(s.instances[s.project], name)
+	return &fakeOperation{}, nil
+}
+
+func TestProjectIsolation(t *testing.T) {
+	server := newProjectServer()
+	dial := func(_ context.Context) (incus.InstanceServer, error) {
+		return server, nil
+	}
+	ctx := context.Background()
+	a := &clientImpl{dial: dial}
+	WithProject("a")(a)
+	b := a.UseProject("b")
+
+	if err := a.CreateInstance(ctx, CreateInstanceRequest{Name: "vm"}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if exists, err := a.InstanceExists(ctx, "vm"); err != nil || !exists {
+		t.Errorf("InstanceExists() in project a = %v, %v, want true", exists, err)
+	}
+	if exists, err := b.InstanceExists(ctx, "vm"); err != nil || exists {
+		t.Errorf("InstanceExists() in project b = %v, %v, want false", exists, err)
+	}
+	if err := b.DeleteInstance(ctx, "vm"); err == nil {
+		t.Error("DeleteInstance() in project b removed an instance of project a")
+	}
+	if !server.instances["a"]["vm"] {
+		t.Error("instance missing from project a")
+	}
+}
+
+func TestUseProjectCachesClients(t *testing.T) {
+	c := NewClient()
+	if c.UseProject("") != c {
+		t.Error("UseProject(\"\") did not return the client itself")
+	}
+	if c.UseProject("a") != c.UseProject("a") {
+		t.Error("UseProject(\"a\") returned different clients")
+	}
+}
+
+func TestUseProjectKeepsSettings(t *testing.T) {
+	c := NewClient(
+		WithRemote("https://incus.example.com:8443", "cert", "key", "server-cert"),
+		WithServerCertFingerprint("abc123"),
+		WithUserAgent("capi-test"),
+		WithHTTPTimeout(time.Minute),
+		WithConnectRetry(7, time.Second),
+		WithMaxConcurrentOperations(3),
+	).(*clientImpl)
+
+	p := c.UseProject("tenant-a").(*clientImpl)
+	if p.project != "tenant-a" {
+		t.Errorf("project = %q, want tenant-a", p.project)
+	}
+	if !reflect.DeepEqual(p.clientConfig, c.clientConfig) {
+		t.Errorf("settings = %+v, want %+v", p.clientConfig, c.clientConfig)
+	}
+}
+
+// generateClientCert returns a PEM encoded self-signed client certificate and key.
+func generateClientCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "capi-incus-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+// idleTransport counts the calls to CloseIdleConnections.
+type idleTransport struct {
+	http.RoundTripper
+	closed atomic.Int32
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closed.Add(1)
+}
+
+// connServer is an instanceServer with an HTTP client.
+type connServer struct {
+	instanceServer
+	httpClient *http.Client
+}
+
+func (s *connServer) GetHTTPClient() (*http.Client, error) {
+	return s.httpClient, nil
+}
+
+func TestCloseReconnects(t *testing.T) {
+	transport := &idleTransport{}
+	server := &connServer{httpClient: &http.Client{Transport: transport}}
+	var dials atomic.Int32
+	c := &clientImpl{dial: func(context.Context) (incus.InstanceServer, error) {
+		dials.Add(1)
+		return server, nil
+	}}
+
+	for range 2 {
+		if _, err := c.GetInstance(context.Background(), "vm"); err != nil {
+			t.Fatalf("GetInstance() error = %v", err)
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Fatalf("dials = %d before Close, want 1", got)
+	}
+
+	for range 2 {
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	if got := transport.closed.Load(); got != 1 {
+		t.Errorf("idle connections closed %d times, want 1", got)
+	}
+
+	if _, err := c.GetInstance(context.Background(), "vm"); err != nil {
+		t.Fatalf("GetInstance() after Close error = %v", err)
+	}
+	if got := dials.Load(); got != 2 {
+		t.Errorf("dials = %d after Close, want 2", got)
+	}
+}
+
+func TestCloseDuringRequests(t *testing.T) {
+	server := &connServer{httpClient: &http.Client{Transport: &idleTransport{}}}
+	c := &clientImpl{dial: func(context.Context) (incus.InstanceServer, error) {
+		return server, nil
+	}}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, err := c.GetInstance(context.Background(), "vm"); err != nil {
+					t.Errorf("GetInstance() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for range 100 {
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+// networkServer serves a single network used by usedBy.
+type networkServer struct {
+	incus.InstanceServer
+	name   string
+	usedBy []string
+}
+
+func (s *networkServer) GetNetwork(name string) (*api.Network, string, error) {
+	if name != s.name {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Network not found")
+	}
+	return &api.Network{Name: name, UsedBy: s.usedBy}, "", nil
+}
+
+func TestNetworkInstances(t *testing.T) {
+	c := newTestClient(&networkServer{name: "capi-net", usedBy: []string{
+		"/1.0/profiles/default",
+		"/1.0/instances/worker-1?project=capi",
+		"/1.0/instances/control-plane-1",
+	}})
+
+	got, err := c.NetworkInstances(context.Background(), "capi-net")
+	if err != nil {
+		t.Fatalf("NetworkInstances() error = %v", err)
+	}
+	if want := []string{"control-plane-1", "worker-1"}; !slices.Equal(got, want) {
+		t.Errorf("NetworkInstances() = %v, want %v", got, want)
+	}
+
+	got, err = c.NetworkInstances(context.Background(), "missing")
+	if err != nil || got != nil {
+		t.Errorf("NetworkInstances() = %v, %v for a missing network, want nil, nil", got, err)
+	}
+}
+
+func TestSanitizeInstanceName(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "valid name unchanged", input: "worker-0", want: "worker-0"},
+		{name: "dots replaced", input: "worker.example.com", want: "worker-example-com-"},
+		{name: "too long", input: long, want: strings.Repeat("a", 54) + "-"},
+		{name: "numeric", input: "1234", want: "1234-"},
+		{name: "only invalid characters", input: "...", want: "instance-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeInstanceName(tt.input)
+			if tt.want == tt.input {
+				if got != tt.want {
+					t.Fatalf("SanitizeInstanceName(%q) = %q, want %q", tt.input, got, tt.want)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, tt.want) || len(got) != len(tt.want)+8 {
+				t.Fatalf("SanitizeInstanceName(%q) = %q, want %q followed by an 8 character hash", tt.input, got, tt.want)
+			}
+			if !validInstanceName(got) {
+				t.Fatalf("SanitizeInstanceName(%q) = %q, which is not a valid instance name", tt.input, got)
+			}
+			if again := SanitizeInstanceName(tt.input); again != got {
+				t.Fatalf("SanitizeInstanceName(%q) is not stable: %q then %q", tt.input, got, again)
+			}
+		})
+	}
+}
+
+func TestSanitizeInstanceNameUnique(t *testing.T) {
+	a := SanitizeInstanceName("worker.0")
+	b := SanitizeInstanceName("worker_0")
+	if a == b {
+		t.Fatalf("SanitizeInstanceName mapped worker.0 and worker_0 to the same name %q", a)
+	}
+	if a == "worker-0" || b == "worker-0" {
+		t.Fatalf("sanitized names %q and %q collide with the valid name worker-0", a, b)
+	}
+}
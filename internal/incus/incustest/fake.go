@@ -0,0 +1,751 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package incustest provides an in-memory incus.Client for tests and local
+// development without an Incus daemon.
+package incustest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+// FakeClient is an in-memory incus.Client. Its fields may be set before it
+// is used and inspected once the code under test is done with it.
+type FakeClient struct {
+	mu sync.Mutex
+	// Instances maps instance names to their config.
+	Instances map[string]map[string]string
+	// InstanceProfiles maps instance names to their profiles. Instances
+	// without an entry have the "default" profile.
+	InstanceProfiles map[string][]string
+	// InstanceDevices maps instance names to their local devices.
+	InstanceDevices map[string]map[string]map[string]string
+	// Warnings maps instance names to the warnings Incus reports for them.
+	Warnings map[string][]string
+	// Profiles holds the names of the profiles that exist.
+	Profiles map[string]bool
+	// MissingImages holds the aliases and fingerprints of the images the
+	// server does not have. All other images exist.
+	MissingImages map[string]bool
+	// Pools holds the names of the storage pools that exist.
+	Pools map[string]bool
+	// Networks maps the names of existing networks to their config.
+	Networks map[string]map[string]string
+	// AttachedInstances maps network names to instances attached to them,
+	// in addition to those with a NIC on the network in InstanceDevices.
+	AttachedInstances map[string][]string
+	// States overrides the state reported for an instance. Instances
+	// without an entry are reported as running with the address 10.0.0.2.
+	States map[string]*incus.InstanceState
+	// InstanceTypes maps instance names to their type. Instances without an
+	// entry are virtual machines.
+	InstanceTypes map[string]string
+	// ConsoleLogs maps instance names to their console log.
+	ConsoleLogs map[string]string
+	// ExecResults maps instance names to the result of every command run
+	// in them with Exec. Instances without an entry run commands
+	// successfully without output.
+	ExecResults map[string]ExecResult
+	// ExecCalls records the commands run with Exec, as "instance:command".
+	ExecCalls []string
+	// Location is reported as the cluster member of every instance.
+	Location string
+	// Snapshots maps instance names to their snapshots.
+	Snapshots map[string][]api.InstanceSnapshotsPost
+	// Stopped holds the names of the instances stopped with StopInstance
+	// and not started since. Without an entry in States they are reported
+	// as stopped without addresses.
+	Stopped map[string]bool
+	// Moves records the instance moves, as "instance:member".
+	Moves []string
+	// Lingering maps instance names to the number of InstanceExists calls
+	// that still report them after they were deleted.
+	Lingering map[string]int
+	// Members is reported by GetClusterMembers.
+	Members []incus.ClusterMember
+	// ServerInfo is reported by GetServerInfo.
+	ServerInfo incus.ServerInfo
+	// Calls records the name of every method called, in order.
+	Calls []string
+	// Errors maps method names to the error they return. Set entries with
+	// FailOn.
+	Errors map[string]error
+	// CreateCalls, PlanCalls and DeleteCalls record the arguments of
+	// CreateInstance, PlanInstance and DeleteInstance, including calls
+	// that failed.
+	CreateCalls []incus.CreateInstanceRequest
+	PlanCalls   []incus.CreateInstanceRequest
+	DeleteCalls []string
+	// CreateDelay, when set, makes CreateInstance take that long, failing
+	// with the context's error if it is done first.
+	CreateDelay time.Duration
+	// RacedConfig, when set, makes CreateInstance fail with
+	// ErrInstanceExists as if a concurrent create had won, leaving an
+	// instance with this config behind.
+	RacedConfig map[string]string
+	// Projects holds the clients returned by UseProject, keyed by project.
+	Projects map[string]*FakeClient
+}
+
+var _ incus.Client = &FakeClient{}
+
+// ExecResult is the outcome of a command run with FakeClient.Exec.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// NewFakeClient returns a FakeClient without instances, with a "default"
+// profile and storage pool, reporting an Incus 6.0 server.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		Instances:        map[string]map[string]string{},
+		InstanceProfiles: map[string][]string{},
+		InstanceDevices:  map[string]map[string]map[string]string{},
+		Warnings:         map[string][]string{},
+		Networks:         map[string]map[string]string{},
+		Profiles:         map[string]bool{"default": true},
+		Pools:            map[string]bool{"default": true},
+		MissingImages:    map[string]bool{},
+		States:           map[string]*incus.InstanceState{},
+		InstanceTypes:    map[string]string{},
+		Projects:         map[string]*FakeClient{},
+		Snapshots:        map[string][]api.InstanceSnapshotsPost{},
+		Stopped:          map[string]bool{},
+		Lingering:        map[string]int{},
+		ConsoleLogs:      map[string]string{},
+		ExecResults:      map[string]ExecResult{},
+		Errors:           map[string]error{},
+		ServerInfo: incus.ServerInfo{
+			Version:         "6.0.4",
+			APIExtensions:   []string{"instances"},
+			StorageDriver:   "dir",
+			VirtualMachines: true,
+		},
+	}
+}
+
+// FailOn makes method fail with err until it is called again with a nil err.
+func (f *FakeClient) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.Errors, method)
+		return
+	}
+	f.Errors[method] = err
+}
+
+// CallCount returns how many times method was called.
+func (f *FakeClient) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, call := range f.Calls {
+		if call == method {
+			n++
+		}
+	}
+	return n
+}
+
+// HasInstance reports whether the instance name exists.
+func (f *FakeClient) HasInstance(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.Instances[name]
+	return ok
+}
+
+// record records a call to method and returns the error injected for it.
+// f.mu must be held.
+func (f *FakeClient) record(method string) error {
+	f.Calls = append(f.Calls, method)
+	return f.Errors[method]
+}
+
+func (f *FakeClient) Connect(_ context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("Connect")
+}
+
+func (f *FakeClient) Ping(_ context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("Ping")
+}
+
+func (f *FakeClient) CreateInstance(ctx context.Context, req incus.CreateInstanceRequest) error {
+	if f.CreateDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.CreateDelay):
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.CreateCalls = append(f.CreateCalls, req)
+	if err := f.record("CreateInstance"); err != nil {
+		return err
+	}
+	if f.RacedConfig != nil {
+		f.Instances[req.Name] = f.RacedConfig
+		return fmt.Errorf("%w: %s", incus.ErrInstanceExists, req.Name)
+	}
+	config := map[string]string{
+		"limits.cpu":    incus.CPULimit(req.CPUs, req.CPUPinning),
+		"limits.memory": fmt.Sprintf("%dMiB", req.MemoryMiB),
+	}
+	for k, v := range req.Config {
+		config[k] = v
+	}
+	f.Instances[req.Name] = config
+	if len(req.Profiles) > 0 {
+		f.InstanceProfiles[req.Name] = slices.Clone(req.Profiles)
+	}
+	f.InstanceDevices[req.Name] = maps.Clone(req.Devices)
+	if req.Network != "" {
+		if f.InstanceDevices[req.Name] == nil {
+			f.InstanceDevices[req.Name] = map[string]map[string]string{}
+		}
+		f.InstanceDevices[req.Name]["eth0"] = map[string]string{"type": "nic", "name": "eth0", "network": req.Network}
+	}
+	if req.InstanceType != "" {
+		f.InstanceTypes[req.Name] = req.InstanceType
+	}
+	return nil
+}
+
+// PlanInstance returns a request carrying the name, image, config and user-data
+// of req; the real request is covered by the incus package tests.
+func (f *FakeClient) PlanInstance(_ context.Context, req incus.CreateInstanceRequest) (api.InstancesPost, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.PlanCalls = append(f.PlanCalls, req)
+	if err := f.record("PlanInstance"); err != nil {
+		return api.InstancesPost{}, err
+	}
+	config := maps.Clone(req.Config)
+	if config == nil {
+		config = map[string]string{}
+	}
+	if req.UserData != "" {
+		config["cloud-init.user-data"] = req.UserData
+	}
+	return api.InstancesPost{
+		Name:        req.Name,
+		InstancePut: api.InstancePut{Config: config},
+		Source:      api.InstanceSource{Type: "image", Alias: req.Image},
+	}, nil
+}
+
+func (f *FakeClient) DeleteInstance(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.DeleteCalls = append(f.DeleteCalls, name)
+	if err := f.record("DeleteInstance"); err != nil {
+		return err
+	}
+	if f.Instances[name]["security.protection.delete"] == "true" {
+		return fmt.Errorf("instance %s is protected", name)
+	}
+	delete(f.Instances, name)
+	delete(f.InstanceProfiles, name)
+	delete(f.InstanceDevices, name)
+	return nil
+}
+
+func (f *FakeClient) StopInstance(_ context.Context, name string, _ time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StopInstance"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	f.Stopped[name] = true
+	return nil
+}
+
+func (f *FakeClient) StartInstance(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StartInstance"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	delete(f.Stopped, name)
+	return nil
+}
+
+func (f *FakeClient) MoveInstance(_ context.Context, name, targetMember string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("MoveInstance"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	f.Moves = append(f.Moves, name+":"+targetMember)
+	f.Location = targetMember
+	return nil
+}
+
+func (f *FakeClient) GetInstance(_ context.Context, name string) (*incus.InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetInstance"); err != nil {
+		return nil, err
+	}
+	config, ok := f.Instances[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	state := f.state(name)
+	instanceType := f.InstanceTypes[name]
+	if instanceType == "" {
+		instanceType = "virtual-machine"
+	}
+	profiles, ok := f.InstanceProfiles[name]
+	if !ok {
+		profiles = []string{"default"}
+	}
+	return &incus.InstanceInfo{
+		Name:        name,
+		Type:        instanceType,
+		Status:      state.Status,
+		Location:    f.Location,
+		Addresses:   state.Addresses,
+		Config:      maps.Clone(config),
+		Profiles:    slices.Clone(profiles),
+		Devices:     maps.Clone(f.InstanceDevices[name]),
+		CPULimit:    config["limits.cpu"],
+		MemoryLimit: config["limits.memory"],
+	}, nil
+}
+
+func (f *FakeClient) InstanceExists(_ context.Context, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("InstanceExists"); err != nil {
+		return false, err
+	}
+	if f.Lingering[name] > 0 {
+		f.Lingering[name]--
+		return true, nil
+	}
+	_, ok := f.Instances[name]
+	return ok, nil
+}
+
+func (f *FakeClient) FindInstanceByConfig(_ context.Context, key, value string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("FindInstanceByConfig"); err != nil {
+		return "", err
+	}
+	for name, config := range f.Instances {
+		if config[key] == value {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *FakeClient) CreateSnapshot(_ context.Context, instance, name string, stateful bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CreateSnapshot"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[instance]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, instance)
+	}
+	f.Snapshots[instance] = append(f.Snapshots[instance], api.InstanceSnapshotsPost{Name: name, Stateful: stateful})
+	return nil
+}
+
+func (f *FakeClient) RestoreSnapshot(_ context.Context, instance, name string, _ bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RestoreSnapshot"); err != nil {
+		return err
+	}
+	for _, snap := range f.Snapshots[instance] {
+		if snap.Name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("snapshot %s of instance %s not found", name, instance)
+}
+
+func (f *FakeClient) ListSnapshots(_ context.Context, instance string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ListSnapshots"); err != nil {
+		return nil, err
+	}
+	if _, ok := f.Instances[instance]; !ok {
+		return nil, fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, instance)
+	}
+	var names []string
+	for _, snap := range f.Snapshots[instance] {
+		names = append(names, snap.Name)
+	}
+	return names, nil
+}
+
+func (f *FakeClient) ListInstances(_ context.Context, selector map[string]string) ([]incus.InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ListInstances"); err != nil {
+		return nil, err
+	}
+	var result []incus.InstanceInfo
+	for name, config := range f.Instances {
+		matches := true
+		for k, v := range selector {
+			if config[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			result = append(result, incus.InstanceInfo{Name: name, Config: maps.Clone(config)})
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeClient) InstanceLocation(_ context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("InstanceLocation"); err != nil {
+		return "", err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return "", fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	return f.Location, nil
+}
+
+func (f *FakeClient) GetInstanceState(_ context.Context, name string) (*incus.InstanceState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetInstanceState"); err != nil {
+		return nil, err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	return f.state(name), nil
+}
+
+func (f *FakeClient) GetConsoleLog(_ context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetConsoleLog"); err != nil {
+		return "", err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return "", fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	return f.ConsoleLogs[name], nil
+}
+
+func (f *FakeClient) Exec(_ context.Context, name string, cmd []string) (string, string, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ExecCalls = append(f.ExecCalls, name+":"+strings.Join(cmd, " "))
+	if err := f.record("Exec"); err != nil {
+		return "", "", 0, err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return "", "", 0, fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	result := f.ExecResults[name]
+	return result.Stdout, result.Stderr, result.ExitCode, nil
+}
+
+// state returns the state reported for the instance name. f.mu must be
+// held.
+func (f *FakeClient) state(name string) *incus.InstanceState {
+	if state, ok := f.States[name]; ok {
+		return state
+	}
+	if f.Stopped[name] {
+		return &incus.InstanceState{Status: "Stopped"}
+	}
+	return &incus.InstanceState{Status: "Running", Addresses: []string{"10.0.0.2"}}
+}
+
+func (f *FakeClient) GetInstanceConfig(_ context.Context, name string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetInstanceConfig"); err != nil {
+		return nil, err
+	}
+	config, ok := f.Instances[name]
+	if !ok {
+		return nil, nil
+	}
+	return maps.Clone(config), nil
+}
+
+func (f *FakeClient) InstanceWarnings(_ context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("InstanceWarnings"); err != nil {
+		return nil, err
+	}
+	return f.Warnings[name], nil
+}
+
+func (f *FakeClient) UpdateInstanceConfig(_ context.Context, name string, config map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("UpdateInstanceConfig"); err != nil {
+		return err
+	}
+	return f.updateInstanceConfig(name, config)
+}
+
+// updateInstanceConfig sets the config keys of the instance name, removing
+// those set to "". f.mu must be held.
+func (f *FakeClient) updateInstanceConfig(name string, config map[string]string) error {
+	current, ok := f.Instances[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	for k, v := range config {
+		if v == "" {
+			delete(current, k)
+			continue
+		}
+		current[k] = v
+	}
+	return nil
+}
+
+func (f *FakeClient) SetInstanceLabels(_ context.Context, name string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetInstanceLabels"); err != nil {
+		return err
+	}
+	for k := range labels {
+		if !strings.HasPrefix(k, "user.") {
+			return fmt.Errorf("instance label %q is not a user.* config key", k)
+		}
+	}
+	return f.updateInstanceConfig(name, labels)
+}
+
+func (f *FakeClient) UpdateInstanceResources(_ context.Context, name string, cpuLimit string, memoryMiB int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("UpdateInstanceResources"); err != nil {
+		return err
+	}
+	current, ok := f.Instances[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	current["limits.cpu"] = cpuLimit
+	current["limits.memory"] = fmt.Sprintf("%dMiB", memoryMiB)
+	return nil
+}
+
+func (f *FakeClient) UpdateInstanceProfiles(_ context.Context, name string, profiles []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("UpdateInstanceProfiles"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	f.InstanceProfiles[name] = slices.Clone(profiles)
+	return nil
+}
+
+func (f *FakeClient) UpdateInstanceDevices(_ context.Context, name string, devices map[string]map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("UpdateInstanceDevices"); err != nil {
+		return err
+	}
+	if _, ok := f.Instances[name]; !ok {
+		return fmt.Errorf("%w: %s", incus.ErrInstanceNotFound, name)
+	}
+	current := f.InstanceDevices[name]
+	if current == nil {
+		current = map[string]map[string]string{}
+		f.InstanceDevices[name] = current
+	}
+	for k, device := range devices {
+		if device == nil {
+			delete(current, k)
+			continue
+		}
+		current[k] = maps.Clone(device)
+	}
+	return nil
+}
+
+func (f *FakeClient) NetworkExists(_ context.Context, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("NetworkExists"); err != nil {
+		return false, err
+	}
+	_, ok := f.Networks[name]
+	return ok, nil
+}
+
+func (f *FakeClient) ProfileExists(_ context.Context, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ProfileExists"); err != nil {
+		return false, err
+	}
+	return f.Profiles[name], nil
+}
+
+func (f *FakeClient) ImageExists(_ context.Context, image string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ImageExists"); err != nil {
+		return false, err
+	}
+	return !f.MissingImages[image], nil
+}
+
+func (f *FakeClient) StoragePoolExists(_ context.Context, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StoragePoolExists"); err != nil {
+		return false, err
+	}
+	return f.Pools[name], nil
+}
+
+func (f *FakeClient) EnsureNetwork(_ context.Context, name string, config map[string]string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("EnsureNetwork"); err != nil {
+		return false, err
+	}
+	if _, ok := f.Networks[name]; ok {
+		return false, nil
+	}
+	networkConfig := map[string]string{}
+	for k, v := range config {
+		networkConfig[k] = v
+	}
+	f.Networks[name] = networkConfig
+	return true, nil
+}
+
+func (f *FakeClient) NetworkConfig(_ context.Context, name string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("NetworkConfig"); err != nil {
+		return nil, err
+	}
+	return f.Networks[name], nil
+}
+
+func (f *FakeClient) NetworkInstances(_ context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("NetworkInstances"); err != nil {
+		return nil, err
+	}
+	instances := slices.Clone(f.AttachedInstances[name])
+	for instance, devices := range f.InstanceDevices {
+		for _, device := range devices {
+			if device["type"] == "nic" && device["network"] == name && !slices.Contains(instances, instance) {
+				instances = append(instances, instance)
+			}
+		}
+	}
+	slices.Sort(instances)
+	return instances, nil
+}
+
+func (f *FakeClient) DeleteNetwork(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("DeleteNetwork"); err != nil {
+		return err
+	}
+	delete(f.Networks, name)
+	return nil
+}
+
+func (f *FakeClient) GetClusterMembers(_ context.Context) ([]incus.ClusterMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetClusterMembers"); err != nil {
+		return nil, err
+	}
+	return f.Members, nil
+}
+
+func (f *FakeClient) GetServerInfo(_ context.Context) (*incus.ServerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetServerInfo"); err != nil {
+		return nil, err
+	}
+	info := f.ServerInfo
+	return &info, nil
+}
+
+func (f *FakeClient) UseProject(name string) incus.Client {
+	if name == "" {
+		return f
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.Projects[name]; !ok {
+		f.Projects[name] = NewFakeClient()
+	}
+	return f.Projects[name]
+}
+
+func (f *FakeClient) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("Close")
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package incustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/j-griffith/cluster-api-provider-incus/internal/incus"
+)
+
+func TestFakeClientInstances(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeClient()
+	if err := f.CreateInstance(ctx, incus.CreateInstanceRequest{Name: "vm", CPUs: 2, MemoryMiB: 1024}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	info, err := f.GetInstance(ctx, "vm")
+	if err != nil {
+		t.Fatalf("GetInstance() error = %v", err)
+	}
+	if info.CPULimit != "2" || info.MemoryLimit != "1024MiB" {
+		t.Errorf("GetInstance() limits = %q, %q, want %q, %q", info.CPULimit, info.MemoryLimit, "2", "1024MiB")
+	}
+	if err := f.DeleteInstance(ctx, "vm"); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if f.HasInstance("vm") {
+		t.Error("HasInstance() = true after DeleteInstance")
+	}
+	if _, err := f.GetInstance(ctx, "vm"); !errors.Is(err, incus.ErrInstanceNotFound) {
+		t.Errorf("GetInstance() error = %v, want %v", err, incus.ErrInstanceNotFound)
+	}
+	if _, err := f.InstanceLocation(ctx, "vm"); !errors.Is(err, incus.ErrInstanceNotFound) {
+		t.Errorf("InstanceLocation() error = %v, want %v", err, incus.ErrInstanceNotFound)
+	}
+	if _, err := f.GetInstanceState(ctx, "vm"); !errors.Is(err, incus.ErrInstanceNotFound) {
+		t.Errorf("GetInstanceState() error = %v, want %v", err, incus.ErrInstanceNotFound)
+	}
+	if err := f.StopInstance(ctx, "vm", time.Second); !errors.Is(err, incus.ErrInstanceNotFound) {
+		t.Errorf("StopInstance() error = %v, want %v", err, incus.ErrInstanceNotFound)
+	}
+	if err := f.UpdateInstanceConfig(ctx, "vm", map[string]string{"user.a": "b"}); !errors.Is(err, incus.ErrInstanceNotFound) {
+		t.Errorf("UpdateInstanceConfig() error = %v, want %v", err, incus.ErrInstanceNotFound)
+	}
+}
+
+func TestFakeClientFailOn(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeClient()
+	injected := errors.New("daemon is busy")
+	f.FailOn("InstanceExists", injected)
+	if _, err := f.InstanceExists(ctx, "vm"); !errors.Is(err, injected) {
+		t.Errorf("InstanceExists() error = %v, want %v", err, injected)
+	}
+	f.FailOn("InstanceExists", nil)
+	if _, err := f.InstanceExists(ctx, "vm"); err != nil {
+		t.Errorf("InstanceExists() error = %v after clearing the failure", err)
+	}
+	if got := f.CallCount("InstanceExists"); got != 2 {
+		t.Errorf("CallCount(InstanceExists) = %d, want 2", got)
+	}
+	if got := f.CallCount("GetInstance"); got != 0 {
+		t.Errorf("CallCount(GetInstance) = %d, want 0", got)
+	}
+}
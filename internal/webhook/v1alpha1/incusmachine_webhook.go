@@ -0,0 +1,397 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+)
+
+// log is for logging in this package.
+var incusmachinelog = logf.Log.WithName("incusmachine-resource")
+
+// imageRefPattern matches an Incus image reference: an alias or fingerprint,
+// optionally prefixed with a remote, e.g. "images:ubuntu/24.04/cloud".
+var imageRefPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*:)?[A-Za-z0-9][A-Za-z0-9._/+-]*$`)
+
+// labelKeyPattern matches a label key that can be stored as a user.* Incus
+// config key.
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// reservedLabelPrefix starts the label keys that would land in the
+// user.capi.* config namespace the provider stores its own keys under.
+const reservedLabelPrefix = "capi."
+
+// SetupIncusMachineWebhookWithManager registers the webhook for IncusMachine in the manager.
+func SetupIncusMachineWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1alpha1.IncusMachine{}).
+		WithValidator(&IncusMachineCustomValidator{}).
+		WithDefaulter(&IncusMachineCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1alpha1-incusmachine,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=incusmachines,verbs=create,versions=v1alpha1,name=mincusmachine-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IncusMachineCustomDefaulter fills in the spec defaults when an
+// IncusMachine is created, so the stored object shows the values the
+// instance is created with.
+type IncusMachineCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &IncusMachineCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *IncusMachineCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	incusMachine, ok := obj.(*infrastructurev1alpha1.IncusMachine)
+	if !ok {
+		return fmt.Errorf("expected an IncusMachine object but got %T", obj)
+	}
+	incusmachinelog.Info("Defaulting for IncusMachine", "name", incusMachine.GetName())
+
+	defaultIncusMachineSpec(&incusMachine.Spec)
+	return nil
+}
+
+// defaultIncusMachineSpec fills in the defaults of the unset fields of spec.
+func defaultIncusMachineSpec(spec *infrastructurev1alpha1.IncusMachineSpec) {
+	// The default image names a remote, so it only applies when no image
+	// server is set.
+	if spec.Image == "" && spec.ImageServer == nil {
+		spec.Image = infrastructurev1alpha1.DefaultImage
+	}
+	if spec.CPUs == 0 && spec.CPUPinning == "" {
+		spec.CPUs = infrastructurev1alpha1.DefaultCPUs
+	}
+	if spec.MemoryMiB == 0 {
+		spec.MemoryMiB = infrastructurev1alpha1.DefaultMemoryMiB
+	}
+	if spec.BootAutostart == nil {
+		autostart := true
+		spec.BootAutostart = &autostart
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1alpha1-incusmachine,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=incusmachines,verbs=create;update,versions=v1alpha1,name=vincusmachine-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IncusMachineCustomValidator validates IncusMachines when they are created
+// or updated, so invalid specs are rejected at admission instead of failing
+// during reconcile.
+type IncusMachineCustomValidator struct{}
+
+var _ webhook.CustomValidator = &IncusMachineCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *IncusMachineCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	incusMachine, ok := obj.(*infrastructurev1alpha1.IncusMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachine object but got %T", obj)
+	}
+	incusmachinelog.Info("Validation for IncusMachine upon creation", "name", incusMachine.GetName())
+
+	allErrs := validateIncusMachineSpec(&incusMachine.Spec, field.NewPath("spec"))
+	allErrs = append(allErrs, validateIncusMachineAnnotations(incusMachine.Annotations)...)
+	return nil, toInvalid(incusMachine, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *IncusMachineCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	incusMachine, ok := newObj.(*infrastructurev1alpha1.IncusMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachine object for the newObj but got %T", newObj)
+	}
+	oldIncusMachine, ok := oldObj.(*infrastructurev1alpha1.IncusMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachine object for the oldObj but got %T", oldObj)
+	}
+	incusmachinelog.Info("Validation for IncusMachine upon update", "name", incusMachine.GetName())
+
+	allErrs := validateIncusMachineSpec(&incusMachine.Spec, field.NewPath("spec"))
+	allErrs = append(allErrs, validateIncusMachineAnnotations(incusMachine.Annotations)...)
+	// The image of a running instance cannot be changed.
+	if incusMachine.Spec.Image != oldIncusMachine.Spec.Image {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "image"), "field is immutable"))
+	}
+	if !equality.Semantic.DeepEqual(incusMachine.Spec.ImageServer, oldIncusMachine.Spec.ImageServer) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "imageServer"), "field is immutable"))
+	}
+	// Data disks are only created with the instance.
+	if !equality.Semantic.DeepEqual(incusMachine.Spec.DataDisks, oldIncusMachine.Spec.DataDisks) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "dataDisks"), "field is immutable"))
+	}
+	// So are network interfaces and GPUs.
+	if !equality.Semantic.DeepEqual(incusMachine.Spec.NetworkInterfaces, oldIncusMachine.Spec.NetworkInterfaces) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "networkInterfaces"), "field is immutable"))
+	}
+	if !equality.Semantic.DeepEqual(incusMachine.Spec.GPUs, oldIncusMachine.Spec.GPUs) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "gpus"), "field is immutable"))
+	}
+	return nil, toInvalid(incusMachine, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *IncusMachineCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateIncusMachineSpec checks the fields of an IncusMachineSpec, found at
+// specPath, that the CRD schema cannot.
+func validateIncusMachineSpec(spec *infrastructurev1alpha1.IncusMachineSpec, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch {
+	case spec.Image == "":
+		allErrs = append(allErrs, field.Required(specPath.Child("image"), "an image is required"))
+	case !imageRefPattern.MatchString(spec.Image):
+		allErrs = append(allErrs, field.Invalid(specPath.Child("image"), spec.Image,
+			"must be an image alias or fingerprint, optionally prefixed with a remote, e.g. images:ubuntu/24.04/cloud"))
+	case spec.ImageServer != nil && strings.Contains(spec.Image, ":"):
+		allErrs = append(allErrs, field.Invalid(specPath.Child("image"), spec.Image,
+			"must not be prefixed with a remote when imageServer is set"))
+	}
+	switch {
+	case spec.CPUPinning != "" && spec.CPUs != 0:
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("cpus"), "must not be set together with cpuPinning"))
+	case spec.CPUPinning == "" && spec.CPUs < 1:
+		allErrs = append(allErrs, field.Invalid(specPath.Child("cpus"), spec.CPUs, "must be at least 1"))
+	}
+	if spec.MemoryMiB < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("memoryMiB"), spec.MemoryMiB, "must be at least 1"))
+	}
+	if spec.ConfigMapRef != nil && spec.ConfigMapRef.Name == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("configMapRef", "name"), "the ConfigMap must be named"))
+	}
+	if spec.RootDiskSizeGiB < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("rootDiskSizeGiB"), spec.RootDiskSizeGiB, "must not be negative"))
+	}
+	for name, limit := range map[string]int64{
+		"rootDiskReadIOPS":  spec.RootDiskReadIOPS,
+		"rootDiskWriteIOPS": spec.RootDiskWriteIOPS,
+		"rootDiskReadBps":   spec.RootDiskReadBps,
+		"rootDiskWriteBps":  spec.RootDiskWriteBps,
+		"rootDiskMaxIOPS":   spec.RootDiskMaxIOPS,
+		"rootDiskMaxBps":    spec.RootDiskMaxBps,
+	} {
+		if limit < 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child(name), limit, "must not be negative"))
+		}
+	}
+	// limits.read and limits.write each hold a single limit.
+	if spec.RootDiskReadIOPS > 0 && spec.RootDiskReadBps > 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("rootDiskReadBps"), "cannot be combined with rootDiskReadIOPS"))
+	}
+	if spec.RootDiskWriteIOPS > 0 && spec.RootDiskWriteBps > 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("rootDiskWriteBps"), "cannot be combined with rootDiskWriteIOPS"))
+	}
+	// limits.max takes precedence over limits.read and limits.write, so it
+	// is kept apart from them.
+	if spec.RootDiskMaxIOPS > 0 && spec.RootDiskMaxBps > 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("rootDiskMaxBps"), "cannot be combined with rootDiskMaxIOPS"))
+	}
+	if spec.RootDiskMaxIOPS > 0 || spec.RootDiskMaxBps > 0 {
+		for name, limit := range map[string]int64{
+			"rootDiskReadIOPS":  spec.RootDiskReadIOPS,
+			"rootDiskWriteIOPS": spec.RootDiskWriteIOPS,
+			"rootDiskReadBps":   spec.RootDiskReadBps,
+			"rootDiskWriteBps":  spec.RootDiskWriteBps,
+		} {
+			if limit > 0 {
+				allErrs = append(allErrs, field.Forbidden(specPath.Child(name), "cannot be combined with rootDiskMaxIOPS or rootDiskMaxBps"))
+			}
+		}
+	}
+	if spec.InstanceType == "container" {
+		if spec.SecureBoot != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("secureBoot"), "only applies to virtual machines"))
+		}
+	} else {
+		if spec.Nesting {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("nesting"), "only applies to containers"))
+		}
+		if spec.Privileged {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("privileged"), "only applies to containers"))
+		}
+		if spec.MemorySwap != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("memorySwap"), "only applies to containers"))
+		}
+		if spec.MemoryEnforce != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("memoryEnforce"), "only applies to containers"))
+		}
+	}
+	switch spec.MemoryEnforce {
+	case "", infrastructurev1alpha1.MemoryEnforceHard, infrastructurev1alpha1.MemoryEnforceSoft:
+	default:
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("memoryEnforce"), spec.MemoryEnforce,
+			[]string{infrastructurev1alpha1.MemoryEnforceHard, infrastructurev1alpha1.MemoryEnforceSoft}))
+	}
+	if spec.BootPriority < 0 || spec.BootPriority > infrastructurev1alpha1.MaxBootPriority {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("bootPriority"), spec.BootPriority,
+			fmt.Sprintf("must be between 0 and %d", infrastructurev1alpha1.MaxBootPriority)))
+	}
+	if strings.HasPrefix(spec.VendorData, "#cloud-config") {
+		if err := validateYAMLMapping(spec.VendorData); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("vendorData"), "<omitted>", fmt.Sprintf("must be valid YAML: %v", err)))
+		}
+	}
+	if spec.NetworkConfig != "" {
+		if err := validateYAMLMapping(spec.NetworkConfig); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("networkConfig"), "<omitted>", fmt.Sprintf("must be a YAML mapping: %v", err)))
+		}
+	}
+	if spec.Hostname != "" {
+		if msgs := validateHostname(spec.Hostname); len(msgs) > 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("hostname"), spec.Hostname, strings.Join(msgs, "; ")))
+		}
+	}
+	if len(spec.DNSServers) > 0 && spec.NetworkConfig != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("dnsServers"), "must not be set together with networkConfig; set the nameservers of networkConfig instead"))
+	}
+	for i, server := range spec.DNSServers {
+		if _, err := netip.ParseAddr(server); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("dnsServers").Index(i), server, "must be an IP address"))
+		}
+	}
+	if len(spec.ReadinessCommand) > 0 && spec.ReadinessCommand[0] == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("readinessCommand").Index(0), "the program to run must be named"))
+	}
+	keys := make([]string, 0, len(spec.Labels))
+	for k := range spec.Labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		switch {
+		case !labelKeyPattern.MatchString(k):
+			allErrs = append(allErrs, field.Invalid(specPath.Child("labels").Key(k), k,
+				"must start with a letter or digit and contain only letters, digits, '.', '_' and '-'"))
+		case strings.HasPrefix(strings.ToLower(k), reservedLabelPrefix):
+			allErrs = append(allErrs, field.Invalid(specPath.Child("labels").Key(k), k,
+				fmt.Sprintf("keys starting with %q are reserved for the provider", reservedLabelPrefix)))
+		}
+	}
+	for i, disk := range spec.DataDisks {
+		diskPath := specPath.Child("dataDisks").Index(i)
+		if disk.SizeGiB < 1 {
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("sizeGiB"), disk.SizeGiB, "must be at least 1"))
+		}
+		if disk.Pool == "" {
+			allErrs = append(allErrs, field.Required(diskPath.Child("pool"), "a storage pool is required"))
+		}
+		switch {
+		case disk.Path != "" && !strings.HasPrefix(disk.Path, "/"):
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("path"), disk.Path, "must be an absolute path"))
+		case disk.Path == "" && spec.InstanceType == "container":
+			allErrs = append(allErrs, field.Required(diskPath.Child("path"), "containers cannot attach block devices"))
+		}
+	}
+	for i, gpu := range spec.GPUs {
+		gpuPath := specPath.Child("gpus").Index(i)
+		switch {
+		case gpu.Product != "" && gpu.Vendor == "":
+			allErrs = append(allErrs, field.Required(gpuPath.Child("vendor"), "a vendor is required to select a product"))
+		case gpu.PCI == "" && gpu.Vendor == "" && spec.InstanceType != "container":
+			allErrs = append(allErrs, field.Required(gpuPath, "virtual machines must select a GPU by pci or vendor"))
+		}
+	}
+	for i, nic := range spec.NetworkInterfaces {
+		nicPath := specPath.Child("networkInterfaces").Index(i)
+		if nic.IPv4Address != "" {
+			if addr, err := netip.ParseAddr(nic.IPv4Address); err != nil || !addr.Is4() {
+				allErrs = append(allErrs, field.Invalid(nicPath.Child("ipv4Address"), nic.IPv4Address, "must be an IPv4 address"))
+			}
+		}
+		if nic.HWAddr != "" {
+			if mac, err := net.ParseMAC(nic.HWAddr); err != nil || len(mac) != 6 || mac[0]&1 != 0 {
+				allErrs = append(allErrs, field.Invalid(nicPath.Child("hwAddr"), nic.HWAddr, "must be a unicast MAC address, e.g. 00:16:3e:12:34:56"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateHostname checks that hostname is a DNS name whose labels each fit
+// a Linux hostname.
+func validateHostname(hostname string) []string {
+	if msgs := validation.IsDNS1123Subdomain(hostname); len(msgs) > 0 {
+		return msgs
+	}
+	for label := range strings.SplitSeq(hostname, ".") {
+		if msgs := validation.IsDNS1123Label(label); len(msgs) > 0 {
+			return msgs
+		}
+	}
+	return nil
+}
+
+// validateYAMLMapping checks that doc is a YAML document holding a mapping,
+// or nothing but comments.
+func validateYAMLMapping(doc string) error {
+	var m map[string]interface{}
+	return yaml.Unmarshal([]byte(doc), &m)
+}
+
+// validateIncusMachineAnnotations checks the values of the annotations the
+// controller acts on.
+func validateIncusMachineAnnotations(annotations map[string]string) field.ErrorList {
+	var allErrs field.ErrorList
+	key := infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation
+	if mode, ok := annotations[key]; ok {
+		switch mode {
+		case infrastructurev1alpha1.SnapshotStateless, infrastructurev1alpha1.SnapshotStateful:
+		default:
+			allErrs = append(allErrs, field.NotSupported(field.NewPath("metadata", "annotations").Key(key), mode,
+				[]string{infrastructurev1alpha1.SnapshotStateless, infrastructurev1alpha1.SnapshotStateful}))
+		}
+	}
+	key = infrastructurev1alpha1.PowerStateAnnotation
+	if state, ok := annotations[key]; ok {
+		switch state {
+		case infrastructurev1alpha1.PowerStateRunning, infrastructurev1alpha1.PowerStateStopped:
+		default:
+			allErrs = append(allErrs, field.NotSupported(field.NewPath("metadata", "annotations").Key(key), state,
+				[]string{infrastructurev1alpha1.PowerStateRunning, infrastructurev1alpha1.PowerStateStopped}))
+		}
+	}
+	return allErrs
+}
+
+// toInvalid returns allErrs as an Invalid API error for incusMachine, or nil
+// if there are no errors.
+func toInvalid(incusMachine *infrastructurev1alpha1.IncusMachine, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		infrastructurev1alpha1.GroupVersion.WithKind("IncusMachine").GroupKind(),
+		incusMachine.Name, allErrs)
+}
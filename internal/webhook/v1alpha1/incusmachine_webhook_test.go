@@ -0,0 +1,504 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+)
+
+var _ = Describe("IncusMachine Webhook", func() {
+	var (
+		obj       *infrastructurev1alpha1.IncusMachine
+		oldObj    *infrastructurev1alpha1.IncusMachine
+		validator IncusMachineCustomValidator
+		defaulter IncusMachineCustomDefaulter
+	)
+
+	BeforeEach(func() {
+		obj = &infrastructurev1alpha1.IncusMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"},
+			Spec: infrastructurev1alpha1.IncusMachineSpec{
+				Image:     "images:ubuntu/24.04/cloud",
+				CPUs:      2,
+				MemoryMiB: 2048,
+			},
+		}
+		oldObj = obj.DeepCopy()
+		validator = IncusMachineCustomValidator{}
+		defaulter = IncusMachineCustomDefaulter{}
+	})
+
+	Context("When creating an IncusMachine under Defaulting Webhook", func() {
+		It("Should fill in the defaults of a minimal spec", func() {
+			obj.Spec = infrastructurev1alpha1.IncusMachineSpec{}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Image).To(Equal(infrastructurev1alpha1.DefaultImage))
+			Expect(obj.Spec.CPUs).To(Equal(infrastructurev1alpha1.DefaultCPUs))
+			Expect(obj.Spec.MemoryMiB).To(Equal(infrastructurev1alpha1.DefaultMemoryMiB))
+			Expect(obj.Spec.BootAutostart).To(HaveValue(BeTrue()))
+		})
+
+		It("Should keep values that are set", func() {
+			autostart := false
+			obj.Spec.BootAutostart = &autostart
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Image).To(Equal("images:ubuntu/24.04/cloud"))
+			Expect(obj.Spec.CPUs).To(Equal(2))
+			Expect(obj.Spec.MemoryMiB).To(Equal(2048))
+			Expect(obj.Spec.BootAutostart).To(HaveValue(BeFalse()))
+		})
+
+		It("Should not default the vCPU count of a machine with pinned CPUs", func() {
+			obj.Spec = infrastructurev1alpha1.IncusMachineSpec{CPUPinning: "0-3"}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.CPUs).To(BeZero())
+		})
+
+		It("Should not default the image of a machine with an image server", func() {
+			obj.Spec = infrastructurev1alpha1.IncusMachineSpec{
+				ImageServer: &infrastructurev1alpha1.ImageServer{URL: "https://images.example.com"},
+			}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Image).To(BeEmpty())
+		})
+
+		It("Should store the defaults through the API server", func() {
+			obj.Name = "test-defaulted-machine"
+			obj.Spec = infrastructurev1alpha1.IncusMachineSpec{}
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+			})
+
+			stored := &infrastructurev1alpha1.IncusMachine{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), stored)).To(Succeed())
+			Expect(stored.Spec.Image).To(Equal(infrastructurev1alpha1.DefaultImage))
+			Expect(stored.Spec.CPUs).To(Equal(infrastructurev1alpha1.DefaultCPUs))
+			Expect(stored.Spec.MemoryMiB).To(Equal(infrastructurev1alpha1.DefaultMemoryMiB))
+		})
+	})
+
+	Context("When creating an IncusMachine under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a ConfigMap reference without a name", func() {
+			obj.Spec.ConfigMapRef = &corev1.LocalObjectReference{}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.configMapRef.name"))
+		})
+
+		It("Should admit an image fingerprint without a remote", func() {
+			obj.Spec.Image = "a1b2c3d4e5f6"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should admit an image from an image server", func() {
+			obj.Spec.Image = "ubuntu/24.04/cloud"
+			obj.Spec.ImageServer = &infrastructurev1alpha1.ImageServer{URL: "https://images.example.com"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a remote prefix with an image server", func() {
+			obj.Spec.ImageServer = &infrastructurev1alpha1.ImageServer{URL: "https://images.example.com"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("imageServer is set"))
+		})
+
+		It("Should deny fewer than one CPU", func() {
+			obj.Spec.CPUs = -1
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.cpus"))
+		})
+
+		It("Should admit pinned CPUs without a vCPU count", func() {
+			obj.Spec.CPUs = 0
+			obj.Spec.CPUPinning = "0-3"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a vCPU count together with pinned CPUs", func() {
+			obj.Spec.CPUPinning = "0-3"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.cpus"))
+		})
+
+		It("Should deny zero memory", func() {
+			obj.Spec.MemoryMiB = 0
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.memoryMiB"))
+		})
+
+		It("Should deny an empty image", func() {
+			obj.Spec.Image = ""
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.image"))
+		})
+
+		It("Should deny a malformed image reference", func() {
+			obj.Spec.Image = "images:ubuntu 24.04"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.image"))
+		})
+
+		It("Should deny a negative root disk size", func() {
+			obj.Spec.RootDiskSizeGiB = -10
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskSizeGiB"))
+		})
+
+		It("Should deny a readiness command without a program", func() {
+			obj.Spec.ReadinessCommand = []string{"", "--wait"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.readinessCommand[0]"))
+		})
+
+		It("Should admit root disk IO limits", func() {
+			obj.Spec.RootDiskReadIOPS = 1000
+			obj.Spec.RootDiskWriteBps = 50 * 1024 * 1024
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny negative root disk IO limits", func() {
+			obj.Spec.RootDiskReadIOPS = -1
+			obj.Spec.RootDiskWriteBps = -1
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskReadIOPS"))
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskWriteBps"))
+		})
+
+		It("Should deny a root disk limit in both operations and bytes", func() {
+			obj.Spec.RootDiskWriteIOPS = 1000
+			obj.Spec.RootDiskWriteBps = 1024
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskWriteBps"))
+		})
+
+		It("Should admit an overall root disk IO limit", func() {
+			obj.Spec.RootDiskMaxIOPS = 2000
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a negative overall root disk IO limit", func() {
+			obj.Spec.RootDiskMaxBps = -1
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskMaxBps"))
+		})
+
+		It("Should deny an overall root disk limit in both operations and bytes", func() {
+			obj.Spec.RootDiskMaxIOPS = 2000
+			obj.Spec.RootDiskMaxBps = 1024
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskMaxBps"))
+		})
+
+		It("Should deny mixing the overall root disk limit with read and write limits", func() {
+			obj.Spec.RootDiskMaxIOPS = 2000
+			obj.Spec.RootDiskReadIOPS = 1000
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rootDiskReadIOPS"))
+		})
+
+		It("Should admit security options matching the instance type", func() {
+			secureBoot := true
+			obj.Spec.SecureBoot = &secureBoot
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.SecureBoot = nil
+			obj.Spec.InstanceType = "container"
+			obj.Spec.Nesting = true
+			obj.Spec.Privileged = true
+			swap := false
+			obj.Spec.MemorySwap = &swap
+			obj.Spec.MemoryEnforce = infrastructurev1alpha1.MemoryEnforceSoft
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny container options on a virtual machine", func() {
+			obj.Spec.Nesting = true
+			obj.Spec.Privileged = true
+			swap := true
+			obj.Spec.MemorySwap = &swap
+			obj.Spec.MemoryEnforce = infrastructurev1alpha1.MemoryEnforceHard
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.nesting"))
+			Expect(err.Error()).To(ContainSubstring("spec.privileged"))
+			Expect(err.Error()).To(ContainSubstring("spec.memorySwap"))
+			Expect(err.Error()).To(ContainSubstring("spec.memoryEnforce"))
+		})
+
+		It("Should deny an unknown memory enforcement", func() {
+			obj.Spec.InstanceType = "container"
+			obj.Spec.MemoryEnforce = "strict"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.memoryEnforce"))
+		})
+
+		It("Should deny secure boot on a container", func() {
+			secureBoot := false
+			obj.Spec.InstanceType = "container"
+			obj.Spec.SecureBoot = &secureBoot
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.secureBoot"))
+		})
+
+		It("Should deny a boot priority out of range", func() {
+			obj.Spec.BootPriority = infrastructurev1alpha1.MaxBootPriority + 1
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.bootPriority"))
+
+			obj.Spec.BootPriority = -1
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+
+		It("Should admit data disks", func() {
+			obj.Spec.DataDisks = []infrastructurev1alpha1.DataDisk{
+				{SizeGiB: 50, Pool: "fast"},
+				{SizeGiB: 200, Pool: "bulk", Path: "/var/lib/data"},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny invalid data disks", func() {
+			obj.Spec.DataDisks = []infrastructurev1alpha1.DataDisk{
+				{SizeGiB: 0, Pool: "fast"},
+				{SizeGiB: 10, Pool: "fast", Path: "data"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.dataDisks[0].sizeGiB"))
+			Expect(err.Error()).To(ContainSubstring("spec.dataDisks[1].path"))
+		})
+
+		It("Should deny a block data disk on a container", func() {
+			obj.Spec.InstanceType = "container"
+			obj.Spec.DataDisks = []infrastructurev1alpha1.DataDisk{{SizeGiB: 10, Pool: "fast"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.dataDisks[0].path"))
+		})
+
+		It("Should admit cloud-init vendor-data and network-config", func() {
+			obj.Spec.VendorData = "#!/bin/sh\necho a: b: c\n"
+			obj.Spec.NetworkConfig = "version: 2\nethernets:\n  enp5s0:\n    dhcp4: true\n"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny malformed cloud-init vendor-data and network-config", func() {
+			obj.Spec.VendorData = "#cloud-config\npackages: [chrony\n"
+			obj.Spec.NetworkConfig = "- not\n- a mapping\n"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.vendorData"))
+			Expect(err.Error()).To(ContainSubstring("spec.networkConfig"))
+		})
+
+		It("Should admit a hostname and DNS servers", func() {
+			obj.Spec.Hostname = "worker-0.example.com"
+			obj.Spec.DNSServers = []string{"10.0.0.53", "2001:db8::53"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a malformed hostname", func() {
+			for _, hostname := range []string{"Worker_0", "-worker", "worker..example.com", strings.Repeat("a", 64) + ".example.com"} {
+				obj.Spec.Hostname = hostname
+				_, err := validator.ValidateCreate(ctx, obj)
+				Expect(apierrors.IsInvalid(err)).To(BeTrue(), "hostname %q", hostname)
+				Expect(err.Error()).To(ContainSubstring("spec.hostname"))
+			}
+		})
+
+		It("Should deny DNS servers that are not IP addresses or come with a network-config", func() {
+			obj.Spec.DNSServers = []string{"dns.example.com"}
+			obj.Spec.NetworkConfig = "version: 2\n"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.dnsServers[0]"))
+			Expect(err.Error()).To(ContainSubstring("must not be set together with networkConfig"))
+		})
+
+		It("Should admit network interfaces with a static address and MAC", func() {
+			obj.Spec.NetworkInterfaces = []infrastructurev1alpha1.NetworkInterface{
+				{Name: "eth0", IPv4Address: "10.0.0.10", HWAddr: "00:16:3e:12:34:56"},
+				{Name: "eth1", Network: "storage"},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a malformed address or MAC", func() {
+			obj.Spec.NetworkInterfaces = []infrastructurev1alpha1.NetworkInterface{
+				{Name: "eth0", IPv4Address: "fd42::10"},
+				{Name: "eth1", IPv4Address: "10.0.0.300", HWAddr: "01:00:5e:00:00:01"},
+				{Name: "eth2", HWAddr: "00:16:3e:12:34"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.networkInterfaces[0].ipv4Address"))
+			Expect(err.Error()).To(ContainSubstring("spec.networkInterfaces[1].ipv4Address"))
+			Expect(err.Error()).To(ContainSubstring("spec.networkInterfaces[1].hwAddr"))
+			Expect(err.Error()).To(ContainSubstring("spec.networkInterfaces[2].hwAddr"))
+		})
+
+		It("Should admit GPUs that select a device", func() {
+			obj.Spec.GPUs = []infrastructurev1alpha1.GPUDevice{
+				{PCI: "0000:01:00.0"},
+				{Vendor: "10de", Product: "2330"},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny GPUs a virtual machine cannot take", func() {
+			obj.Spec.GPUs = []infrastructurev1alpha1.GPUDevice{{}, {Product: "2330"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.gpus[0]"))
+			Expect(err.Error()).To(ContainSubstring("spec.gpus[1].vendor"))
+		})
+
+		It("Should admit every GPU of the host for a container", func() {
+			obj.Spec.InstanceType = "container"
+			obj.Spec.GPUs = []infrastructurev1alpha1.GPUDevice{{}}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should admit a description and labels", func() {
+			obj.Spec.Description = "control plane of the test cluster"
+			obj.Spec.Labels = map[string]string{"team": "platform", "cost-center.id": "42"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny reserved or malformed label keys", func() {
+			obj.Spec.Labels = map[string]string{"capi.cluster": "other", "CAPI.owner": "me", "user.team": "x", "bad key": "x"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.labels[capi.cluster]"))
+			Expect(err.Error()).To(ContainSubstring("spec.labels[CAPI.owner]"))
+			Expect(err.Error()).To(ContainSubstring("spec.labels[bad key]"))
+			Expect(err.Error()).NotTo(ContainSubstring("spec.labels[user.team]"))
+		})
+
+		It("Should admit label keys that only start like the reserved namespace", func() {
+			obj.Spec.Labels = map[string]string{"capital": "paris", "capistrano": "deploy", "capi": "x", "capi-owner": "me"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should be enforced by the API server", func() {
+			obj.Spec.CPUs = -1
+			err := k8sClient.Create(ctx, obj)
+			Expect(apierrors.IsInvalid(err) || apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error %v", err)
+			Expect(err.Error()).To(ContainSubstring("spec.cpus"))
+		})
+	})
+
+	Context("When updating an IncusMachine under Validating Webhook", func() {
+		It("Should admit changes to mutable fields", func() {
+			obj.Spec.CPUs = 4
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny changing the image", func() {
+			obj.Spec.Image = "images:debian/12/cloud"
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("immutable"))
+		})
+
+		It("Should deny changing the GPUs", func() {
+			obj.Spec.GPUs = []infrastructurev1alpha1.GPUDevice{{PCI: "0000:01:00.0"}}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.gpus"))
+		})
+
+		It("Should deny changing the image server", func() {
+			obj.Spec.Image = "ubuntu/24.04/cloud"
+			oldObj.Spec.Image = obj.Spec.Image
+			obj.Spec.ImageServer = &infrastructurev1alpha1.ImageServer{URL: "https://images.example.com"}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.imageServer"))
+		})
+
+		It("Should deny changing the network interfaces", func() {
+			obj.Spec.NetworkInterfaces = []infrastructurev1alpha1.NetworkInterface{{Name: "eth0", IPv4Address: "10.0.0.10"}}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.networkInterfaces"))
+		})
+
+		It("Should deny an invalid spec", func() {
+			obj.Spec.MemoryMiB = -1
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.memoryMiB"))
+		})
+
+		It("Should admit a snapshot-before-delete annotation", func() {
+			obj.Annotations = map[string]string{infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation: infrastructurev1alpha1.SnapshotStateful}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny an unknown snapshot-before-delete mode", func() {
+			obj.Annotations = map[string]string{infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation: "true"}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(infrastructurev1alpha1.SnapshotBeforeDeleteAnnotation))
+		})
+
+		It("Should admit a power-state annotation", func() {
+			obj.Annotations = map[string]string{infrastructurev1alpha1.PowerStateAnnotation: infrastructurev1alpha1.PowerStateStopped}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny an unknown power state", func() {
+			obj.Annotations = map[string]string{infrastructurev1alpha1.PowerStateAnnotation: "off"}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(infrastructurev1alpha1.PowerStateAnnotation))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+)
+
+// log is for logging in this package.
+var incusmachinetemplatelog = logf.Log.WithName("incusmachinetemplate-resource")
+
+// SetupIncusMachineTemplateWebhookWithManager registers the webhook for IncusMachineTemplate in the manager.
+func SetupIncusMachineTemplateWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1alpha1.IncusMachineTemplate{}).
+		WithValidator(&IncusMachineTemplateCustomValidator{}).
+		WithDefaulter(&IncusMachineTemplateCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1alpha1-incusmachinetemplate,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=incusmachinetemplates,verbs=create,versions=v1alpha1,name=mincusmachinetemplate-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IncusMachineTemplateCustomDefaulter fills in the defaults of the template
+// spec when an IncusMachineTemplate is created, so every clone starts with
+// the same values.
+type IncusMachineTemplateCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &IncusMachineTemplateCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *IncusMachineTemplateCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	template, ok := obj.(*infrastructurev1alpha1.IncusMachineTemplate)
+	if !ok {
+		return fmt.Errorf("expected an IncusMachineTemplate object but got %T", obj)
+	}
+	incusmachinetemplatelog.Info("Defaulting for IncusMachineTemplate", "name", template.GetName())
+
+	defaultIncusMachineSpec(&template.Spec.Template.Spec)
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1alpha1-incusmachinetemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=incusmachinetemplates,verbs=create;update,versions=v1alpha1,name=vincusmachinetemplate-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// IncusMachineTemplateCustomValidator validates the IncusMachine spec of an
+// IncusMachineTemplate, so that a template whose clones would be rejected is
+// rejected itself.
+type IncusMachineTemplateCustomValidator struct{}
+
+var _ webhook.CustomValidator = &IncusMachineTemplateCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *IncusMachineTemplateCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*infrastructurev1alpha1.IncusMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachineTemplate object but got %T", obj)
+	}
+	incusmachinetemplatelog.Info("Validation for IncusMachineTemplate upon creation", "name", template.GetName())
+
+	return nil, templateInvalid(template, validateIncusMachineTemplateSpec(&template.Spec))
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *IncusMachineTemplateCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	template, ok := newObj.(*infrastructurev1alpha1.IncusMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachineTemplate object for the newObj but got %T", newObj)
+	}
+	oldTemplate, ok := oldObj.(*infrastructurev1alpha1.IncusMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected an IncusMachineTemplate object for the oldObj but got %T", oldObj)
+	}
+	incusmachinetemplatelog.Info("Validation for IncusMachineTemplate upon update", "name", template.GetName())
+
+	allErrs := validateIncusMachineTemplateSpec(&template.Spec)
+	// Machines already cloned from the template would not pick up a change,
+	// so a new template has to be rolled out instead, as Cluster API expects.
+	if !equality.Semantic.DeepEqual(template.Spec, oldTemplate.Spec) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template"), "field is immutable"))
+	}
+	return nil, templateInvalid(template, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *IncusMachineTemplateCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateIncusMachineTemplateSpec checks the IncusMachine spec of the
+// template as the IncusMachine webhook would check its clones.
+func validateIncusMachineTemplateSpec(spec *infrastructurev1alpha1.IncusMachineTemplateSpec) field.ErrorList {
+	specPath := field.NewPath("spec", "template", "spec")
+	allErrs := validateIncusMachineSpec(&spec.Template.Spec, specPath)
+	if spec.Template.Spec.ProviderID != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("providerID"), "must not be set in a template"))
+	}
+	return allErrs
+}
+
+// templateInvalid returns allErrs as an Invalid API error for template, or
+// nil if there are no errors.
+func templateInvalid(template *infrastructurev1alpha1.IncusMachineTemplate, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		infrastructurev1alpha1.GroupVersion.WithKind("IncusMachineTemplate").GroupKind(),
+		template.Name, allErrs)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/j-griffith/cluster-api-provider-incus/api/v1alpha1"
+)
+
+var _ = Describe("IncusMachineTemplate Webhook", func() {
+	var (
+		obj       *infrastructurev1alpha1.IncusMachineTemplate
+		oldObj    *infrastructurev1alpha1.IncusMachineTemplate
+		validator IncusMachineTemplateCustomValidator
+		defaulter IncusMachineTemplateCustomDefaulter
+	)
+
+	BeforeEach(func() {
+		obj = &infrastructurev1alpha1.IncusMachineTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+			Spec: infrastructurev1alpha1.IncusMachineTemplateSpec{
+				Template: infrastructurev1alpha1.IncusMachineTemplateResource{
+					Spec: infrastructurev1alpha1.IncusMachineSpec{
+						Image:     "images:ubuntu/24.04/cloud",
+						CPUs:      2,
+						MemoryMiB: 2048,
+					},
+				},
+			},
+		}
+		oldObj = obj.DeepCopy()
+		validator = IncusMachineTemplateCustomValidator{}
+		defaulter = IncusMachineTemplateCustomDefaulter{}
+	})
+
+	Context("When creating an IncusMachineTemplate under Defaulting Webhook", func() {
+		It("Should fill in the defaults of the template spec", func() {
+			obj.Spec.Template.Spec = infrastructurev1alpha1.IncusMachineSpec{}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Template.Spec.Image).To(Equal(infrastructurev1alpha1.DefaultImage))
+			Expect(obj.Spec.Template.Spec.CPUs).To(Equal(infrastructurev1alpha1.DefaultCPUs))
+			Expect(obj.Spec.Template.Spec.MemoryMiB).To(Equal(infrastructurev1alpha1.DefaultMemoryMiB))
+			Expect(obj.Spec.Template.Spec.BootAutostart).To(HaveValue(BeTrue()))
+		})
+	})
+
+	Context("When creating an IncusMachineTemplate under Validating Webhook", func() {
+		It("Should admit a valid template", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should report invalid fields under the template spec", func() {
+			obj.Spec.Template.Spec.MemoryMiB = 0
+			obj.Spec.Template.Spec.InstanceType = "container"
+			secureBoot := true
+			obj.Spec.Template.Spec.SecureBoot = &secureBoot
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.template.spec.memoryMiB"))
+			Expect(err.Error()).To(ContainSubstring("spec.template.spec.secureBoot"))
+		})
+
+		It("Should deny a providerID", func() {
+			providerID := "incus://node-0"
+			obj.Spec.Template.Spec.ProviderID = &providerID
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.template.spec.providerID"))
+		})
+	})
+
+	Context("When updating an IncusMachineTemplate under Validating Webhook", func() {
+		It("Should admit changes to the metadata", func() {
+			obj.Labels = map[string]string{"tier": "workers"}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny changes to the template", func() {
+			obj.Spec.Template.Spec.CPUs = 4
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.template"))
+		})
+	})
+
+	Context("When storing an IncusMachineTemplate", func() {
+		It("Should round-trip the template through the API server", func() {
+			obj.Spec.Template.ObjectMeta = clusterv1.ObjectMeta{
+				Labels:      map[string]string{"node-role": "worker"},
+				Annotations: map[string]string{"example.com/owner": "team-a"},
+			}
+			obj.Spec.Template.Spec.Labels = map[string]string{"team": "a"}
+			obj.Spec.Template.Spec.DataDisks = []infrastructurev1alpha1.DataDisk{{SizeGiB: 10, Pool: "default"}}
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+			})
+
+			want := obj.Spec.DeepCopy()
+			defaultIncusMachineSpec(&want.Template.Spec)
+			stored := &infrastructurev1alpha1.IncusMachineTemplate{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), stored)).To(Succeed())
+			Expect(stored.Spec).To(Equal(*want))
+		})
+
+		It("Should be enforced by the API server", func() {
+			obj.Name = "test-invalid-template"
+			obj.Spec.Template.Spec.CPUs = -1
+			err := k8sClient.Create(ctx, obj)
+			Expect(apierrors.IsInvalid(err) || apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error %v", err)
+			Expect(err.Error()).To(ContainSubstring("spec.template.spec.cpus"))
+		})
+	})
+})